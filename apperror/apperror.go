@@ -0,0 +1,88 @@
+// Package apperror 定义返回给客户端的应用错误
+//
+// Error 的 Message 会原样返回给客户端，不能包含内部细节；原始错误放在 Err 中，只写入日志。
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error 是带有 HTTP 状态码和错误码的应用错误
+type Error struct {
+	// HTTP 状态码
+	Status int
+	// 机器可读的错误码，例如 invalid_param
+	Code string
+	// 可以展示给客户端的信息
+	Message string
+	// 原始错误，不返回给客户端
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New 创建应用错误
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap 创建包含原始错误的应用错误
+func Wrap(err error, status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message, Err: err}
+}
+
+func BadRequest(code, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+// InvalidParam 表示查询参数不合法，err 的信息会返回给客户端
+func InvalidParam(err error) *Error {
+	return Wrap(err, http.StatusBadRequest, "invalid_param", err.Error())
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, "not_found", message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, "unauthorized", message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, "forbidden", message)
+}
+
+// Internal 表示服务端错误，不向客户端暴露原始错误
+func Internal(err error) *Error {
+	return Wrap(err, http.StatusInternalServerError, "internal", "internal server error")
+}
+
+// Unavailable 表示依赖暂时不可用，客户端可以重试
+func Unavailable(err error, message string) *Error {
+	return Wrap(err, http.StatusServiceUnavailable, "unavailable", message)
+}
+
+// BadGateway 表示上游服务出错
+func BadGateway(err error, message string) *Error {
+	return Wrap(err, http.StatusBadGateway, "bad_gateway", message)
+}
+
+// From 把任意错误转换为应用错误，未知错误视为服务端错误
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
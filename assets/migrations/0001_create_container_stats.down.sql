@@ -0,0 +1 @@
+-- 基线迁移：container_stats 保存着迁移引入之前的数据，回滚时不删除，需要时手动 DROP TABLE
@@ -0,0 +1,19 @@
+-- 迁移引入之前部署的数据库已经有这张表，需要先执行 migrate baseline 1
+CREATE TABLE container_stats (
+    id                BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    __time            DATETIME(3)     NOT NULL,
+    container_id      VARCHAR(64)     NOT NULL,
+    container_name    VARCHAR(255)    NOT NULL DEFAULT '',
+    cpu_percent       DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage         BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    mem_limit         BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    mem_percent       DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes      BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    net_tx_bytes      BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    block_read_bytes  BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    block_write_bytes BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    pids              INT UNSIGNED    NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    KEY idx_container_stats_container_time (container_id, __time),
+    KEY idx_container_stats_time (__time)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
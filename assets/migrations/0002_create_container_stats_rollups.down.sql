@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS rollup_watermarks;
+DROP TABLE IF EXISTS container_stats_1h;
+DROP TABLE IF EXISTS container_stats_1m;
@@ -0,0 +1,79 @@
+-- 按分钟和小时汇总的数据，每个字段保存 sum/min/max，平均值为 sum / samples
+CREATE TABLE IF NOT EXISTS container_stats_1m (
+    __time                 DATETIME        NOT NULL,
+    container_id           VARCHAR(64)     NOT NULL,
+    container_name         VARCHAR(255)    NOT NULL DEFAULT '',
+    samples                INT UNSIGNED    NOT NULL DEFAULT 0,
+    cpu_percent_sum        DOUBLE          NOT NULL DEFAULT 0,
+    cpu_percent_min        DOUBLE          NOT NULL DEFAULT 0,
+    cpu_percent_max        DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage_sum          DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage_min          DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage_max          DOUBLE          NOT NULL DEFAULT 0,
+    mem_limit_sum          DOUBLE          NOT NULL DEFAULT 0,
+    mem_limit_min          DOUBLE          NOT NULL DEFAULT 0,
+    mem_limit_max          DOUBLE          NOT NULL DEFAULT 0,
+    mem_percent_sum        DOUBLE          NOT NULL DEFAULT 0,
+    mem_percent_min        DOUBLE          NOT NULL DEFAULT 0,
+    mem_percent_max        DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes_sum       DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes_min       DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes_max       DOUBLE          NOT NULL DEFAULT 0,
+    net_tx_bytes_sum       DOUBLE          NOT NULL DEFAULT 0,
+    net_tx_bytes_min       DOUBLE          NOT NULL DEFAULT 0,
+    net_tx_bytes_max       DOUBLE          NOT NULL DEFAULT 0,
+    block_read_bytes_sum   DOUBLE          NOT NULL DEFAULT 0,
+    block_read_bytes_min   DOUBLE          NOT NULL DEFAULT 0,
+    block_read_bytes_max   DOUBLE          NOT NULL DEFAULT 0,
+    block_write_bytes_sum  DOUBLE          NOT NULL DEFAULT 0,
+    block_write_bytes_min  DOUBLE          NOT NULL DEFAULT 0,
+    block_write_bytes_max  DOUBLE          NOT NULL DEFAULT 0,
+    pids_sum               DOUBLE          NOT NULL DEFAULT 0,
+    pids_min               DOUBLE          NOT NULL DEFAULT 0,
+    pids_max               DOUBLE          NOT NULL DEFAULT 0,
+    PRIMARY KEY (container_id, __time),
+    KEY idx_container_stats_1m_time (__time)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS container_stats_1h (
+    __time                 DATETIME        NOT NULL,
+    container_id           VARCHAR(64)     NOT NULL,
+    container_name         VARCHAR(255)    NOT NULL DEFAULT '',
+    samples                INT UNSIGNED    NOT NULL DEFAULT 0,
+    cpu_percent_sum        DOUBLE          NOT NULL DEFAULT 0,
+    cpu_percent_min        DOUBLE          NOT NULL DEFAULT 0,
+    cpu_percent_max        DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage_sum          DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage_min          DOUBLE          NOT NULL DEFAULT 0,
+    mem_usage_max          DOUBLE          NOT NULL DEFAULT 0,
+    mem_limit_sum          DOUBLE          NOT NULL DEFAULT 0,
+    mem_limit_min          DOUBLE          NOT NULL DEFAULT 0,
+    mem_limit_max          DOUBLE          NOT NULL DEFAULT 0,
+    mem_percent_sum        DOUBLE          NOT NULL DEFAULT 0,
+    mem_percent_min        DOUBLE          NOT NULL DEFAULT 0,
+    mem_percent_max        DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes_sum       DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes_min       DOUBLE          NOT NULL DEFAULT 0,
+    net_rx_bytes_max       DOUBLE          NOT NULL DEFAULT 0,
+    net_tx_bytes_sum       DOUBLE          NOT NULL DEFAULT 0,
+    net_tx_bytes_min       DOUBLE          NOT NULL DEFAULT 0,
+    net_tx_bytes_max       DOUBLE          NOT NULL DEFAULT 0,
+    block_read_bytes_sum   DOUBLE          NOT NULL DEFAULT 0,
+    block_read_bytes_min   DOUBLE          NOT NULL DEFAULT 0,
+    block_read_bytes_max   DOUBLE          NOT NULL DEFAULT 0,
+    block_write_bytes_sum  DOUBLE          NOT NULL DEFAULT 0,
+    block_write_bytes_min  DOUBLE          NOT NULL DEFAULT 0,
+    block_write_bytes_max  DOUBLE          NOT NULL DEFAULT 0,
+    pids_sum               DOUBLE          NOT NULL DEFAULT 0,
+    pids_min               DOUBLE          NOT NULL DEFAULT 0,
+    pids_max               DOUBLE          NOT NULL DEFAULT 0,
+    PRIMARY KEY (container_id, __time),
+    KEY idx_container_stats_1h_time (__time)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- 每个汇总表已经处理到的时间
+CREATE TABLE IF NOT EXISTS rollup_watermarks (
+    name      VARCHAR(64) NOT NULL,
+    watermark DATETIME    NOT NULL,
+    PRIMARY KEY (name)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,10 @@
+-- 登录用户，roles 为逗号分隔的角色列表
+CREATE TABLE IF NOT EXISTS users (
+    id             BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    username       VARCHAR(64)     NOT NULL,
+    password_hash  VARCHAR(255)    NOT NULL DEFAULT '',
+    roles          VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at     DATETIME        NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_users_username (username)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
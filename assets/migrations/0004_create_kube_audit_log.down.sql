@@ -0,0 +1 @@
+DROP TABLE IF EXISTS kube_audit_log;
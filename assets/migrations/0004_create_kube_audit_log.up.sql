@@ -0,0 +1,24 @@
+-- 通过 /kube 代理和资源浏览页面执行的 Kubernetes 请求
+CREATE TABLE IF NOT EXISTS kube_audit_log (
+    id           BIGINT UNSIGNED   NOT NULL AUTO_INCREMENT,
+    __time       DATETIME(3)       NOT NULL,
+    cluster      VARCHAR(64)       NOT NULL DEFAULT '',
+    username     VARCHAR(64)       NOT NULL DEFAULT '',
+    client_ip    VARCHAR(45)       NOT NULL DEFAULT '',
+    verb         VARCHAR(32)       NOT NULL DEFAULT '',
+    method       VARCHAR(10)       NOT NULL DEFAULT '',
+    path         VARCHAR(1024)     NOT NULL DEFAULT '',
+    api_group    VARCHAR(253)      NOT NULL DEFAULT '',
+    resource     VARCHAR(253)      NOT NULL DEFAULT '',
+    subresource  VARCHAR(64)       NOT NULL DEFAULT '',
+    namespace    VARCHAR(253)      NOT NULL DEFAULT '',
+    name         VARCHAR(253)      NOT NULL DEFAULT '',
+    status_code  SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+    latency_ms   BIGINT UNSIGNED   NOT NULL DEFAULT 0,
+    body_sha256  CHAR(64)          NOT NULL DEFAULT '',
+    request_id   VARCHAR(64)       NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    KEY idx_kube_audit_log_time (__time),
+    KEY idx_kube_audit_log_user_time (username, __time),
+    KEY idx_kube_audit_log_namespace_time (namespace, __time)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,162 @@
+// pod 终端：通过 /kube 代理的 WebSocket 连接 pods/exec，使用 Kubernetes 的 channel.k8s.io 协议
+// 每条二进制消息的第一个字节是通道：0 stdin，1 stdout，2 stderr，3 错误（Status JSON），4 窗口大小
+(function () {
+  'use strict';
+
+  var STDIN = 0, STDOUT = 1, STDERR = 2, ERROR = 3, RESIZE = 4;
+  // 输出中的 ANSI 控制序列（颜色、光标移动、窗口标题等），简单终端不处理，直接去掉
+  var ANSI = /\x1b\[[0-?]*[ -\/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>]/g;
+  var KEYS = {
+    Enter: '\r', Backspace: '\x7f', Tab: '\t', Escape: '\x1b', Delete: '\x1b[3~',
+    ArrowUp: '\x1b[A', ArrowDown: '\x1b[B', ArrowRight: '\x1b[C', ArrowLeft: '\x1b[D',
+    Home: '\x1b[H', End: '\x1b[F', PageUp: '\x1b[5~', PageDown: '\x1b[6~'
+  };
+  // 最多保留的输出字符数
+  var MAX_OUTPUT = 200000;
+
+  var term = document.getElementById('terminal');
+  var status = document.getElementById('terminal-status');
+  var encoder = new TextEncoder();
+  var decoder = new TextDecoder();
+  var socket = null;
+
+  function setStatus(text, cls) {
+    status.textContent = text;
+    status.className = 'badge' + (cls ? ' ' + cls : '');
+  }
+
+  function write(text) {
+    text = text.replace(ANSI, '').replace(/\r\n/g, '\n');
+    var out = term.textContent;
+    for (var i = 0; i < text.length; i++) {
+      var c = text[i];
+      if (c === '\b') {
+        out = out.slice(0, -1);
+      } else if (c === '\x07' || c === '\r') {
+        // 忽略响铃；不支持回到行首覆盖输出，单独的回车也忽略
+      } else {
+        out += c;
+      }
+    }
+    if (out.length > MAX_OUTPUT) {
+      out = out.slice(out.length - MAX_OUTPUT);
+    }
+    term.textContent = out;
+    term.scrollTop = term.scrollHeight;
+  }
+
+  function execURL() {
+    var d = term.dataset;
+    var params = new URLSearchParams({ stdin: 'true', stdout: 'true', stderr: 'true', tty: 'true' });
+    if (d.container) {
+      params.set('container', d.container);
+    }
+    JSON.parse(d.command).forEach(function (arg) { params.append('command', arg); });
+    var scheme = location.protocol === 'https:' ? 'wss:' : 'ws:';
+    return scheme + '//' + location.host + '/kube/' + encodeURIComponent(d.cluster) +
+      '/api/v1/namespaces/' + encodeURIComponent(d.namespace) +
+      '/pods/' + encodeURIComponent(d.pod) + '/exec?' + params.toString();
+  }
+
+  function send(channel, data) {
+    if (!socket || socket.readyState !== WebSocket.OPEN) {
+      return;
+    }
+    var bytes = typeof data === 'string' ? encoder.encode(data) : data;
+    var msg = new Uint8Array(bytes.length + 1);
+    msg[0] = channel;
+    msg.set(bytes, 1);
+    socket.send(msg);
+  }
+
+  // 按字符宽度估算行列数
+  function resize() {
+    var probe = document.createElement('span');
+    probe.textContent = 'x';
+    term.appendChild(probe);
+    var w = probe.getBoundingClientRect().width || 8;
+    var h = probe.getBoundingClientRect().height || 18;
+    term.removeChild(probe);
+    var cols = Math.max(20, Math.floor((term.clientWidth - 16) / w));
+    var rows = Math.max(5, Math.floor((term.clientHeight - 16) / h));
+    send(RESIZE, JSON.stringify({ Width: cols, Height: rows }));
+  }
+
+  function connect() {
+    if (socket) {
+      socket.onclose = null;
+      socket.close();
+    }
+    term.textContent = '';
+    setStatus('connecting');
+    socket = new WebSocket(execURL(), ['v5.channel.k8s.io', 'v4.channel.k8s.io']);
+    socket.binaryType = 'arraybuffer';
+    socket.onopen = function () {
+      setStatus('connected', 'ok');
+      resize();
+      term.focus();
+    };
+    socket.onmessage = function (event) {
+      var data = new Uint8Array(event.data);
+      if (data.length === 0) {
+        return;
+      }
+      var text = decoder.decode(data.subarray(1), { stream: true });
+      switch (data[0]) {
+        case STDOUT:
+        case STDERR:
+          write(text);
+          break;
+        case ERROR:
+          try {
+            var st = JSON.parse(text);
+            if (st.status !== 'Success') {
+              write('\n' + (st.message || text) + '\n');
+            }
+          } catch (e) {
+            write('\n' + text + '\n');
+          }
+          break;
+      }
+    };
+    socket.onerror = function () {
+      setStatus('error', 'bad');
+    };
+    socket.onclose = function (event) {
+      // 升级失败（没有权限、pod 不存在等）时浏览器只给出 1006，详细原因在代理返回的 Status 中
+      setStatus(event.code === 1000 ? 'closed' : 'disconnected (' + event.code + ')', event.code === 1000 ? '' : 'warn');
+      socket = null;
+    };
+  }
+
+  term.addEventListener('keydown', function (event) {
+    var key = KEYS[event.key];
+    if (event.ctrlKey && !event.shiftKey && !event.altKey && event.key.length === 1) {
+      var code = event.key.toUpperCase().charCodeAt(0);
+      if (code >= 64 && code <= 95) {
+        key = String.fromCharCode(code - 64);
+      }
+    } else if (!key && event.key.length === 1 && !event.ctrlKey && !event.metaKey) {
+      key = event.altKey ? '\x1b' + event.key : event.key;
+    }
+    if (key) {
+      event.preventDefault();
+      send(STDIN, key);
+    }
+  });
+  term.addEventListener('paste', function (event) {
+    event.preventDefault();
+    send(STDIN, event.clipboardData.getData('text'));
+  });
+  var button = document.getElementById('terminal-reconnect');
+  button.addEventListener('click', function () {
+    button.textContent = 'Reconnect';
+    connect();
+  });
+  window.addEventListener('resize', resize);
+
+  // 指定了命令的链接可能来自其他站点，等用户点击 Run 后再连接
+  if (term.dataset.autoconnect === 'true') {
+    connect();
+  }
+})();
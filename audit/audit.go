@@ -0,0 +1,234 @@
+// Package audit 异步记录 Kubernetes 请求的审计日志，写入数据库或 JSONL 文件
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go-mysti/model"
+)
+
+// Recorder 接收审计记录，不能阻塞请求
+type Recorder interface {
+	Record(entry model.AuditEntry)
+}
+
+// Writer 写入一批记录，通常是 repository.Audit 或 File
+type Writer interface {
+	InsertAuditEntries(ctx context.Context, entries []model.AuditEntry) error
+}
+
+type Options struct {
+	// 缓冲区最多容纳的记录数，超出后丢弃新记录
+	QueueSize int
+	// 刷新间隔
+	FlushInterval time.Duration
+}
+
+// 每次写入的最大记录数
+const batchSize = 500
+
+// Logger 把记录缓冲起来，在后台按批次交给 Writer，写入失败时保留在缓冲区中重试
+type Logger struct {
+	name   string
+	writer Writer
+	opts   Options
+
+	mu      sync.Mutex
+	pending []model.AuditEntry
+	dropped int
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// NewLogger 创建 Logger，name 用于日志中区分不同的输出
+func NewLogger(name string, writer Writer, opts Options) *Logger {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	return &Logger{
+		name:   name,
+		writer: writer,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Record 把记录放入缓冲区，缓冲区已满或已关闭时丢弃
+func (l *Logger) Record(entry model.AuditEntry) {
+	l.mu.Lock()
+	if l.closed || len(l.pending) >= l.opts.QueueSize {
+		l.dropped++
+		l.mu.Unlock()
+		return
+	}
+	l.pending = append(l.pending, entry)
+	full := len(l.pending) >= batchSize
+	l.mu.Unlock()
+
+	if full {
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run 在后台写入记录，直到 Close 被调用，返回前会写完缓冲区中的记录
+func (l *Logger) Run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.wake:
+		}
+
+		l.mu.Lock()
+		closed := l.closed
+		l.mu.Unlock()
+
+		l.flush()
+		if closed {
+			return
+		}
+	}
+}
+
+// Close 停止接收记录并等待缓冲区写完
+func (l *Logger) Close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	<-l.done
+}
+
+func (l *Logger) flush() {
+	l.mu.Lock()
+	if l.dropped > 0 {
+		log.Printf("audit %s: dropped %d entries, queue is full", l.name, l.dropped)
+		l.dropped = 0
+	}
+	l.mu.Unlock()
+
+	for {
+		l.mu.Lock()
+		n := min(len(l.pending), batchSize)
+		if n == 0 {
+			l.mu.Unlock()
+			return
+		}
+		batch := make([]model.AuditEntry, n)
+		copy(batch, l.pending)
+		l.pending = l.pending[n:]
+		l.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := l.writer.InsertAuditEntries(ctx, batch)
+		cancel()
+		if err != nil {
+			log.Printf("audit %s: write %d entries: %v", l.name, len(batch), err)
+
+			l.mu.Lock()
+			if !l.closed && len(l.pending)+len(batch) <= l.opts.QueueSize {
+				l.pending = append(batch, l.pending...)
+			} else {
+				log.Printf("audit %s: dropped %d entries", l.name, len(batch))
+			}
+			l.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Multi 把记录交给所有 Recorder，没有 Recorder 时丢弃
+type Multi []Recorder
+
+func (m Multi) Record(entry model.AuditEntry) {
+	for _, r := range m {
+		r.Record(entry)
+	}
+}
+
+// File 以 JSON Lines 格式追加写入文件
+//
+// 每次写入前检查路径是否仍指向打开的文件，logrotate 等工具移走文件后重新创建。
+type File struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFile 打开或创建文件
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.reopen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) reopen() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	return nil
+}
+
+func (f *File) InsertAuditEntries(_ context.Context, entries []model.AuditEntry) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range entries {
+		if err := encoder.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	opened, err1 := f.file.Stat()
+	current, err2 := os.Stat(f.path)
+	if err1 != nil || err2 != nil || !os.SameFile(opened, current) {
+		if err := f.reopen(); err != nil {
+			return err
+		}
+	}
+	_, err := f.file.Write(buf.Bytes())
+	return err
+}
+
+// Close 关闭文件
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go-mysti/model"
+)
+
+// 前 failures 次写入失败
+type flakyWriter struct {
+	mu       sync.Mutex
+	failures int
+	written  []model.AuditEntry
+}
+
+func (w *flakyWriter) InsertAuditEntries(_ context.Context, entries []model.AuditEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("database is down")
+	}
+	w.written = append(w.written, entries...)
+	return nil
+}
+
+func TestLoggerRetriesAndDrops(t *testing.T) {
+	w := &flakyWriter{failures: 1}
+	l := NewLogger("test", w, Options{QueueSize: 3, FlushInterval: 10 * time.Millisecond})
+	for i := range 5 {
+		l.Record(model.AuditEntry{Path: string(rune('a' + i))})
+	}
+	go l.Run()
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+	l.Record(model.AuditEntry{Path: "after close"})
+
+	// 第一次写入失败后重试，超出缓冲区的两条和关闭后的记录被丢弃
+	var paths []string
+	for _, e := range w.written {
+		paths = append(paths, e.Path)
+	}
+	if len(paths) != 3 || paths[0] != "a" || paths[2] != "c" {
+		t.Errorf("written = %v", paths)
+	}
+}
+
+func TestFileReopensAfterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	if err := f.InsertAuditEntries(ctx, []model.AuditEntry{{Username: "alice"}, {Username: "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.InsertAuditEntries(ctx, []model.AuditEntry{{Username: "carol"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	users := func(name string) []string {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		var users []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var e model.AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			users = append(users, e.Username)
+		}
+		return users
+	}
+	if got := users(path + ".1"); len(got) != 2 || got[1] != "bob" {
+		t.Errorf("rotated file = %v", got)
+	}
+	if got := users(path); len(got) != 1 || got[0] != "carol" {
+		t.Errorf("new file = %v", got)
+	}
+}
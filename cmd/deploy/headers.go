@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// 响应头规则，按顺序应用，后面的规则覆盖前面的规则
+//
+// Match 支持三种写法：
+//   - ".js"：按扩展名匹配，目录请求按响应的 Content-Type 对应的扩展名匹配
+//   - "/assets/**"：以 / 开头时匹配完整路径，* 不跨越 /，** 可跨越 /
+//   - "*.html"：不以 / 开头时只匹配路径最后一段
+type headerRule struct {
+	Match  string            `json:"match"`
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+	CORS   string            `json:"cors,omitempty"`
+	// 允许回显的来源，支持 * 通配符，例如 https://*.example.com；credentials 预设必须配置
+	Origins []string `json:"origins,omitempty"`
+
+	pattern *regexp.Regexp
+	origins []*regexp.Regexp
+}
+
+// CORS 预设
+var corsPresets = map[string]map[string]string{
+	// 允许任意来源的只读访问
+	"public": {
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers": "*",
+		"Access-Control-Max-Age":       "86400",
+	},
+	// 回显 Origins 中允许的请求来源并允许携带凭据
+	"credentials": {
+		"Access-Control-Allow-Origin":      "$origin",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+		"Access-Control-Max-Age":           "86400",
+	},
+}
+
+// 命令行中重复出现的 -header 参数
+//
+//	-header '*.js:Cache-Control=public, max-age=31536000, immutable'  设置（覆盖）
+//	-header '/docs/**:+Link=</style.css>; rel=preload'                追加
+//	-header '*.html:-Server'                                          删除
+type headerRuleFlags []headerRule
+
+func (f *headerRuleFlags) String() string {
+	return fmt.Sprintf("%d rules", len(*f))
+}
+
+func (f *headerRuleFlags) Set(value string) error {
+	match, spec, ok := strings.Cut(value, ":")
+	if !ok || spec == "" {
+		return fmt.Errorf("invalid header rule %q, expected PATTERN:[+|-]Name[=value]", value)
+	}
+
+	rule := headerRule{Match: match}
+	switch spec[0] {
+	case '-':
+		rule.Remove = []string{spec[1:]}
+	case '+':
+		name, val, ok := strings.Cut(spec[1:], "=")
+		if !ok {
+			return fmt.Errorf("invalid header rule %q, missing value", value)
+		}
+		rule.Add = map[string]string{name: val}
+	default:
+		name, val, ok := strings.Cut(spec, "=")
+		if !ok {
+			return fmt.Errorf("invalid header rule %q, missing value", value)
+		}
+		rule.Set = map[string]string{name: val}
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+// 从 JSON 文件加载规则，文件内容为规则数组
+func loadHeaderRules(file string) ([]headerRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []headerRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// 编译匹配模式并检查 CORS 预设
+func compileHeaderRules(rules []headerRule) ([]headerRule, error) {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.CORS != "" {
+			if _, ok := corsPresets[rule.CORS]; !ok {
+				return nil, fmt.Errorf("rule %q: unknown cors preset %q", rule.Match, rule.CORS)
+			}
+		}
+		if err := rule.compileOrigins(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Match, err)
+		}
+		if strings.HasPrefix(rule.Match, ".") {
+			continue
+		}
+		re, err := globToRegexp(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Match, err)
+		}
+		rule.pattern = re
+	}
+	return rules, nil
+}
+
+// 回显来源的预设必须配置来源白名单，否则任意网站都可以携带凭据访问
+func (rule *headerRule) compileOrigins() error {
+	reflects := false
+	for _, val := range corsPresets[rule.CORS] {
+		reflects = reflects || val == "$origin"
+	}
+	if !reflects {
+		if len(rule.Origins) > 0 {
+			return fmt.Errorf("origins requires the credentials cors preset")
+		}
+		return nil
+	}
+	if len(rule.Origins) == 0 {
+		return fmt.Errorf("cors preset %q requires origins", rule.CORS)
+	}
+	rule.origins = nil
+	for _, origin := range rule.Origins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "" || origin == "*" || origin == "null" {
+			return fmt.Errorf("invalid origin %q", origin)
+		}
+		re, err := globToRegexp(origin)
+		if err != nil {
+			return fmt.Errorf("origin %q: %w", origin, err)
+		}
+		rule.origins = append(rule.origins, re)
+	}
+	return nil
+}
+
+func (rule *headerRule) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, re := range rule.origins {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// 判断规则是否匹配请求路径，contentType 为空时只按路径判断
+func (rule *headerRule) matches(urlPath, contentType string) bool {
+	if rule.pattern == nil {
+		ext := path.Ext(urlPath)
+		if ext == "" && contentType != "" {
+			if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+				for _, e := range exts {
+					if strings.EqualFold(e, rule.Match) {
+						return true
+					}
+				}
+			}
+			return false
+		}
+		return strings.EqualFold(ext, rule.Match)
+	}
+	if strings.HasPrefix(rule.Match, "/") {
+		return rule.pattern.MatchString(urlPath)
+	}
+	return rule.pattern.MatchString(path.Base(urlPath))
+}
+
+// 应用规则，需要回显来源但请求来源不在白名单中时不设置 CORS 响应头，返回 false
+func (rule *headerRule) apply(h http.Header, r *http.Request) bool {
+	allowed := rule.applyCORS(h, r)
+	for _, name := range rule.Remove {
+		h.Del(name)
+	}
+	for name, val := range rule.Set {
+		// Vary 是缓存键，覆盖会丢掉其他规则或处理器添加的值
+		if http.CanonicalHeaderKey(name) == "Vary" {
+			addVary(h, val)
+			continue
+		}
+		h.Set(name, val)
+	}
+	for name, val := range rule.Add {
+		h.Add(name, val)
+	}
+	return allowed
+}
+
+func (rule *headerRule) applyCORS(h http.Header, r *http.Request) bool {
+	if rule.CORS == "" {
+		return true
+	}
+	preset := corsPresets[rule.CORS]
+	if len(rule.origins) > 0 {
+		// 响应随 Origin 变化，缓存需要区分
+		addVary(h, "Origin")
+		if origin := r.Header.Get("Origin"); origin == "" || !rule.allowsOrigin(origin) {
+			return false
+		}
+	}
+	for name, val := range preset {
+		if val == "$origin" {
+			val = r.Header.Get("Origin")
+		}
+		h.Set(name, val)
+	}
+	return true
+}
+
+// 把逗号分隔的字段合并进 Vary，已有的字段不重复添加
+func addVary(h http.Header, value string) {
+	seen := make(map[string]bool)
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			seen[strings.ToLower(strings.TrimSpace(f))] = true
+		}
+	}
+	for _, f := range strings.Split(value, ",") {
+		f = strings.TrimSpace(f)
+		if f != "" && !seen[strings.ToLower(f)] {
+			seen[strings.ToLower(f)] = true
+			h.Add("Vary", f)
+		}
+	}
+}
+
+// 为处理器增加响应头规则
+func withHeaderRules(rules []headerRule, next http.Handler) http.Handler {
+	if len(rules) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS 预检请求直接响应
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			for i := range rules {
+				if rules[i].CORS != "" && rules[i].matches(r.URL.Path, "") {
+					if !rules[i].apply(w.Header(), r) {
+						http.Error(w, "origin not allowed", http.StatusForbidden)
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(&headerRuleWriter{ResponseWriter: w, r: r, rules: rules}, r)
+	})
+}
+
+// 在写入响应头之前应用规则，这样可以覆盖或删除处理器设置的响应头
+type headerRuleWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	rules   []headerRule
+	written bool
+}
+
+func (w *headerRuleWriter) WriteHeader(code int) {
+	if !w.written {
+		w.written = true
+		h := w.Header()
+		contentType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+		for i := range w.rules {
+			if w.rules[i].matches(w.r.URL.Path, contentType) {
+				w.rules[i].apply(h, w.r)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerRuleWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerRuleWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderRuleMatches(t *testing.T) {
+	tests := []struct {
+		match, path, contentType string
+		want                     bool
+	}{
+		{".js", "/static/app.js", "", true},
+		{".JS", "/static/app.js", "", true},
+		{".js", "/static/app.css", "", false},
+		// 目录请求按 Content-Type 匹配扩展名
+		{".html", "/docs/", "text/html", true},
+		{".html", "/docs/", "", false},
+		{"/assets/*", "/assets/a.png", "", true},
+		{"/assets/*", "/assets/img/a.png", "", false},
+		{"/assets/**", "/assets/img/a.png", "", true},
+		{"/a?c", "/abc", "", true},
+		{"/a?c", "/a/c", "", false},
+		{"*.html", "/deep/dir/page.html", "", true},
+		{"*.html", "/page.htm", "", false},
+	}
+	for _, tt := range tests {
+		rules, err := compileHeaderRules([]headerRule{{Match: tt.match}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rules[0].matches(tt.path, tt.contentType); got != tt.want {
+			t.Errorf("%q matches(%q, %q) = %v", tt.match, tt.path, tt.contentType, got)
+		}
+	}
+}
+
+func TestHeaderRuleFlags(t *testing.T) {
+	var f headerRuleFlags
+	for _, v := range []string{"*.js:Cache-Control=max-age=60", "/docs/**:+Link=</a.css>", "*.html:-Server"} {
+		if err := f.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f[0].Set["Cache-Control"] != "max-age=60" || f[1].Add["Link"] != "</a.css>" || f[2].Remove[0] != "Server" {
+		t.Errorf("rules = %+v", f)
+	}
+	for _, v := range []string{"no-colon", "*.js:", "*.js:+Link"} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded", v)
+		}
+	}
+}
+
+func TestCompileCORSOrigins(t *testing.T) {
+	tests := []struct {
+		rule headerRule
+		ok   bool
+	}{
+		{headerRule{Match: "/**", CORS: "public"}, true},
+		{headerRule{Match: "/**", CORS: "public", Origins: []string{"https://a.com"}}, false},
+		{headerRule{Match: "/**", CORS: "credentials"}, false},
+		{headerRule{Match: "/**", CORS: "credentials", Origins: []string{"*"}}, false},
+		{headerRule{Match: "/**", CORS: "credentials", Origins: []string{"https://*.example.com"}}, true},
+		{headerRule{Match: "/**", CORS: "unknown"}, false},
+	}
+	for _, tt := range tests {
+		if _, err := compileHeaderRules([]headerRule{tt.rule}); (err == nil) != tt.ok {
+			t.Errorf("compile %+v: err = %v", tt.rule, err)
+		}
+	}
+}
+
+func TestWithHeaderRules(t *testing.T) {
+	rules, err := compileHeaderRules([]headerRule{
+		{Match: "/**", CORS: "credentials", Origins: []string{"https://app.example.com", "https://*.example.org"}},
+		{Match: ".js", Set: map[string]string{"Cache-Control": "immutable"}},
+		{Match: "*.js", Remove: []string{"X-Upstream"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withHeaderRules(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Upstream", "1")
+		w.Write([]byte("ok"))
+	}))
+
+	do := func(method, target, origin string, preflight bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if preflight {
+			r.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodGet, "/app.js", "https://app.example.com", false)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Cache-Control") != "immutable" || w.Header().Get("X-Upstream") != "" {
+		t.Errorf("GET /app.js headers = %v", w.Header())
+	}
+
+	// 不在白名单中的来源不回显
+	for _, origin := range []string{"https://evil.com", "https://app.example.com.evil.com", ""} {
+		w = do(http.MethodGet, "/page", origin, false)
+		if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("origin %q got CORS headers %v", origin, w.Header())
+		}
+		if w.Header().Get("Vary") != "Origin" || w.Body.String() != "ok" {
+			t.Errorf("origin %q: Vary = %q body = %q", origin, w.Header().Get("Vary"), w.Body)
+		}
+	}
+
+	// 预检请求
+	w = do(http.MethodOptions, "/api", "https://a.b.example.org", true)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://a.b.example.org" ||
+		w.Header().Get("Access-Control-Allow-Methods") == "" || w.Body.Len() != 0 {
+		t.Errorf("preflight = %d %v", w.Code, w.Header())
+	}
+	w = do(http.MethodOptions, "/api", "https://evil.com", true)
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight from evil.com = %d %v", w.Code, w.Header())
+	}
+	// 不是预检的 OPTIONS 交给处理器
+	if w = do(http.MethodOptions, "/api", "https://app.example.com", false); w.Body.String() != "ok" {
+		t.Errorf("OPTIONS without preflight = %d %q", w.Code, w.Body)
+	}
+}
+
+func TestHeaderRulesMergeVary(t *testing.T) {
+	for _, order := range []string{"cors first", "vary first"} {
+		rules := []headerRule{
+			{Match: "/**", CORS: "credentials", Origins: []string{"https://app.example.com"}},
+			{Match: "*.js", Set: map[string]string{"Vary": "Accept-Encoding, origin"}},
+		}
+		if order == "vary first" {
+			rules[0], rules[1] = rules[1], rules[0]
+		}
+		compiled, err := compileHeaderRules(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := withHeaderRules(compiled, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Vary", "Cookie")
+			w.Write([]byte("ok"))
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		// 处理器和两条规则的字段都保留，重复的 Origin 只出现一次
+		if got := strings.Join(w.Header().Values("Vary"), ", "); !strings.EqualFold(got, "Cookie, Origin, Accept-Encoding") &&
+			!strings.EqualFold(got, "Cookie, Accept-Encoding, Origin") {
+			t.Errorf("%s: Vary = %q", order, got)
+		}
+	}
+}
@@ -9,9 +9,12 @@ import (
 	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"go-mysti/serve"
+
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
@@ -24,29 +27,82 @@ var (
 	port        = flag.Int("port", 8000, "Specify alternate port [default: 8000]")
 	devMode     = flag.Bool("dev", false, "Enable development mode (use local files)")
 	directory   = flag.String("directory", ".", "Specify alternative directory [default: current directory]")
+	indexFiles  = flag.String("index", "index.html,index.htm", "Comma-separated list of index files to look for in directories")
+	noListing   = flag.Bool("no-listing", false, "Disable directory listing, respond 403 when a directory has no index file")
+	headerFile  = flag.String("header-config", "", "JSON file with response header rules")
+	corsPreset  = flag.String("cors", "", "Apply a CORS preset to all paths (public, credentials)")
+	corsOrigins = flag.String("cors-origins", "", "Comma-separated origins allowed by the credentials CORS preset, * matches within a host")
+	vhostFile   = flag.String("vhosts", "", "JSON file with virtual host definitions")
+	listenAddr  = flag.String("listen", "", "Listen address, overrides -bind/-port (host:port, unix:/path, systemd:[name])")
+	drainTime   = flag.Duration("drain-timeout", serve.DefaultDrainTimeout, "Time to wait for in-flight requests on shutdown")
+	headerFlags headerRuleFlags
 )
 
+func init() {
+	flag.Var(&headerFlags, "header", "Response header rule PATTERN:[+|-]Name[=value], may be repeated")
+}
+
 func main() {
 	flag.Parse()
 
 	var handler http.Handler
 
+	staticRoot, _ := fs.Sub(staticFiles, "static")
 	if *devMode {
 		// 开发模式：使用本地文件系统
 		handler = createLocalFileHandler(*directory)
 		fmt.Printf("Serving local files from directory %s\n", *directory)
 	} else {
 		// 生产模式：使用嵌入的文件系统
-		staticRoot, _ := fs.Sub(staticFiles, "static")
 		handler = createEmbedFileHandler(staticRoot)
 		fmt.Println("Serving embedded files")
 	}
 
+	// 虚拟主机：按 Host 分发，未匹配时使用默认主机或上面的处理器
+	if *vhostFile != "" {
+		hosts, err := loadVirtualHosts(*vhostFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handler, err = newVirtualHostHandler(hosts, staticRoot, handler)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Serving %d virtual hosts from %s\n", len(hosts), *vhostFile)
+	} else {
+		handler = withAccessLog("default", handler)
+	}
+
+	// 响应头规则：配置文件 -> -cors -> -header
+	var rules []headerRule
+	if *headerFile != "" {
+		fileRules, err := loadHeaderRules(*headerFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules = append(rules, fileRules...)
+	}
+	if *corsPreset != "" {
+		rule := headerRule{Match: "/**", CORS: *corsPreset}
+		if *corsOrigins != "" {
+			rule.Origins = strings.Split(*corsOrigins, ",")
+		}
+		rules = append(rules, rule)
+	}
+	rules, err := compileHeaderRules(append(rules, headerFlags...))
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler = withHeaderRules(rules, handler)
+
 	// 创建服务器
 	addr := fmt.Sprintf("%s:%d", *bindAddress, *port)
 	if *bindAddress == "" {
 		addr = fmt.Sprintf(":%d", *port)
 	}
+	if *listenAddr != "" {
+		addr = *listenAddr
+	}
 
 	// 使用标准库 http.Server
 	server := &http.Server{
@@ -61,14 +117,17 @@ func main() {
 	h2s := &http2.Server{}
 	server.Handler = h2c.NewHandler(handler, h2s)
 
-	fmt.Printf("Starting server at http://%s\n", addr)
+	fmt.Printf("Starting server at %s\n", addr)
 	fmt.Println("Press Ctrl+C to stop the server")
 
-	log.Fatal(server.ListenAndServe())
+	if err := serve.Run(server, serve.Options{Addr: addr, DrainTimeout: *drainTime}); err != nil {
+		log.Fatal(err)
+	}
 }
 
 // 创建本地文件处理器
 func createLocalFileHandler(dir string) http.Handler {
+	root := os.DirFS(dir)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 构建文件路径
 		path := filepath.Join(dir, r.URL.Path)
@@ -79,23 +138,33 @@ func createLocalFileHandler(dir string) http.Handler {
 		// 检查文件是否存在
 		info, err := os.Stat(path)
 		if err != nil {
-			if os.IsNotExist(err) {
-				// 文件不存在，显示目录列表
-				serveLocalDirectory(w, r, dir, r.URL.Path)
-				return
+			switch {
+			case os.IsNotExist(err):
+				serveError(w, r, root, http.StatusNotFound)
+			case os.IsPermission(err):
+				serveError(w, r, root, http.StatusForbidden)
+			default:
+				serveError(w, r, root, http.StatusInternalServerError)
 			}
-			http.Error(w, "Failed to access file", http.StatusInternalServerError)
 			return
 		}
 
-		// 如果是目录，显示目录列表
+		// 如果是目录，优先返回索引文件，其次显示目录列表
 		if info.IsDir() {
 			// 确保目录路径以 / 结尾
 			if !strings.HasSuffix(r.URL.Path, "/") {
-				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				redirectToDir(w, r)
 				return
 			}
-			serveLocalDirectory(w, r, path, r.URL.Path)
+			if index, ok := findIndexFile(root, urlToFSPath(r.URL.Path)); ok {
+				serveLocalFile(w, r, filepath.Join(dir, filepath.FromSlash(index)))
+				return
+			}
+			if *noListing {
+				serveError(w, r, root, http.StatusForbidden)
+				return
+			}
+			serveLocalDirectory(w, r, root, path, r.URL.Path)
 			return
 		}
 
@@ -107,23 +176,13 @@ func createLocalFileHandler(dir string) http.Handler {
 // 创建嵌入文件处理器
 func createEmbedFileHandler(root fs.FS) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// index.html
-		// 移除前导斜杠获取路径
-		path := strings.TrimPrefix(r.URL.Path, "/")
-
-		path = filepath.Clean(path)
-
-		// 如果路径为空，显示根目录内容
-		if path == "" {
-			serveEmbedDirectory(w, r, root, ".")
-			return
-		}
+		// 移除前导斜杠获取路径，根目录为 "."
+		path := urlToFSPath(r.URL.Path)
 
 		// 检查文件是否存在
 		file, err := root.Open(path)
 		if err != nil {
-			// 尝试在 static 目录下查找
-			http.NotFound(w, r)
+			serveError(w, r, root, http.StatusNotFound)
 			return
 		}
 		defer file.Close()
@@ -131,15 +190,23 @@ func createEmbedFileHandler(root fs.FS) http.Handler {
 		// 获取文件信息
 		info, err := file.Stat()
 		if err != nil {
-			http.NotFound(w, r)
+			serveError(w, r, root, http.StatusInternalServerError)
 			return
 		}
 
-		// 如果是目录，显示目录列表
+		// 如果是目录，优先返回索引文件，其次显示目录列表
 		if info.IsDir() {
 			// 确保目录路径以 / 结尾
 			if !strings.HasSuffix(r.URL.Path, "/") {
-				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				redirectToDir(w, r)
+				return
+			}
+			if index, ok := findIndexFile(root, path); ok {
+				serveEmbedPath(w, r, root, index)
+				return
+			}
+			if *noListing {
+				serveError(w, r, root, http.StatusForbidden)
 				return
 			}
 			serveEmbedDirectory(w, r, root, path)
@@ -147,15 +214,74 @@ func createEmbedFileHandler(root fs.FS) http.Handler {
 		}
 
 		// 是文件，提供文件内容
-		serveEmbedFile(w, r, path)
+		serveEmbedPath(w, r, root, path)
 	})
 }
 
+// 读取 root 中的文件，读取失败时返回错误页面
+func serveEmbedPath(w http.ResponseWriter, r *http.Request, root fs.FS, filePath string) {
+	data, err := fs.ReadFile(root, filePath)
+	if err != nil {
+		serveError(w, r, root, http.StatusNotFound)
+		return
+	}
+	serveEmbedFile(w, filePath, data)
+}
+
+// 目录请求补全结尾的 /，使用相对地址以便在挂载点下也能正常跳转
+func redirectToDir(w http.ResponseWriter, r *http.Request) {
+	target := path.Base(r.URL.Path) + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// 将请求路径转换为 fs.FS 使用的相对路径
+func urlToFSPath(urlPath string) string {
+	p := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// 按 -index 指定的顺序在目录中查找索引文件
+func findIndexFile(root fs.FS, dir string) (string, bool) {
+	for _, name := range strings.Split(*indexFiles, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p := path.Join(dir, name)
+		if info, err := fs.Stat(root, p); err == nil && !info.IsDir() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// 返回错误页面，优先使用服务根目录下的 404.html、403.html、500.html
+func serveError(w http.ResponseWriter, r *http.Request, root fs.FS, code int) {
+	data, err := fs.ReadFile(root, fmt.Sprintf("%d.html", code))
+	if err != nil {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
 // 服务本地目录
-func serveLocalDirectory(w http.ResponseWriter, r *http.Request, dirPath, urlPath string) {
+func serveLocalDirectory(w http.ResponseWriter, r *http.Request, root fs.FS, dirPath, urlPath string) {
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		http.Error(w, "Failed to read directory", http.StatusInternalServerError)
+		serveError(w, r, root, http.StatusInternalServerError)
 		return
 	}
 
@@ -196,18 +322,7 @@ func serveLocalFile(w http.ResponseWriter, r *http.Request, filePath string) {
 }
 
 // 服务嵌入文件
-func serveEmbedFile(w http.ResponseWriter, r *http.Request, filePath string) {
-	// 尝试直接读取文件
-	data, err := staticFiles.ReadFile(filePath)
-	if err != nil {
-		// 尝试在 static 目录下查找
-		data, err = staticFiles.ReadFile("static/" + filePath)
-		if err != nil {
-			http.NotFound(w, r)
-			return
-		}
-	}
-
+func serveEmbedFile(w http.ResponseWriter, filePath string, data []byte) {
 	// 设置内容类型
 	contentType := mime.TypeByExtension(filepath.Ext(filePath))
 	if contentType == "" {
@@ -221,12 +336,6 @@ func serveEmbedFile(w http.ResponseWriter, r *http.Request, filePath string) {
 
 // 生成目录列表HTML
 func generateDirectoryListing(urlPath string, entries interface{}) string {
-	// 处理目录遍历
-	parentDir := filepath.Dir(strings.TrimSuffix(urlPath, "/")) + "/"
-	if parentDir == "." || parentDir == "./" || parentDir == "//" {
-		parentDir = "/"
-	}
-
 	html := fmt.Sprintf(`<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01//EN" "http://www.w3.org/TR/html4/strict.dtd">
 <html>
 <head>
@@ -239,9 +348,9 @@ func generateDirectoryListing(urlPath string, entries interface{}) string {
 <ul>
 `, urlPath, urlPath)
 
-	// 添加上级目录链接（如果不是根目录）
+	// 添加上级目录链接（如果不是根目录），使用相对路径以便在挂载点下也能正常跳转
 	if urlPath != "/" && urlPath != "." {
-		html += fmt.Sprintf(`<li><a href="%s">../</a></li>`+"\n", parentDir)
+		html += `<li><a href="../">../</a></li>` + "\n"
 	}
 
 	// 统一处理不同类型的目录条目
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":          {Data: []byte("root index")},
+		"docs/index.htm":      {Data: []byte("docs htm")},
+		"docs/index.html":     {Data: []byte("docs html")},
+		"empty/.keep":         {Data: nil},
+		"app.js":              {Data: []byte("js")},
+		"404.html":            {Data: []byte("custom 404")},
+		"403.html":            {Data: []byte("custom 403")},
+		"nested/only.txt":     {Data: []byte("txt")},
+		"nested/deeper/a.css": {Data: []byte("css")},
+	}
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestFindIndexFile(t *testing.T) {
+	root := testFS()
+	defer func(old string) { *indexFiles = old }(*indexFiles)
+
+	tests := []struct {
+		index, dir, want string
+		ok               bool
+	}{
+		{"index.html,index.htm", "docs", "docs/index.html", true},
+		{"index.htm, index.html", "docs", "docs/index.htm", true},
+		{"index.html", ".", "index.html", true},
+		{"index.html,,", "empty", "", false},
+		// 目录不能作为索引文件
+		{"deeper", "nested", "", false},
+	}
+	for _, tt := range tests {
+		*indexFiles = tt.index
+		got, ok := findIndexFile(root, tt.dir)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("findIndexFile(%q) with -index=%q = %q, %v", tt.dir, tt.index, got, ok)
+		}
+	}
+}
+
+func TestEmbedFileHandler(t *testing.T) {
+	defer func(old bool) { *noListing = old }(*noListing)
+	h := createEmbedFileHandler(testFS())
+
+	tests := []struct {
+		path, body string
+		noListing  bool
+		code       int
+	}{
+		{"/", "root index", false, http.StatusOK},
+		{"/docs/", "docs html", false, http.StatusOK},
+		{"/app.js", "js", false, http.StatusOK},
+		{"/missing", "custom 404", false, http.StatusNotFound},
+		{"/nested/", `<a href="only.txt">`, false, http.StatusOK},
+		{"/nested/", "custom 403", true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		*noListing = tt.noListing
+		w := get(h, tt.path)
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("GET %s (no-listing %v) = %d %q", tt.path, tt.noListing, w.Code, w.Body)
+		}
+	}
+
+	if w := get(h, "/docs?a=1"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "docs/?a=1" {
+		t.Errorf("redirect = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get(h, "/app.js"); !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestServeErrorDefault(t *testing.T) {
+	// 没有自定义错误页面时使用纯文本
+	h := createEmbedFileHandler(fstest.MapFS{"a.txt": {Data: []byte("a")}})
+	if w := get(h, "/missing"); w.Code != http.StatusNotFound || strings.TrimSpace(w.Body.String()) != "Not Found" {
+		t.Errorf("GET /missing = %d %q", w.Code, w.Body)
+	}
+}
+
+func TestLocalFileHandler(t *testing.T) {
+	defer func(old bool) { *noListing = old }(*noListing)
+	dir := t.TempDir()
+	for name, data := range map[string]string{"index.htm": "local index", "404.html": "local 404", "sub/page.txt": "page"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := createLocalFileHandler(dir)
+
+	*noListing = true
+	if w := get(h, "/"); w.Code != http.StatusOK || w.Body.String() != "local index" {
+		t.Errorf("GET / = %d %q", w.Code, w.Body)
+	}
+	if w := get(h, "/nope.txt"); w.Code != http.StatusNotFound || w.Body.String() != "local 404" {
+		t.Errorf("GET /nope.txt = %d %q", w.Code, w.Body)
+	}
+	if w := get(h, "/sub/"); w.Code != http.StatusForbidden {
+		t.Errorf("GET /sub/ with -no-listing = %d", w.Code)
+	}
+}
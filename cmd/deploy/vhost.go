@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 虚拟主机配置
+//
+//	[
+//	  {"host": "docs.local", "root": "/srv/docs"},
+//	  {"host": "*.docs.local", "tag": "docs-preview", "mounts": {"/": "/srv/preview", "/api/": "/srv/api-ref"}},
+//	  {"host": "intranet", "default": true, "root": "embed"}
+//	]
+type virtualHost struct {
+	// 主机名，支持 *.example.com 形式的通配符
+	Host string `json:"host"`
+	// 未匹配到任何主机时使用
+	Default bool `json:"default,omitempty"`
+	// 本地目录，"embed" 表示使用嵌入的文件
+	Root string `json:"root,omitempty"`
+	// URL 前缀到目录的挂载表，与 Root 二选一
+	Mounts map[string]string `json:"mounts,omitempty"`
+	// 日志标签，默认为主机名
+	Tag string `json:"tag,omitempty"`
+
+	handler http.Handler
+}
+
+func loadVirtualHosts(file string) ([]*virtualHost, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*virtualHost
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return hosts, nil
+}
+
+// 按 Host 请求头分发到各虚拟主机，fallback 在没有默认主机时使用
+func newVirtualHostHandler(hosts []*virtualHost, embedRoot fs.FS, fallback http.Handler) (http.Handler, error) {
+	exact := make(map[string]*virtualHost)
+	var wildcards []*virtualHost
+	var defaultHost *virtualHost
+
+	for _, vh := range hosts {
+		vh.Host = strings.ToLower(strings.TrimSpace(vh.Host))
+		if vh.Tag == "" {
+			vh.Tag = vh.Host
+		}
+		if vh.Tag == "" {
+			vh.Tag = "default"
+		}
+
+		handler, err := vh.buildHandler(embedRoot)
+		if err != nil {
+			return nil, err
+		}
+		vh.handler = withAccessLog(vh.Tag, handler)
+
+		if vh.Default {
+			if defaultHost != nil {
+				return nil, fmt.Errorf("duplicate default virtual host: %q and %q", defaultHost.Tag, vh.Tag)
+			}
+			defaultHost = vh
+		}
+		switch {
+		case vh.Host == "":
+			if !vh.Default {
+				return nil, fmt.Errorf("virtual host without host name must be default")
+			}
+		case strings.HasPrefix(vh.Host, "*."):
+			wildcards = append(wildcards, vh)
+		default:
+			if _, ok := exact[vh.Host]; ok {
+				return nil, fmt.Errorf("duplicate virtual host %q", vh.Host)
+			}
+			exact[vh.Host] = vh
+		}
+	}
+
+	if defaultHost == nil {
+		defaultHost = &virtualHost{Host: "default", handler: withAccessLog("default", fallback)}
+	}
+
+	// 后缀越长越优先
+	sort.SliceStable(wildcards, func(i, j int) bool {
+		return len(wildcards[i].Host) > len(wildcards[j].Host)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(host, ".")
+
+		if vh, ok := exact[host]; ok {
+			vh.handler.ServeHTTP(w, r)
+			return
+		}
+		for _, vh := range wildcards {
+			if strings.HasSuffix(host, vh.Host[1:]) {
+				vh.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		defaultHost.handler.ServeHTTP(w, r)
+	}), nil
+}
+
+func (vh *virtualHost) buildHandler(embedRoot fs.FS) (http.Handler, error) {
+	if vh.Root != "" && len(vh.Mounts) > 0 {
+		return nil, fmt.Errorf("virtual host %q: root and mounts are mutually exclusive", vh.Host)
+	}
+	if vh.Root != "" {
+		return createRootHandler(vh.Root, embedRoot), nil
+	}
+	if len(vh.Mounts) == 0 {
+		return nil, fmt.Errorf("virtual host %q: root or mounts is required", vh.Host)
+	}
+
+	// 按前缀排序，出错时报告的挂载点是确定的
+	mounts := make([]string, 0, len(vh.Mounts))
+	for mount := range vh.Mounts {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+
+	// ServeMux 按最长前缀匹配，并自动把 /prefix 重定向到 /prefix/
+	mux := http.NewServeMux()
+	seen := make(map[string]string)
+	for _, mount := range mounts {
+		prefix := mount
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("virtual host %q: mount %q must start with /", vh.Host, mount)
+		}
+		// ServeMux 会把空白和花括号解析为方法或通配符，注册时直接 panic
+		if strings.ContainsAny(prefix, " \t{}") {
+			return nil, fmt.Errorf("virtual host %q: mount %q contains invalid characters", vh.Host, mount)
+		}
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		// /a 和 /a/ 是同一个挂载点
+		if other, ok := seen[prefix]; ok {
+			return nil, fmt.Errorf("virtual host %q: mounts %q and %q conflict", vh.Host, other, mount)
+		}
+		seen[prefix] = mount
+		handler := createRootHandler(vh.Mounts[mount], embedRoot)
+		mux.Handle(prefix, http.StripPrefix(strings.TrimSuffix(prefix, "/"), handler))
+	}
+	return mux, nil
+}
+
+func createRootHandler(root string, embedRoot fs.FS) http.Handler {
+	if root == "embed" {
+		return createEmbedFileHandler(embedRoot)
+	}
+	return createLocalFileHandler(root)
+}
+
+// 访问日志，每个虚拟主机使用独立的标签
+func withAccessLog(tag string, next http.Handler) http.Handler {
+	logger := log.New(os.Stdout, "["+tag+"] ", log.LstdFlags)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		logger.Printf("%s %s %s %d %s", r.RemoteAddr, r.Method, r.URL.RequestURI(), sw.status, time.Since(start))
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
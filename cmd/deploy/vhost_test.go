@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// 创建只包含 index.html 的目录，内容为 name
+func siteDir(t *testing.T, name string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(name), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestVirtualHostHandler(t *testing.T) {
+	embedRoot := fstest.MapFS{"index.html": {Data: []byte("embedded")}}
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fallback"))
+	})
+	hosts := []*virtualHost{
+		{Host: "Docs.Local", Root: siteDir(t, "docs")},
+		{Host: "*.docs.local", Mounts: map[string]string{"/": siteDir(t, "preview"), "/api": siteDir(t, "api")}},
+		{Host: "*.a.docs.local", Root: "embed"},
+	}
+	h, err := newVirtualHostHandler(hosts, embedRoot, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, path, body string
+	}{
+		{"docs.local", "/", "docs"},
+		{"DOCS.local:8080", "/", "docs"},
+		{"docs.local.", "/", "docs"},
+		{"pr-1.docs.local", "/", "preview"},
+		{"pr-1.docs.local", "/api/", "api"},
+		// 更长的通配符后缀优先
+		{"x.a.docs.local", "/", "embedded"},
+		{"other.local", "/", "fallback"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Body.String() != tt.body {
+			t.Errorf("%s%s = %d %q, want %q", tt.host, tt.path, w.Code, w.Body, tt.body)
+		}
+	}
+
+	// 挂载点不带 / 时重定向
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+	r.Host = "pr-1.docs.local"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code/100 != 3 || w.Header().Get("Location") != "/api/" {
+		t.Errorf("GET /api = %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestVirtualHostDefault(t *testing.T) {
+	hosts := []*virtualHost{
+		{Host: "docs.local", Root: siteDir(t, "docs")},
+		{Default: true, Root: siteDir(t, "default")},
+	}
+	h, err := newVirtualHostHandler(hosts, nil, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "unknown"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "default" {
+		t.Errorf("default host body = %q", w.Body)
+	}
+}
+
+func TestVirtualHostErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		hosts []*virtualHost
+		err   string
+	}{
+		{"duplicate host", []*virtualHost{{Host: "a", Root: dir}, {Host: "A", Root: dir}}, "duplicate virtual host"},
+		{"two defaults", []*virtualHost{{Host: "a", Root: dir, Default: true}, {Root: dir, Default: true}}, "duplicate default virtual host"},
+		{"no host name", []*virtualHost{{Root: dir}}, "must be default"},
+		{"root and mounts", []*virtualHost{{Host: "a", Root: dir, Mounts: map[string]string{"/": dir}}}, "mutually exclusive"},
+		{"no root", []*virtualHost{{Host: "a"}}, "root or mounts is required"},
+		{"relative mount", []*virtualHost{{Host: "a", Mounts: map[string]string{"a/": dir}}}, "must start with /"},
+		{"duplicate mount", []*virtualHost{{Host: "a", Mounts: map[string]string{"/a": dir, "/a/": dir}}}, `"/a" and "/a/" conflict`},
+		{"wildcard mount", []*virtualHost{{Host: "a", Mounts: map[string]string{"/{x}/": dir}}}, "invalid characters"},
+		{"space in mount", []*virtualHost{{Host: "a", Mounts: map[string]string{"/a b/": dir}}}, "invalid characters"},
+	}
+	for _, tt := range tests {
+		_, err := newVirtualHostHandler(tt.hosts, nil, http.NotFoundHandler())
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadVirtualHosts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "vhosts.json")
+	os.WriteFile(file, []byte(`[{"host": "docs.local", "root": "/srv/docs", "tag": "docs"}]`), 0o644)
+	hosts, err := loadVirtualHosts(file)
+	if err != nil || len(hosts) != 1 || hosts[0].Root != "/srv/docs" || hosts[0].Tag != "docs" {
+		t.Errorf("loadVirtualHosts = %+v, %v", hosts, err)
+	}
+	os.WriteFile(file, []byte(`{`), 0o644)
+	if _, err := loadVirtualHosts(file); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-mysti/collector"
+	"go-mysti/ingest"
+	"go-mysti/model"
+	"go-mysti/repository"
+
+	"github.com/spf13/cobra"
+)
+
+var collectCmd = &cobra.Command{
+	Use:   "collect",
+	Short: "Sample container stats from cgroup v2 and write them to container_stats",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loader.Load()
+		if err != nil {
+			return err
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		once, _ := cmd.Flags().GetBool("once")
+
+		c := &collector.Collector{
+			Stats:    collector.NewCgroupSource(cfg.Collector.CgroupRoot, cfg.Collector.ProcRoot),
+			Interval: cfg.Collector.Interval,
+		}
+		if cfg.Collector.DockerSocket != "" {
+			c.Names = collector.NewDockerSource(cfg.Collector.DockerSocket)
+		}
+
+		if dryRun {
+			c.Sink = jsonSink{w: cmd.OutOrStdout()}
+		} else {
+			db := initDb(cfg.Database)
+			defer db.Close()
+			repo := repository.NewMySQL(db)
+			defer repo.Close()
+
+			// 与 /api/ingest 使用同样的批量写入
+			batcher := ingest.NewBatcher(repo, ingest.Options{
+				BatchSize:     cfg.Ingest.BatchSize,
+				FlushInterval: cfg.Ingest.FlushInterval,
+				QueueSize:     cfg.Ingest.QueueSize,
+			})
+			go batcher.Run()
+			defer batcher.Close()
+			c.Sink = batcher
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		if once {
+			// CPU 使用率需要两次采样
+			if err := c.CollectOnce(ctx, time.Now()); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(c.Interval):
+			}
+			return c.CollectOnce(ctx, time.Now())
+		}
+
+		log.Printf("Collecting container stats from %s every %s", cfg.Collector.CgroupRoot, cfg.Collector.Interval)
+		return c.Run(ctx)
+	},
+}
+
+func init() {
+	collectCmd.Flags().Bool("dry-run", false, "print samples as NDJSON instead of writing to the database")
+	collectCmd.Flags().Bool("once", false, "take a single sample (two readings one interval apart) and exit")
+	rootCmd.AddCommand(collectCmd)
+}
+
+// 以 NDJSON 输出采集结果
+type jsonSink struct {
+	w io.Writer
+}
+
+func (s jsonSink) Enqueue(rows []model.ContainerStat) error {
+	encoder := json.NewEncoder(s.w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
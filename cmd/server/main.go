@@ -1,89 +1,244 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
 	mysti "go-mysti"
+	"go-mysti/audit"
+	"go-mysti/config"
 	"go-mysti/controllers"
+	"go-mysti/health"
+	"go-mysti/ingest"
+	"go-mysti/jwtauth"
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
+	"go-mysti/repository"
+	"go-mysti/retention"
+	"go-mysti/serve"
+	"go-mysti/session"
 	"html/template"
 	"io/fs"
+	"log"
 	"net/http"
+	"os"
 	"path"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/cobra"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
-func initDb() *sql.DB {
-	db, err := sql.Open("mysql", "root:PassW0rd@tcp(localhost:3306)/mysti")
+var loader config.Loader
+
+var rootCmd = &cobra.Command{
+	Use:           "server",
+	Short:         "Run the mysti web server",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loader.Load()
+		if err != nil {
+			return err
+		}
+		return runServer(cfg)
+	},
+}
+
+func init() {
+	loader.BindFlags(rootCmd.PersistentFlags())
+}
+
+func initDb(cfg config.DatabaseConfig) *sql.DB {
+	dsn, err := mysql.ParseDSN(cfg.DSN)
+	if err != nil {
+		panic(err)
+	}
+	// DATETIME 列需要扫描为 time.Time，并统一使用 UTC，保证 UNIX_TIMESTAMP 分桶正确
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+	if dsn.Params == nil {
+		dsn.Params = map[string]string{}
+	}
+	dsn.Params["time_zone"] = "'+00:00'"
+
+	db, err := sql.Open("mysql", dsn.FormatDSN())
 	if err != nil {
 		panic(err)
 	}
 	// See "Important settings" section.
-	db.SetConnMaxLifetime(time.Minute * 3)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
 
 	return db
 }
 
-func testQuery() {
-	db := initDb()
-	defer db.Close()
+// Addr 为空时返回 nil
+func initRedis(cfg config.RedisConfig) *redis.Client {
+	if cfg.Addr == "" {
+		return nil
+	}
+	opts := &redis.Options{Addr: cfg.Addr, Password: cfg.Password, DB: cfg.DB}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{}
+	}
+	return redis.NewClient(opts)
+}
 
-	row, err := db.Query("select container_id, container_name from container_stats group by container_id, container_name")
-	if err != nil {
-		panic(err)
+// 没有配置密钥时随机生成，进程重启后已有会话失效；
+// 配置了 Redis 时注销记录保存在 Redis 中，多个实例共享
+func newSessionManager(cfg config.AuthConfig, rdb *redis.Client) *session.Manager {
+	secret := []byte(cfg.SessionSecret)
+	if len(secret) == 0 {
+		log.Println("auth.session_secret is not set, using a random key; sessions will not survive a restart")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	opts := session.Options{
+		Secret:     secret,
+		CookieName: cfg.CookieName,
+		TTL:        cfg.SessionTTL,
+		Secure:     cfg.SecureCookie,
+	}
+	if rdb != nil {
+		opts.Revocations = session.NewRedisRevocations(rdb)
 	}
-	defer row.Close()
+	return session.NewManager(opts)
+}
 
-	containerIds := make([]string, 30)
-	for row.Next() {
-		var containerId string
-		var containerName string
-		err = row.Scan(&containerId, &containerName)
+func newTokenVerifier(cfg config.JWTConfig) (*jwtauth.Verifier, error) {
+	var static []jwtauth.Key
+	for _, file := range cfg.KeyFiles {
+		key, err := jwtauth.LoadPEMKey(file)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		containerIds = append(containerIds, containerId)
-		fmt.Println("container_id:", containerId)
+		static = append(static, key)
+	}
+	if cfg.HMACSecret != "" {
+		static = append(static, jwtauth.Key{Key: []byte(cfg.HMACSecret)})
 	}
 
-	// Prepare statement for reading data
-	stmtOut, err := db.Prepare("SELECT __time, container_id FROM container_stats WHERE container_id = ?")
-	if err != nil {
-		panic(err.Error()) // proper error handling instead of panic in your app
+	sources := []jwtauth.KeySource{jwtauth.StaticKeys(static...)}
+	if cfg.JWKSFile != "" {
+		sources = append(sources, jwtauth.JWKSFile(cfg.JWKSFile))
+	}
+	if cfg.JWKSURL != "" {
+		sources = append(sources, jwtauth.JWKSURL(cfg.JWKSURL, nil, cfg.JWKSRefresh))
 	}
-	defer stmtOut.Close()
-	row, err = stmtOut.Query("79cc29057c82b4f705b7dd0022bc95dc63ea60d92e21543985d1fc4b621967d4")
+	return jwtauth.NewVerifier(jwtauth.Options{
+		Keys:      jwtauth.MultiSource(sources...),
+		Issuer:    cfg.Issuer,
+		Audiences: cfg.Audiences,
+		Leeway:    cfg.Leeway,
+	}), nil
+}
+
+func loadKubeClusters(cfg config.KubernetesConfig) (kube.Clusters, error) {
+	clusters, err := kube.LoadClusters(kube.Options{
+		Name:       cfg.Name,
+		InCluster:  cfg.InCluster,
+		APIServer:  cfg.APIServer,
+		TokenFile:  cfg.TokenFile,
+		CACertFile: cfg.CACertFile,
+		Kubeconfig: cfg.Kubeconfig,
+		Contexts:   cfg.Contexts,
+	})
 	if err != nil {
-		panic(err.Error())
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		log.Println("no kubernetes cluster configured, /kube is disabled")
+	}
+	return clusters, nil
+}
+
+// 没有配置策略文件时只允许 admin 角色访问 /kube
+func loadKubePolicy(cfg config.KubernetesConfig) (*kubeauth.Policy, error) {
+	if cfg.PolicyFile == "" {
+		log.Println("kubernetes.policy_file is not set, only the admin role can use /kube")
+		return kubeauth.DefaultPolicy(), nil
 	}
+	return kubeauth.LoadPolicy(cfg.PolicyFile)
+}
 
-	for row.Next() {
-		var timestamp string
-		var containerId string
-		err = row.Scan(&timestamp, &containerId)
+// 审计日志写入数据库和文件，返回的 Recorder 为 nil 表示不记录；close 写完缓冲区中的记录
+func newAuditRecorder(cfg config.AuditConfig, repo repository.Audit) (audit.Recorder, func(), error) {
+	opts := audit.Options{QueueSize: cfg.QueueSize, FlushInterval: cfg.FlushInterval}
+	var recorders audit.Multi
+	var closers []func()
+	if cfg.Database {
+		l := audit.NewLogger("database", repo, opts)
+		go l.Run()
+		recorders = append(recorders, l)
+		closers = append(closers, l.Close)
+	}
+	if cfg.File != "" {
+		file, err := audit.OpenFile(cfg.File)
 		if err != nil {
-			panic(err.Error())
+			return nil, nil, err
+		}
+		l := audit.NewLogger("file", file, opts)
+		go l.Run()
+		recorders = append(recorders, l)
+		closers = append(closers, l.Close, func() { file.Close() })
+	}
+	closeAll := func() {
+		for _, c := range closers {
+			c()
 		}
-		fmt.Println("container_id:", containerId)
 	}
+	if len(recorders) == 0 {
+		log.Println("audit.database and audit.file are not set, /kube requests are not audited")
+		return nil, closeAll, nil
+	}
+	return recorders, closeAll, nil
+}
+
+// 创建 gin 引擎并安装全局中间件
+//
+// gin 默认信任所有代理，任何客户端都可以用 X-Forwarded-For 伪造审计日志中的地址，
+// 这里只信任配置的代理。
+func newEngine(cfg config.ServerConfig) (*gin.Engine, error) {
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("server.trusted_proxies: %w", err)
+	}
+	engine.Use(middleware.RequestID(), middleware.Logger(), middleware.Recovery())
+	return engine, nil
 }
 
 func main() {
-	db := initDb()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runServer(cfg *config.Config) error {
+	db := initDb(cfg.Database)
 	defer db.Close()
-	ginEngine := gin.Default()
-	ginEngine.SetFuncMap(template.FuncMap{
-		"formatAsDate": func(t time.Time) string {
-			return t.Format("02/01/2006")
-		},
-	})
+	repo := repository.NewMySQL(db)
+	defer repo.Close()
+
+	if cfg.Database.AutoMigrate {
+		if err := migrateUp(context.Background(), db, 0); err != nil {
+			return err
+		}
+	}
+	ginEngine, err := newEngine(cfg.Server)
+	if err != nil {
+		return err
+	}
 	// 设置模板引擎
-	tmpl := template.Must(mysti.BuildTemplate("assets/templates"))
+	tmpl := template.Must(mysti.BuildTemplate("assets/templates", controllers.TemplateFuncs()))
 	ginEngine.SetHTMLTemplate(tmpl)
 
 	// 设置静态文件服务，主要用于返回css,js文件，html文件只能返回/static/index.html
@@ -91,10 +246,82 @@ func main() {
 	assetFS := http.FS(mysti.GetAssetFS("assets/static"))
 	ginEngine.StaticFS("/static", assetFS)
 
-	controllers.RegisterRoutes(db, ginEngine.Group("/"))
-	controllers.RegisterKubeRoutes(ginEngine.Group("/kube"))
+	// 写入队列，关闭服务器后写完缓冲区中的数据
+	batcher := ingest.NewBatcher(repo, ingest.Options{
+		BatchSize:     cfg.Ingest.BatchSize,
+		FlushInterval: cfg.Ingest.FlushInterval,
+		QueueSize:     cfg.Ingest.QueueSize,
+	})
+	go batcher.Run()
+	defer batcher.Close()
+
+	// 汇总和清理任务
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if cfg.Retention.Enabled {
+		go retention.NewJob(db, cfg.Retention).Run(jobCtx)
+	}
+
+	// 就绪检查
+	checks := []health.Check{health.SQL("mysql", db)}
+	rdb := initRedis(cfg.Redis)
+	if rdb != nil {
+		defer rdb.Close()
+		checks = append(checks, health.Redis(rdb))
+	}
+	// /kube 代理和就绪检查共用连接池，就绪检查只检查默认集群，其他集群不可用时不影响本服务
+	clusters, err := loadKubeClusters(cfg.Kubernetes)
+	if err != nil {
+		return err
+	}
+	defer clusters.CloseIdleConnections()
+	if cfg.Health.Kubernetes && len(clusters) > 0 {
+		checks = append(checks, health.Kubernetes(clusters[0].Server.String(), clusters[0].Transport))
+	}
+	checker := health.NewChecker(cfg.Health.Timeout, cfg.Health.CacheTTL, checks...)
+
+	kubePolicy, err := loadKubePolicy(cfg.Kubernetes)
+	if err != nil {
+		return err
+	}
+	kubeRestrictions, err := cfg.Kubernetes.Restrictions()
+	if err != nil {
+		return err
+	}
+	auditRecorder, closeAudit, err := newAuditRecorder(cfg.Audit, repo)
+	if err != nil {
+		return err
+	}
+	defer closeAudit()
+
+	// 登录会话，除健康检查、登录页和静态文件外都需要登录
+	authenticate := middleware.Authenticate(newSessionManager(cfg.Auth, rdb), repo)
+	pages := ginEngine.Group("/", middleware.HTMLErrors("error/error.html"), authenticate)
+	api := ginEngine.Group("/", middleware.ProblemErrors(), authenticate)
+	// API 还可以使用 bearer token，供 CI 和脚本调用
+	if cfg.JWT.Enabled() {
+		verifier, err := newTokenVerifier(cfg.JWT)
+		if err != nil {
+			return err
+		}
+		mapping := jwtauth.ClaimMapping{UsernameClaim: cfg.JWT.UsernameClaim, RolesClaim: cfg.JWT.RolesClaim}
+		api.Use(middleware.BearerAuth(verifier, mapping))
+	}
+	api.Use(middleware.RequireAuth(""), middleware.VerifyCSRF())
+
+	controllers.RegisterHealthRoutes(checker, ginEngine.Group("/"))
+	controllers.RegisterAuthRoutes(repo, pages)
+	loggedIn := pages.Group("/", middleware.RequireAuth("/login"))
+	controllers.RegisterRoutes(repo, cfg.Retention, loggedIn)
+	controllers.RegisterKubeBrowserRoutes(clusters, kubePolicy, kubeRestrictions, auditRecorder, loggedIn)
+	controllers.RegisterTerminalRoutes(clusters, loggedIn)
+	controllers.RegisterContainerRoutes(repo, cfg.Retention, api.Group("/api/containers"))
+	controllers.RegisterIngestRoutes(batcher, cfg.Ingest, api.Group("/api/ingest"))
+	controllers.RegisterKubeRoutes(clusters, kubePolicy, kubeRestrictions, auditRecorder, api.Group("/kube"))
+	controllers.RegisterAuditRoutes(repo, api.Group("/api/kube/audit"), loggedIn)
 
-	ginEngine.Run(":8080")
+	server := &http.Server{Handler: ginEngine}
+	return serve.Run(server, serve.Options{Addr: cfg.Server.Listen, DrainTimeout: cfg.Server.DrainTimeout})
 }
 
 func readFileFS(fsys fs.FS) func(string) (string, []byte, error) {
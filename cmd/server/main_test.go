@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-mysti/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewEngineTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		proxies []string
+		header  string
+		want    string
+	}{
+		{"spoofed X-Forwarded-For", nil, "X-Forwarded-For", "192.0.2.10"},
+		{"spoofed X-Real-IP", nil, "X-Real-IP", "192.0.2.10"},
+		{"untrusted proxy", []string{"198.51.100.0/24"}, "X-Forwarded-For", "192.0.2.10"},
+		{"trusted proxy", []string{"192.0.2.0/24"}, "X-Forwarded-For", "203.0.113.7"},
+		{"trusted proxy IP", []string{"192.0.2.10"}, "X-Forwarded-For", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := newEngine(config.ServerConfig{TrustedProxies: tt.proxies})
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine.GET("/ip", func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, ctx.ClientIP())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = "192.0.2.10:41000"
+			req.Header.Set(tt.header, "203.0.113.7")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := newEngine(config.ServerConfig{TrustedProxies: []string{"proxy.local"}}); err == nil {
+		t.Error("newEngine() accepted an invalid proxy")
+	}
+}
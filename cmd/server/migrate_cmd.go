@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	mysti "go-mysti"
+	"go-mysti/migrate"
+	"log"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema migrations",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		return withMigrator(func(m *migrate.Migrator) error {
+			done, err := m.Up(cmd.Context(), steps)
+			for _, migration := range done {
+				fmt.Fprintf(cmd.OutOrStdout(), "applied %04d_%s\n", migration.Version, migration.Name)
+			}
+			if err == nil && len(done) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "no pending migrations")
+			}
+			return err
+		})
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back applied migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		return withMigrator(func(m *migrate.Migrator) error {
+			done, err := m.Down(cmd.Context(), steps)
+			for _, migration := range done {
+				fmt.Fprintf(cmd.OutOrStdout(), "rolled back %04d_%s\n", migration.Version, migration.Name)
+			}
+			return err
+		})
+	},
+}
+
+var migrateBaselineCmd = &cobra.Command{
+	Use:   "baseline VERSION",
+	Short: "Mark migrations up to VERSION as applied without running them",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return withMigrator(func(m *migrate.Migrator) error {
+			done, err := m.Baseline(cmd.Context(), version)
+			for _, migration := range done {
+				fmt.Fprintf(cmd.OutOrStdout(), "marked %04d_%s as applied\n", migration.Version, migration.Name)
+			}
+			return err
+		})
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(m *migrate.Migrator) error {
+			statuses, unknown, err := m.Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+			for _, s := range statuses {
+				status, appliedAt := "pending", ""
+				if s.Applied {
+					status, appliedAt = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+			}
+			for _, version := range unknown {
+				fmt.Fprintf(w, "%04d\t?\tapplied, file missing\t\n", version)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var migrateCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a new pair of up/down migration files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		files, err := migrate.Create(dir, args[0])
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			fmt.Fprintln(cmd.OutOrStdout(), "created", file)
+		}
+		return nil
+	},
+}
+
+func init() {
+	migrateUpCmd.Flags().Int("steps", 0, "number of migrations to apply, 0 applies all")
+	migrateDownCmd.Flags().Int("steps", 1, "number of migrations to roll back, 0 rolls back all")
+	migrateCreateCmd.Flags().String("dir", "assets/migrations", "migrations source directory")
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateBaselineCmd, migrateStatusCmd, migrateCreateCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, mysti.GetAssetFS("assets/migrations"))
+}
+
+func withMigrator(fn func(m *migrate.Migrator) error) error {
+	cfg, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	db := initDb(cfg.Database)
+	defer db.Close()
+
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	return fn(m)
+}
+
+// 启动时自动迁移
+func migrateUp(ctx context.Context, db *sql.DB, steps int) error {
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	done, err := m.Up(ctx, steps)
+	for _, migration := range done {
+		log.Printf("applied migration %04d_%s", migration.Version, migration.Name)
+	}
+	return err
+}
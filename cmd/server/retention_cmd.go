@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"go-mysti/retention"
+
+	"github.com/spf13/cobra"
+)
+
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Roll up and prune container stats",
+}
+
+var retentionRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run rollup and retention jobs once, e.g. from cron",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loader.Load()
+		if err != nil {
+			return err
+		}
+		db := initDb(cfg.Database)
+		defer db.Close()
+
+		return retention.NewJob(db, cfg.Retention).RunOnce(cmd.Context(), time.Now().UTC())
+	},
+}
+
+func init() {
+	retentionCmd.AddCommand(retentionRunCmd)
+	rootCmd.AddCommand(retentionCmd)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-mysti/model"
+	"go-mysti/repository"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage login users",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add USERNAME",
+	Short: "Create a user, the password is read from the terminal or stdin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		roles, _ := cmd.Flags().GetStringSlice("role")
+		username := strings.TrimSpace(args[0])
+		if username == "" || len(username) > 64 {
+			return fmt.Errorf("username must be 1 to 64 characters")
+		}
+
+		password, err := readPassword(cmd)
+		if err != nil {
+			return err
+		}
+		if len(password) < 8 {
+			return fmt.Errorf("password must be at least 8 characters")
+		}
+		// bcrypt 只使用前 72 字节
+		if len(password) > 72 {
+			return fmt.Errorf("password must be at most 72 bytes")
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loader.Load()
+		if err != nil {
+			return err
+		}
+		db := initDb(cfg.Database)
+		defer db.Close()
+		repo := repository.NewMySQL(db)
+		defer repo.Close()
+
+		user := &model.User{Username: username, PasswordHash: string(hash), Roles: roles}
+		if err := repo.CreateUser(cmd.Context(), user); err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
+				return fmt.Errorf("user %q already exists", username)
+			}
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Created user %s (id %d)\n", user.Username, user.ID)
+		return nil
+	},
+}
+
+// 终端中不回显并要求确认，否则从 stdin 读取一行，便于脚本使用
+func readPassword(cmd *cobra.Command) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "Confirm password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(confirm) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(password), nil
+}
+
+func init() {
+	userAddCmd.Flags().StringSlice("role", nil, "role granted to the user, may be repeated")
+	userCmd.AddCommand(userAddCmd)
+	rootCmd.AddCommand(userCmd)
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-mysti/model"
+)
+
+// 匹配 docker、containerd、cri-o、podman 创建的容器 cgroup 目录
+var containerCgroupPattern = regexp.MustCompile(`^(?:docker-|cri-containerd-|crio-|libpod-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+// CgroupSource 从 cgroup v2 文件中读取容器的资源使用情况
+type CgroupSource struct {
+	// cgroup v2 挂载点，通常为 /sys/fs/cgroup
+	Root string
+	// 用于读取容器网络统计的 proc 目录，为空时不采集网络数据
+	ProcRoot string
+
+	mu   sync.Mutex
+	prev map[string]cpuSample
+}
+
+// 上一次采样的 CPU 累计用量，用于计算使用率
+type cpuSample struct {
+	usageUsec uint64
+	at        time.Time
+}
+
+func NewCgroupSource(root, procRoot string) *CgroupSource {
+	return &CgroupSource{Root: root, ProcRoot: procRoot, prev: make(map[string]cpuSample)}
+}
+
+// Sample 采集所有容器，CPU 使用率需要两次采样，所以新出现的容器从第二次采样开始输出
+func (s *CgroupSource) Sample(ctx context.Context, now time.Time) ([]model.ContainerStat, error) {
+	dirs, err := s.containerDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rows []model.ContainerStat
+	seen := make(map[string]bool, len(dirs))
+	for id, dir := range dirs {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		seen[id] = true
+
+		usage, err := readKeyValue(filepath.Join(dir, "cpu.stat"), "usage_usec")
+		if err != nil {
+			// 容器可能已经退出
+			continue
+		}
+		prev, ok := s.prev[id]
+		s.prev[id] = cpuSample{usageUsec: usage, at: now}
+		if !ok || !now.After(prev.at) || usage < prev.usageUsec {
+			continue
+		}
+
+		row := model.ContainerStat{Time: now.UTC(), ContainerID: id}
+		elapsed := now.Sub(prev.at).Microseconds()
+		row.CPUPercent = float64(usage-prev.usageUsec) / float64(elapsed) * 100
+
+		row.MemUsage, _ = readUint(filepath.Join(dir, "memory.current"))
+		// memory.max 为 "max" 时表示不限制
+		row.MemLimit, _ = readUint(filepath.Join(dir, "memory.max"))
+		if row.MemLimit > 0 {
+			row.MemPercent = float64(row.MemUsage) / float64(row.MemLimit) * 100
+		}
+		row.BlockReadBytes, row.BlockWriteBytes = readIOStat(filepath.Join(dir, "io.stat"))
+		row.PIDs, _ = readUint(filepath.Join(dir, "pids.current"))
+		if s.ProcRoot != "" {
+			row.NetRxBytes, row.NetTxBytes = s.readNetDev(dir)
+		}
+		rows = append(rows, row)
+	}
+
+	for id := range s.prev {
+		if !seen[id] {
+			delete(s.prev, id)
+		}
+	}
+	return rows, nil
+}
+
+// 遍历 cgroup 树，找出容器对应的目录
+func (s *CgroupSource) containerDirs() (map[string]string, error) {
+	dirs := make(map[string]string)
+	err := filepath.WalkDir(s.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 容器退出时目录可能在遍历过程中被删除
+			if path != s.Root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if m := containerCgroupPattern.FindStringSubmatch(d.Name()); m != nil {
+			dirs[m[1]] = path
+			// 容器内部的子 cgroup 不再遍历
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// 读取容器中第一个进程的网络统计，忽略 lo
+func (s *CgroupSource) readNetDev(dir string) (rx, tx uint64) {
+	procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return 0, 0
+	}
+	pid, _, _ := strings.Cut(strings.TrimSpace(string(procs)), "\n")
+	if pid == "" {
+		return 0, 0
+	}
+	data, err := os.ReadFile(filepath.Join(s.ProcRoot, pid, "net", "dev"))
+	if err != nil {
+		return 0, 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		iface, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx
+}
+
+func readUint(file string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// 读取 "key value" 格式文件中的一项，例如 cpu.stat
+func readKeyValue(file, key string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), " ")
+		if ok && k == key {
+			return strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return 0, os.ErrNotExist
+}
+
+// io.stat 每行对应一个设备：8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0
+func readIOStat(file string) (read, write uint64) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0
+	}
+	for _, field := range strings.Fields(string(data)) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseUint(v, 10, 64)
+		switch k {
+		case "rbytes":
+			read += n
+		case "wbytes":
+			write += n
+		}
+	}
+	return read, write
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testContainerID = "79cc29057c82b4f705b7dd0022bc95dc63ea60d92e21543985d1fc4b621967d4"
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCgroupSourceSample(t *testing.T) {
+	root := t.TempDir()
+	procRoot := t.TempDir()
+	dir := filepath.Join(root, "system.slice", "docker-"+testContainerID+".scope")
+
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat":       "usage_usec 1000000\nuser_usec 600000\nsystem_usec 400000\n",
+		"memory.current": "268435456\n",
+		"memory.max":     "1073741824\n",
+		"io.stat":        "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0\n8:16 rbytes=1 wbytes=2 rios=1 wios=1 dbytes=0 dios=0\n",
+		"pids.current":   "7\n",
+		"cgroup.procs":   "4242\n4243\n",
+	})
+	// 非容器目录应被忽略
+	writeFiles(t, filepath.Join(root, "system.slice", "sshd.service"), map[string]string{
+		"cpu.stat": "usage_usec 5\n",
+	})
+	writeFiles(t, filepath.Join(procRoot, "4242", "net"), map[string]string{
+		"dev": strings.Join([]string{
+			"Inter-|   Receive                                                |  Transmit",
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed",
+			"    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0",
+			"  eth0:    5000      10    0    0    0     0          0         0     3000       8    0    0    0     0       0          0",
+		}, "\n"),
+	})
+
+	source := NewCgroupSource(root, procRoot)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows, err := source.Sample(context.Background(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Fatalf("first sample should not emit rows without a CPU baseline, got %d", len(rows))
+	}
+
+	// 1 秒内使用了 0.5 秒 CPU
+	writeFiles(t, dir, map[string]string{"cpu.stat": "usage_usec 1500000\n"})
+	rows, err = source.Sample(context.Background(), start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+
+	row := rows[0]
+	if row.ContainerID != testContainerID {
+		t.Errorf("container id = %q", row.ContainerID)
+	}
+	if row.CPUPercent != 50 {
+		t.Errorf("cpu_percent = %v, want 50", row.CPUPercent)
+	}
+	if row.MemUsage != 256<<20 || row.MemLimit != 1<<30 || row.MemPercent != 25 {
+		t.Errorf("memory = %d/%d (%v%%)", row.MemUsage, row.MemLimit, row.MemPercent)
+	}
+	if row.BlockReadBytes != 1025 || row.BlockWriteBytes != 2050 {
+		t.Errorf("block io = %d/%d", row.BlockReadBytes, row.BlockWriteBytes)
+	}
+	if row.NetRxBytes != 5000 || row.NetTxBytes != 3000 {
+		t.Errorf("net = %d/%d", row.NetRxBytes, row.NetTxBytes)
+	}
+	if row.PIDs != 7 {
+		t.Errorf("pids = %d", row.PIDs)
+	}
+}
+
+func TestCgroupSourceUnlimitedMemory(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docker", testContainerID)
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat":       "usage_usec 0\n",
+		"memory.current": "1024\n",
+		"memory.max":     "max\n",
+	})
+
+	source := NewCgroupSource(root, "")
+	start := time.Now()
+	if _, err := source.Sample(context.Background(), start); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := source.Sample(context.Background(), start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	if rows[0].MemLimit != 0 || rows[0].MemPercent != 0 || rows[0].MemUsage != 1024 {
+		t.Errorf("memory = %d/%d (%v%%)", rows[0].MemUsage, rows[0].MemLimit, rows[0].MemPercent)
+	}
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-mysti/ingest"
+	"go-mysti/model"
+)
+
+// StatsSource 采集容器的资源使用情况
+type StatsSource interface {
+	Sample(ctx context.Context, now time.Time) ([]model.ContainerStat, error)
+}
+
+// NameSource 提供容器 ID 到名称的映射
+type NameSource interface {
+	ContainerNames(ctx context.Context) (map[string]string, error)
+}
+
+// Sink 接收采集结果，通常是 ingest.Batcher
+type Sink interface {
+	Enqueue(rows []model.ContainerStat) error
+}
+
+type Collector struct {
+	Stats    StatsSource
+	Names    NameSource
+	Sink     Sink
+	Interval time.Duration
+}
+
+// Run 按间隔采集，直到 ctx 结束
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.CollectOnce(ctx, time.Now()); err != nil {
+			log.Printf("collector: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectOnce 采集一次并写入 Sink
+func (c *Collector) CollectOnce(ctx context.Context, now time.Time) error {
+	rows, err := c.Stats.Sample(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	if c.Names != nil {
+		names, err := c.Names.ContainerNames(ctx)
+		if err != nil {
+			// 名称不可用时仍然写入数据
+			log.Printf("collector: container names: %v", err)
+		}
+		for i := range rows {
+			if name, ok := names[rows[i].ContainerID]; ok {
+				rows[i].ContainerName = name
+			}
+		}
+	}
+
+	valid := rows[:0]
+	for _, row := range rows {
+		if err := ingest.Validate(&row, now); err != nil {
+			log.Printf("collector: skip %s: %v", row.ContainerID, err)
+			continue
+		}
+		valid = append(valid, row)
+	}
+	return c.Sink.Enqueue(valid)
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DockerSource 通过 Unix 套接字调用 Docker Engine API 获取容器名称
+type DockerSource struct {
+	client *http.Client
+}
+
+func NewDockerSource(socket string) *DockerSource {
+	return &DockerSource{
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// ContainerNames 返回正在运行的容器 ID 到名称的映射
+func (s *DockerSource) ContainerNames(ctx context.Context) (map[string]string, error) {
+	// 主机名不会被使用，连接总是发往套接字
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker API: %s", resp.Status)
+	}
+
+	var containers []struct {
+		ID    string   `json:"Id"`
+		Names []string `json:"Names"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("docker API: %w", err)
+	}
+
+	names := make(map[string]string, len(containers))
+	for _, c := range containers {
+		if len(c.Names) > 0 {
+			names[c.ID] = strings.TrimPrefix(c.Names[0], "/")
+		}
+	}
+	return names, nil
+}
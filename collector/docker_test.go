@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-mysti/model"
+)
+
+// 在临时目录中启动一个模拟 Docker Engine API 的 Unix 套接字服务
+func startDockerStub(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = ln
+	server.Start()
+	t.Cleanup(server.Close)
+	return socket
+}
+
+func TestDockerSourceContainerNames(t *testing.T) {
+	socket := startDockerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"Id":"` + testContainerID + `","Names":["/web"]},{"Id":"abc","Names":[]}]`))
+	})
+
+	names, err := NewDockerSource(socket).ContainerNames(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names[testContainerID] != "web" {
+		t.Errorf("name = %q, want web", names[testContainerID])
+	}
+	if _, ok := names["abc"]; ok {
+		t.Errorf("container without names should be skipped")
+	}
+}
+
+func TestDockerSourceError(t *testing.T) {
+	socket := startDockerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	if _, err := NewDockerSource(socket).ContainerNames(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+type stubStats []model.ContainerStat
+
+func (s stubStats) Sample(ctx context.Context, now time.Time) ([]model.ContainerStat, error) {
+	return s, nil
+}
+
+type recordingSink struct {
+	rows []model.ContainerStat
+}
+
+func (s *recordingSink) Enqueue(rows []model.ContainerStat) error {
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func TestCollectorAddsNames(t *testing.T) {
+	socket := startDockerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Id":"` + testContainerID + `","Names":["/web"]}]`))
+	})
+
+	now := time.Now()
+	sink := &recordingSink{}
+	c := &Collector{
+		Stats: stubStats{
+			{Time: now, ContainerID: testContainerID, CPUPercent: 1},
+			{Time: now, ContainerID: "", CPUPercent: 1},
+		},
+		Names: NewDockerSource(socket),
+		Sink:  sink,
+	}
+	if err := c.CollectOnce(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.rows) != 1 {
+		t.Fatalf("expected invalid rows to be dropped, got %d rows", len(sink.rows))
+	}
+	if sink.rows[0].ContainerName != "web" {
+		t.Errorf("name = %q, want web", sink.rows[0].ContainerName)
+	}
+}
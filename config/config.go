@@ -0,0 +1,377 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Config 是 cmd/server 的配置，按 默认值 -> YAML 文件 -> MYSTI_* 环境变量 -> 命令行参数 的顺序加载
+//
+// yaml 标签同时决定了环境变量和命令行参数的名称，例如 database.dsn 对应 MYSTI_DATABASE_DSN 和 --database.dsn。
+// secret 标签标记的字段在打印时会被隐藏。
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+	Ingest     IngestConfig     `yaml:"ingest"`
+	Collector  CollectorConfig  `yaml:"collector"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Health     HealthConfig     `yaml:"health"`
+	Auth       AuthConfig       `yaml:"auth"`
+	JWT        JWTConfig        `yaml:"jwt"`
+	Audit      AuditConfig      `yaml:"audit"`
+}
+
+type ServerConfig struct {
+	// 监听地址，支持 host:port、unix:/path、systemd:[name]
+	Listen string `yaml:"listen" usage:"listen address (host:port, unix:/path, systemd:[name])"`
+	// 优雅关闭时等待进行中请求的时间
+	DrainTimeout time.Duration `yaml:"drain_timeout" usage:"time to wait for in-flight requests on shutdown"`
+	// 可信的反向代理，只有来自这些地址的请求才使用 X-Forwarded-For 作为客户端地址，为空表示不信任任何代理
+	TrustedProxies []string `yaml:"trusted_proxies" usage:"IPs or CIDRs of reverse proxies whose X-Forwarded-For is trusted, empty trusts none"`
+}
+
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn" secret:"dsn" usage:"MySQL data source name"`
+	MaxOpenConns    int           `yaml:"max_open_conns" usage:"maximum number of open connections"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" usage:"maximum number of idle connections"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" usage:"maximum amount of time a connection may be reused"`
+	// 启动时自动执行未应用的迁移
+	AutoMigrate bool `yaml:"auto_migrate" usage:"apply pending migrations on server start"`
+}
+
+// KubernetesConfig 描述 /kube 代理可以访问的集群
+//
+// 本地集群使用 in_cluster 或 api_server、token_file、ca_cert_file，kubeconfig 中的 context 作为其他集群。
+type KubernetesConfig struct {
+	// 本地集群的名称，通过 /kube/{name}/ 访问
+	Name      string `yaml:"name" usage:"name of the cluster configured by in_cluster or api_server"`
+	InCluster bool   `yaml:"in_cluster" usage:"use the in-cluster config (KUBERNETES_SERVICE_HOST) instead of api_server"`
+	// 为空且未使用 in_cluster 时没有本地集群
+	APIServer  string `yaml:"api_server" usage:"Kubernetes API server URL, empty disables the local cluster"`
+	TokenFile  string `yaml:"token_file" usage:"service account token file"`
+	CACertFile string `yaml:"ca_cert_file" usage:"Kubernetes CA certificate file"`
+	Kubeconfig string `yaml:"kubeconfig" usage:"kubeconfig file whose contexts are added as clusters named after the context"`
+	// 为空时使用 kubeconfig 中的全部 context
+	Contexts []string `yaml:"contexts" usage:"kubeconfig contexts to add, empty adds all"`
+	// /kube 代理的访问策略，为空时只允许 admin 角色
+	PolicyFile string `yaml:"policy_file" usage:"YAML file with access rules for the /kube proxy, empty allows only the admin role"`
+	// 以下限制对所有用户生效，在 policy_file 之前检查，同时作用于资源浏览页面
+	ReadOnly bool `yaml:"read_only" usage:"only allow get, list and watch requests through the /kube proxy"`
+	// * 匹配一个路径段，** 匹配任意多段，模式同时匹配下级路径；
+	// 集群范围的资源路径覆盖所有 namespace，例如 /api/v1/secrets 也匹配 /api/v1/namespaces/default/secrets/db
+	AllowPaths []string `yaml:"allow_paths" usage:"only allow Kubernetes API paths matching these globs, empty allows all"`
+	DenyPaths  []string `yaml:"deny_paths" usage:"reject Kubernetes API paths matching these globs"`
+	// 例如 Secret:data、metadata.managedFields
+	StripFields []string `yaml:"strip_fields" usage:"fields removed from JSON responses, as [Kind:]path.to.field"`
+}
+
+// Restrictions 返回 read_only、allow_paths、deny_paths 和 strip_fields 对应的代理限制，都未配置时返回 nil
+func (c KubernetesConfig) Restrictions() (*kubeauth.Restrictions, error) {
+	return kubeauth.NewRestrictions(kubeauth.RestrictionOptions{
+		ReadOnly:    c.ReadOnly,
+		AllowPaths:  c.AllowPaths,
+		DenyPaths:   c.DenyPaths,
+		StripFields: c.StripFields,
+	})
+}
+
+type IngestConfig struct {
+	BatchSize      int           `yaml:"batch_size" usage:"maximum rows per INSERT statement"`
+	FlushInterval  time.Duration `yaml:"flush_interval" usage:"flush buffered rows at least this often"`
+	QueueSize      int           `yaml:"queue_size" usage:"maximum buffered rows before ingest requests get 429"`
+	MaxBodyBytes   int           `yaml:"max_body_bytes" usage:"maximum (decompressed) ingest request body size"`
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl" usage:"how long responses are remembered per Idempotency-Key"`
+}
+
+type CollectorConfig struct {
+	Interval     time.Duration `yaml:"interval" usage:"sampling interval of the collect command"`
+	CgroupRoot   string        `yaml:"cgroup_root" usage:"cgroup v2 mount point"`
+	ProcRoot     string        `yaml:"proc_root" usage:"proc filesystem used for container network counters, empty disables"`
+	DockerSocket string        `yaml:"docker_socket" usage:"Docker Engine API socket used for container names, empty disables"`
+}
+
+// RetentionConfig 控制 container_stats 的汇总和清理，天数为 0 表示永久保留
+type RetentionConfig struct {
+	Enabled    bool          `yaml:"enabled" usage:"run rollup and retention jobs in the server"`
+	Interval   time.Duration `yaml:"interval" usage:"how often rollup and retention jobs run"`
+	RawDays    int           `yaml:"raw_days" usage:"days to keep raw rows in container_stats"`
+	MinuteDays int           `yaml:"minute_days" usage:"days to keep rows in container_stats_1m"`
+	HourDays   int           `yaml:"hour_days" usage:"days to keep rows in container_stats_1h, 0 keeps forever"`
+	BatchSize  int           `yaml:"batch_size" usage:"rows deleted per DELETE statement"`
+	BatchPause time.Duration `yaml:"batch_pause" usage:"pause between DELETE batches"`
+}
+
+// RedisConfig 的 Addr 为空表示不使用 Redis
+type RedisConfig struct {
+	Addr     string `yaml:"addr" usage:"Redis address (host:port), empty disables"`
+	Password string `yaml:"password" secret:"true" usage:"Redis password"`
+	DB       int    `yaml:"db" usage:"Redis database number"`
+	TLS      bool   `yaml:"tls" usage:"connect to Redis over TLS"`
+}
+
+// HealthConfig 控制 /readyz 的依赖检查
+type HealthConfig struct {
+	Timeout  time.Duration `yaml:"timeout" usage:"timeout of each readiness check"`
+	CacheTTL time.Duration `yaml:"cache_ttl" usage:"how long readiness check results are reused"`
+	// 不在集群中运行时可以关闭
+	Kubernetes bool `yaml:"kubernetes" usage:"include Kubernetes API reachability in /readyz"`
+}
+
+// AuthConfig 控制登录会话
+type AuthConfig struct {
+	// 为空时每次启动随机生成，重启后需要重新登录，多副本部署时必须配置
+	SessionSecret string        `yaml:"session_secret" secret:"true" usage:"key used to sign session cookies (at least 32 bytes), random per process when empty"`
+	SessionTTL    time.Duration `yaml:"session_ttl" usage:"how long a login session is valid"`
+	CookieName    string        `yaml:"cookie_name" usage:"session cookie name"`
+	SecureCookie  bool          `yaml:"secure_cookie" usage:"only send the session cookie over HTTPS"`
+}
+
+// JWTConfig 控制 API 的 bearer token 认证，配置了任一密钥来源时启用
+type JWTConfig struct {
+	Issuer    string   `yaml:"issuer" usage:"required iss claim of bearer tokens"`
+	Audiences []string `yaml:"audiences" usage:"accepted aud claims of bearer tokens"`
+	// PEM 格式的公钥或证书
+	KeyFiles    []string      `yaml:"key_files" usage:"PEM public key or certificate files used to verify bearer tokens"`
+	HMACSecret  string        `yaml:"hmac_secret" secret:"true" usage:"shared secret for HS256/HS384/HS512 bearer tokens"`
+	JWKSFile    string        `yaml:"jwks_file" usage:"JWKS file used to verify bearer tokens, reloaded when changed"`
+	JWKSURL     string        `yaml:"jwks_url" usage:"JWKS URL of the OIDC provider"`
+	JWKSRefresh time.Duration `yaml:"jwks_refresh" usage:"how long keys fetched from jwks_url are cached"`
+	Leeway      time.Duration `yaml:"leeway" usage:"allowed clock skew when checking exp, nbf and iat"`
+	// 支持 realm_access.roles 形式的嵌套声明
+	UsernameClaim string `yaml:"username_claim" usage:"claim used as the user name"`
+	RolesClaim    string `yaml:"roles_claim" usage:"claim used as the user roles, empty disables"`
+}
+
+// Enabled 表示配置了密钥来源
+func (c JWTConfig) Enabled() bool {
+	return len(c.KeyFiles) > 0 || c.HMACSecret != "" || c.JWKSFile != "" || c.JWKSURL != ""
+}
+
+// AuditConfig 控制 /kube 代理的审计日志，可以同时写入数据库和 JSONL 文件
+type AuditConfig struct {
+	Database bool `yaml:"database" usage:"write the audit log of /kube requests to the kube_audit_log table"`
+	// 每行一条 JSON，文件被移走后自动重新打开，可以配合 logrotate 使用
+	File          string        `yaml:"file" usage:"also append the audit log to this JSONL file, empty disables"`
+	QueueSize     int           `yaml:"queue_size" usage:"maximum buffered audit entries, newer entries are dropped when full"`
+	FlushInterval time.Duration `yaml:"flush_interval" usage:"write buffered audit entries at least this often"`
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Listen:       ":8080",
+			DrainTimeout: 15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			DSN:             "root:PassW0rd@tcp(localhost:3306)/mysti",
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 3 * time.Minute,
+		},
+		Kubernetes: KubernetesConfig{
+			Name:       "default",
+			APIServer:  kube.DefaultAPIServer,
+			TokenFile:  kube.DefaultTokenFile,
+			CACertFile: kube.DefaultCACertFile,
+		},
+		Ingest: IngestConfig{
+			BatchSize:      500,
+			FlushInterval:  time.Second,
+			QueueSize:      50000,
+			MaxBodyBytes:   32 << 20,
+			IdempotencyTTL: 24 * time.Hour,
+		},
+		Collector: CollectorConfig{
+			Interval:     10 * time.Second,
+			CgroupRoot:   "/sys/fs/cgroup",
+			ProcRoot:     "/proc",
+			DockerSocket: "/var/run/docker.sock",
+		},
+		Retention: RetentionConfig{
+			Interval:   10 * time.Minute,
+			RawDays:    7,
+			MinuteDays: 90,
+			BatchSize:  5000,
+			BatchPause: 100 * time.Millisecond,
+		},
+		Health: HealthConfig{
+			Timeout:    2 * time.Second,
+			CacheTTL:   5 * time.Second,
+			Kubernetes: true,
+		},
+		Auth: AuthConfig{
+			SessionTTL: 12 * time.Hour,
+			CookieName: "mysti_session",
+		},
+		JWT: JWTConfig{
+			JWKSRefresh:   10 * time.Minute,
+			Leeway:        time.Minute,
+			UsernameClaim: "sub",
+			RolesClaim:    "roles",
+		},
+		Audit: AuditConfig{
+			Database:      true,
+			QueueSize:     10000,
+			FlushInterval: time.Second,
+		},
+	}
+}
+
+// Validate 检查配置，返回所有错误
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Listen == "" {
+		fail("server.listen", "must not be empty")
+	}
+	if c.Server.DrainTimeout < 0 {
+		fail("server.drain_timeout", "must not be negative, got %s", c.Server.DrainTimeout)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			fail("server.trusted_proxies", "%q is not an IP or CIDR", proxy)
+		}
+	}
+
+	if c.Database.DSN == "" {
+		fail("database.dsn", "must not be empty")
+	} else if _, err := mysql.ParseDSN(c.Database.DSN); err != nil {
+		fail("database.dsn", "invalid MySQL DSN: %v", err)
+	}
+	if c.Database.MaxOpenConns < 0 {
+		fail("database.max_open_conns", "must not be negative, got %d", c.Database.MaxOpenConns)
+	}
+	if c.Database.MaxIdleConns < 0 {
+		fail("database.max_idle_conns", "must not be negative, got %d", c.Database.MaxIdleConns)
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		fail("database.max_idle_conns", "must not exceed max_open_conns (%d), got %d", c.Database.MaxOpenConns, c.Database.MaxIdleConns)
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		fail("database.conn_max_lifetime", "must not be negative, got %s", c.Database.ConnMaxLifetime)
+	}
+
+	if c.Kubernetes.APIServer != "" {
+		if u, err := url.Parse(c.Kubernetes.APIServer); err != nil || u.Scheme == "" || u.Host == "" {
+			fail("kubernetes.api_server", "must be an absolute URL, got %q", c.Kubernetes.APIServer)
+		}
+	}
+	if (c.Kubernetes.InCluster || c.Kubernetes.APIServer != "") && (c.Kubernetes.Name == "" || strings.Contains(c.Kubernetes.Name, "/")) {
+		fail("kubernetes.name", "must be non-empty and must not contain /, got %q", c.Kubernetes.Name)
+	}
+	if len(c.Kubernetes.Contexts) > 0 && c.Kubernetes.Kubeconfig == "" {
+		fail("kubernetes.contexts", "requires kubernetes.kubeconfig")
+	}
+	if _, err := c.Kubernetes.Restrictions(); err != nil {
+		fail("kubernetes", "%v", err)
+	}
+
+	if c.Ingest.BatchSize <= 0 || c.Ingest.BatchSize > 4000 {
+		fail("ingest.batch_size", "must be between 1 and 4000, got %d", c.Ingest.BatchSize)
+	}
+	if c.Ingest.FlushInterval <= 0 {
+		fail("ingest.flush_interval", "must be positive, got %s", c.Ingest.FlushInterval)
+	}
+	if c.Ingest.QueueSize < c.Ingest.BatchSize {
+		fail("ingest.queue_size", "must be at least batch_size (%d), got %d", c.Ingest.BatchSize, c.Ingest.QueueSize)
+	}
+	if c.Ingest.MaxBodyBytes <= 0 {
+		fail("ingest.max_body_bytes", "must be positive, got %d", c.Ingest.MaxBodyBytes)
+	}
+	if c.Ingest.IdempotencyTTL <= 0 {
+		fail("ingest.idempotency_ttl", "must be positive, got %s", c.Ingest.IdempotencyTTL)
+	}
+
+	if c.Collector.Interval < time.Second {
+		fail("collector.interval", "must be at least 1s, got %s", c.Collector.Interval)
+	}
+	if c.Collector.CgroupRoot == "" {
+		fail("collector.cgroup_root", "must not be empty")
+	}
+
+	if c.Retention.Interval < time.Minute {
+		fail("retention.interval", "must be at least 1m, got %s", c.Retention.Interval)
+	}
+	if c.Retention.RawDays < 0 || c.Retention.MinuteDays < 0 || c.Retention.HourDays < 0 {
+		fail("retention", "days must not be negative")
+	}
+	// 汇总表需要比原始数据保留得更久，否则查询长时间范围时会出现空洞
+	if c.Retention.RawDays > 0 && c.Retention.MinuteDays > 0 && c.Retention.MinuteDays < c.Retention.RawDays {
+		fail("retention.minute_days", "must not be shorter than raw_days (%d), got %d", c.Retention.RawDays, c.Retention.MinuteDays)
+	}
+	if c.Retention.MinuteDays > 0 && c.Retention.HourDays > 0 && c.Retention.HourDays < c.Retention.MinuteDays {
+		fail("retention.hour_days", "must not be shorter than minute_days (%d), got %d", c.Retention.MinuteDays, c.Retention.HourDays)
+	}
+	if c.Retention.BatchSize <= 0 {
+		fail("retention.batch_size", "must be positive, got %d", c.Retention.BatchSize)
+	}
+
+	if c.Redis.DB < 0 {
+		fail("redis.db", "must not be negative, got %d", c.Redis.DB)
+	}
+
+	if c.Health.Timeout <= 0 {
+		fail("health.timeout", "must be positive, got %s", c.Health.Timeout)
+	}
+	if c.Health.CacheTTL < 0 {
+		fail("health.cache_ttl", "must not be negative, got %s", c.Health.CacheTTL)
+	}
+
+	if c.Auth.SessionSecret != "" && len(c.Auth.SessionSecret) < 32 {
+		fail("auth.session_secret", "must be at least 32 bytes, got %d", len(c.Auth.SessionSecret))
+	}
+	if c.Auth.SessionTTL <= 0 {
+		fail("auth.session_ttl", "must be positive, got %s", c.Auth.SessionTTL)
+	}
+	if c.Auth.CookieName == "" {
+		fail("auth.cookie_name", "must not be empty")
+	}
+
+	if c.JWT.Enabled() {
+		// 不检查签发方和受众时，同一个 IdP 给其他应用签发的 token 也能通过
+		if c.JWT.Issuer == "" {
+			fail("jwt.issuer", "must be set when bearer tokens are enabled")
+		}
+		if len(c.JWT.Audiences) == 0 {
+			fail("jwt.audiences", "must be set when bearer tokens are enabled")
+		}
+		if c.JWT.HMACSecret != "" && len(c.JWT.HMACSecret) < 32 {
+			fail("jwt.hmac_secret", "must be at least 32 bytes, got %d", len(c.JWT.HMACSecret))
+		}
+		if c.JWT.JWKSURL != "" {
+			if u, err := url.Parse(c.JWT.JWKSURL); err != nil || u.Scheme == "" || u.Host == "" {
+				fail("jwt.jwks_url", "must be an absolute URL, got %q", c.JWT.JWKSURL)
+			}
+		}
+		if c.JWT.UsernameClaim == "" {
+			fail("jwt.username_claim", "must not be empty")
+		}
+	}
+	if c.JWT.Leeway < 0 {
+		fail("jwt.leeway", "must not be negative, got %s", c.JWT.Leeway)
+	}
+
+	if c.Audit.QueueSize <= 0 {
+		fail("audit.queue_size", "must be positive, got %d", c.Audit.QueueSize)
+	}
+	if c.Audit.FlushInterval <= 0 {
+		fail("audit.flush_interval", "must be positive, got %s", c.Audit.FlushInterval)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const EnvPrefix = "MYSTI_"
+
+// 配置项，对应 Config 中的一个叶子字段
+type field struct {
+	key    string // database.dsn
+	usage  string
+	secret string
+	path   []int
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// 遍历 Config 的所有叶子字段
+func fields() []field {
+	var result []field
+	var walk func(t reflect.Type, prefix string, path []int)
+	walk = func(t reflect.Type, prefix string, path []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			p := append(append([]int{}, path...), i)
+			if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+				walk(f.Type, prefix+name+".", p)
+				continue
+			}
+			result = append(result, field{key: prefix + name, usage: f.Tag.Get("usage"), secret: f.Tag.Get("secret"), path: p})
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "", nil)
+	return result
+}
+
+// 环境变量名，例如 database.dsn -> MYSTI_DATABASE_DSN
+func (f field) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.key, ".", "_"))
+}
+
+func (f field) value(c *Config) reflect.Value {
+	return reflect.ValueOf(c).Elem().FieldByIndex(f.path)
+}
+
+// 按字段类型解析字符串
+func (f field) set(c *Config, raw string) error {
+	v := f.value(c)
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (f field) format(c *Config) string {
+	v := f.value(c)
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// 命令行参数的值，解析后再按顺序覆盖配置
+type flagValue struct {
+	raw string
+	typ string
+}
+
+func (v *flagValue) String() string { return v.raw }
+func (v *flagValue) Type() string   { return v.typ }
+func (v *flagValue) Set(raw string) error {
+	v.raw = raw
+	return nil
+}
+
+// Loader 负责加载配置
+type Loader struct {
+	// 配置文件路径，为空时读取 MYSTI_CONFIG 环境变量
+	File  string
+	flags *pflag.FlagSet
+}
+
+// BindFlags 为每个配置项注册命令行参数，例如 --database.dsn
+func (l *Loader) BindFlags(flags *pflag.FlagSet) {
+	l.flags = flags
+	flags.StringVarP(&l.File, "config", "c", "", "configuration file (YAML), defaults to $"+EnvPrefix+"CONFIG")
+
+	defaults := Default()
+	for _, f := range fields() {
+		typ := f.value(defaults).Type().String()
+		if f.value(defaults).Type() == durationType {
+			typ = "duration"
+		}
+		raw := f.format(defaults)
+		if f.secret != "" {
+			// 帮助信息中不显示敏感的默认值
+			raw = ""
+		}
+		flag := flags.VarPF(&flagValue{raw: raw, typ: typ}, f.key, "", f.usage)
+		if typ == "bool" {
+			flag.NoOptDefVal = "true"
+		}
+	}
+}
+
+// Load 依次应用默认值、配置文件、环境变量和命令行参数，并校验结果
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+
+	file := l.File
+	if file == "" {
+		file = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if file != "" {
+		if err := loadFile(cfg, file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range fields() {
+		if raw, ok := os.LookupEnv(f.env()); ok {
+			if err := f.set(cfg, raw); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env(), err)
+			}
+		}
+	}
+
+	if l.flags != nil {
+		for _, f := range fields() {
+			flag := l.flags.Lookup(f.key)
+			if flag == nil || !flag.Changed {
+				continue
+			}
+			if err := f.set(cfg, flag.Value.String()); err != nil {
+				return nil, fmt.Errorf("--%s: %w", f.key, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// 拒绝未知的配置项，避免拼写错误被忽略
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// 清除测试进程中已有的 MYSTI_ 环境变量
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, EnvPrefix) {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "mysti.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "database:\n  max_open_conns: 20\nserver:\n  drain_timeout: 20s\n")
+
+	tests := []struct {
+		name      string
+		file      bool
+		env, args []string
+		conns     int
+		drain     time.Duration
+	}{
+		{"defaults", false, nil, nil, 10, 15 * time.Second},
+		{"yaml", true, nil, nil, 20, 20 * time.Second},
+		{"env over defaults", false, []string{"MYSTI_DATABASE_MAX_OPEN_CONNS=30"}, nil, 30, 15 * time.Second},
+		{"env over yaml", true, []string{"MYSTI_DATABASE_MAX_OPEN_CONNS=30"}, nil, 30, 20 * time.Second},
+		{"flags over env", true, []string{"MYSTI_DATABASE_MAX_OPEN_CONNS=30", "MYSTI_SERVER_DRAIN_TIMEOUT=30s"},
+			[]string{"--database.max_open_conns=40"}, 40, 30 * time.Second},
+		{"flags over yaml", true, nil, []string{"--server.drain_timeout", "40s"}, 20, 40 * time.Second},
+		{"config from env", false, []string{"MYSTI_CONFIG=" + file}, nil, 20, 20 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for _, kv := range tt.env {
+				name, value, _ := strings.Cut(kv, "=")
+				t.Setenv(name, value)
+			}
+			var l Loader
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			l.BindFlags(flags)
+			args := tt.args
+			if tt.file {
+				args = append([]string{"-c", file}, args...)
+			}
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := l.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Database.MaxOpenConns != tt.conns || cfg.Server.DrainTimeout != tt.drain {
+				t.Errorf("max_open_conns = %d, drain_timeout = %s; want %d, %s",
+					cfg.Database.MaxOpenConns, cfg.Server.DrainTimeout, tt.conns, tt.drain)
+			}
+		})
+	}
+}
+
+func TestLoadTypes(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MYSTI_KUBERNETES_KUBECONFIG", "/etc/kubeconfig")
+	t.Setenv("MYSTI_KUBERNETES_CONTEXTS", " a, ,b ")
+	t.Setenv("MYSTI_DATABASE_AUTO_MIGRATE", "true")
+	var l Loader
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	l.BindFlags(flags)
+	// bool 参数可以不带值
+	if err := flags.Parse([]string{"--auth.secure_cookie"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.Kubernetes.Contexts, "|") != "a|b" || !cfg.Database.AutoMigrate || !cfg.Auth.SecureCookie {
+		t.Errorf("contexts = %q, auto_migrate = %v, secure_cookie = %v",
+			cfg.Kubernetes.Contexts, cfg.Database.AutoMigrate, cfg.Auth.SecureCookie)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, env, arg, err string
+	}{
+		{"unknown yaml key", "database:\n  max_conns: 1\n", "", "", "field max_conns not found"},
+		{"bad env", "", "MYSTI_DATABASE_MAX_OPEN_CONNS=many", "", "MYSTI_DATABASE_MAX_OPEN_CONNS"},
+		{"bad flag", "", "", "--server.drain_timeout=soon", "--server.drain_timeout"},
+		{"invalid value", "", "MYSTI_SERVER_DRAIN_TIMEOUT=-1s", "", "invalid configuration"},
+		{"invalid trusted proxy", "", "MYSTI_SERVER_TRUSTED_PROXIES=10.0.0.0/8,proxy.local", "", `"proxy.local" is not an IP or CIDR`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			var l Loader
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			l.BindFlags(flags)
+			var args []string
+			if tt.yaml != "" {
+				args = append(args, "-c", writeFile(t, tt.yaml))
+			}
+			if tt.arg != "" {
+				args = append(args, tt.arg)
+			}
+			if name, value, ok := strings.Cut(tt.env, "="); ok {
+				t.Setenv(name, value)
+			}
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := l.Load(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.DSN = "mysti:s3cret@tcp(db:3306)/mysti?parseTime=true"
+	cfg.Redis.Password = "redis-pass"
+	cfg.Auth.SessionSecret = strings.Repeat("x", 32)
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"s3cret", "redis-pass", cfg.Auth.SessionSecret} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed configuration contains %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"mysti:" + redacted + "@tcp(db:3306)/mysti", "password: '" + redacted + "'", "session_secret: '" + redacted + "'"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed configuration does not contain %q:\n%s", want, out)
+		}
+	}
+	// 原配置不变
+	if cfg.Redis.Password != "redis-pass" || !strings.Contains(cfg.Database.DSN, "s3cret") {
+		t.Error("Redacted modified the original configuration")
+	}
+
+	tests := []struct {
+		dsn, want string
+	}{
+		{"root@tcp(localhost:3306)/mysti", "root@tcp(localhost:3306)/mysti"},
+		{"not a dsn", redacted},
+	}
+	for _, tt := range tests {
+		cfg.Database.DSN = tt.dsn
+		if got := cfg.Redacted().Database.DSN; got != tt.want {
+			t.Errorf("redact %q = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+	// 空的敏感字段保持为空
+	cfg.Redis.Password = ""
+	if got := cfg.Redacted().Redis.Password; got != "" {
+		t.Errorf("empty password redacted to %q", got)
+	}
+}
+
+func TestBindFlagsHidesSecrets(t *testing.T) {
+	var l Loader
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	l.BindFlags(flags)
+	if def := flags.Lookup("database.dsn").DefValue; def != "" {
+		t.Errorf("database.dsn default shown in help: %q", def)
+	}
+	if def := flags.Lookup("database.max_open_conns").DefValue; def != "10" {
+		t.Errorf("database.max_open_conns default = %q", def)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "******"
+
+// Redacted 返回隐藏了敏感信息的配置副本
+func (c *Config) Redacted() *Config {
+	copied := *c
+	for _, f := range fields() {
+		v := f.value(&copied)
+		if v.Kind() != reflect.String || v.String() == "" {
+			continue
+		}
+		switch f.secret {
+		case "true":
+			v.SetString(redacted)
+		case "dsn":
+			v.SetString(redactDSN(v.String()))
+		}
+	}
+	return &copied
+}
+
+// 只隐藏 DSN 中的密码
+func redactDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redacted
+	}
+	return cfg.FormatDSN()
+}
+
+// Print 以 YAML 格式输出隐藏敏感信息后的配置
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/middleware"
+	"go-mysti/model"
+	"go-mysti/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	defaultAuditRange = 24 * time.Hour
+	// 可以查看审计日志的角色
+	auditRole = "admin"
+)
+
+type AuditController struct {
+	audit repository.Audit
+}
+
+// RegisterAuditRoutes 注册审计日志的 API 和页面，只有 admin 角色可以访问
+func RegisterAuditRoutes(audit repository.Audit, api *gin.RouterGroup, pages *gin.RouterGroup) AuditController {
+	ctl := AuditController{audit: audit}
+	api.GET("", requireRole(auditRole), ctl.list)
+	pages.GET("/audit", requireRole(auditRole), ctl.page)
+
+	return ctl
+}
+
+func requireRole(role string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if user := middleware.CurrentUser(ctx); user == nil || !user.HasRole(role) {
+			ctx.Error(apperror.Forbidden("role " + role + " required"))
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// GET /api/kube/audit?from=&to=&cluster=&user=&namespace=&verb=&resource=&min_status=&limit=&cursor=
+func (ctl AuditController) list(ctx *gin.Context) {
+	q, err := parseAuditQuery(ctx)
+	if err != nil {
+		ctx.Error(apperror.InvalidParam(err))
+		return
+	}
+	entries, nextCursor, err := ctl.query(ctx, q)
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	if nextCursor != "" {
+		ctx.Header("X-Next-Cursor", nextCursor)
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"from":        q.From,
+		"to":          q.To,
+		"items":       entries,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GET /audit，参数与 API 相同
+func (ctl AuditController) page(ctx *gin.Context) {
+	data := pageData(ctx, "Kubernetes audit log")
+	data["query"] = ctx.Request.URL.Query()
+
+	// 参数错误时仍然展示表单，方便修改
+	q, err := parseAuditQuery(ctx)
+	if err != nil {
+		data["error"] = err.Error()
+		ctx.HTML(http.StatusBadRequest, "kube/audit.html", data)
+		return
+	}
+	entries, nextCursor, err := ctl.query(ctx, q)
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	data["from"] = q.From
+	data["to"] = q.To
+	data["fromInput"] = q.From.Format(dashboardTimeInput)
+	data["toInput"] = q.To.Format(dashboardTimeInput)
+	data["entries"] = entries
+	if nextCursor != "" {
+		next := ctx.Request.URL.Query()
+		next.Set("cursor", nextCursor)
+		data["nextPage"] = "?" + next.Encode()
+	}
+	ctx.HTML(http.StatusOK, "kube/audit.html", data)
+}
+
+// 多查一行用于判断是否还有下一页
+func (ctl AuditController) query(ctx *gin.Context, q repository.AuditQuery) ([]model.AuditEntry, string, error) {
+	limit := q.Limit
+	q.Limit++
+	entries, err := ctl.audit.ListAuditEntries(ctx.Request.Context(), q)
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		nextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+	return entries, nextCursor, nil
+}
+
+func parseAuditQuery(ctx *gin.Context) (repository.AuditQuery, error) {
+	q := repository.AuditQuery{
+		Cluster:   ctx.Query("cluster"),
+		Username:  ctx.Query("user"),
+		Namespace: ctx.Query("namespace"),
+		Verb:      ctx.Query("verb"),
+		Resource:  ctx.Query("resource"),
+	}
+
+	q.To = time.Now().UTC()
+	if raw := ctx.Query("to"); raw != "" {
+		t, err := parseAuditTime(raw)
+		if err != nil {
+			return q, errInvalidParam("to", raw)
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-defaultAuditRange)
+	if raw := ctx.Query("from"); raw != "" {
+		t, err := parseAuditTime(raw)
+		if err != nil {
+			return q, errInvalidParam("from", raw)
+		}
+		q.From = t
+	}
+	if !q.From.Before(q.To) {
+		return q, errInvalidParam("from", ctx.Query("from"))
+	}
+
+	if raw := ctx.Query("min_status"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 599 {
+			return q, errInvalidParam("min_status", raw)
+		}
+		q.MinStatus = n
+	}
+	if raw := ctx.Query("cursor"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			return q, errInvalidParam("cursor", raw)
+		}
+		q.BeforeID = id
+	}
+	limit, err := parseLimit(ctx.Query("limit"), defaultAuditLimit, maxAuditLimit)
+	if err != nil {
+		return q, err
+	}
+	q.Limit = limit
+	return q, nil
+}
+
+// 页面表单使用 datetime-local（UTC），API 使用 RFC3339 或 Unix 时间戳
+func parseAuditTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(dashboardTimeInput, raw); err == nil {
+		return t, nil
+	}
+	return parseTimeParam(raw)
+}
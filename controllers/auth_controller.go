@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go-mysti/apperror"
+	"go-mysti/middleware"
+	"go-mysti/repository"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户不存在时也执行一次 bcrypt 比较，避免通过响应时间判断用户名是否存在
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("mysti-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+type AuthController struct {
+	users repository.Users
+}
+
+// RegisterAuthRoutes 注册登录和退出页面，router 需要使用 middleware.Authenticate
+func RegisterAuthRoutes(users repository.Users, router *gin.RouterGroup) AuthController {
+	ctl := AuthController{users: users}
+	router.GET("/login", ctl.loginPage)
+	router.POST("/login", middleware.VerifyCSRF(), ctl.login)
+	router.POST("/logout", middleware.VerifyCSRF(), ctl.logout)
+
+	return ctl
+}
+
+// GET /login?next=/path
+func (ctl AuthController) loginPage(ctx *gin.Context) {
+	if middleware.CurrentUser(ctx) != nil {
+		ctx.Redirect(http.StatusSeeOther, safeRedirect(ctx.Query("next")))
+		return
+	}
+	data := pageData(ctx, "Login")
+	data["next"] = ctx.Query("next")
+	ctx.HTML(http.StatusOK, "auth/login.html", data)
+}
+
+// POST /login
+func (ctl AuthController) login(ctx *gin.Context) {
+	username := strings.TrimSpace(ctx.PostForm("username"))
+	password := ctx.PostForm("password")
+	next := ctx.PostForm("next")
+
+	user, err := ctl.users.UserByUsername(ctx.Request.Context(), username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	hash := dummyPasswordHash()
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || user == nil {
+		data := pageData(ctx, "Login")
+		data["next"] = next
+		data["username"] = username
+		data["error"] = "Invalid username or password"
+		ctx.HTML(http.StatusUnauthorized, "auth/login.html", data)
+		return
+	}
+
+	middleware.Login(ctx, user)
+	ctx.Redirect(http.StatusSeeOther, safeRedirect(next))
+}
+
+// POST /logout
+func (ctl AuthController) logout(ctx *gin.Context) {
+	if err := middleware.Logout(ctx); err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	ctx.Redirect(http.StatusSeeOther, "/login")
+}
+
+// 只允许跳转到本站路径，防止开放重定向
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// 页面公共数据：标题、当前用户和表单使用的 CSRF token
+func pageData(ctx *gin.Context, title string) gin.H {
+	return gin.H{
+		"title":     title,
+		"user":      middleware.CurrentUser(ctx),
+		"csrfToken": middleware.CSRFToken(ctx),
+	}
+}
@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/config"
+	"go-mysti/model"
+	"go-mysti/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultStatsLimit = 500
+	maxStatsLimit     = 5000
+	defaultStatsRange = time.Hour
+)
+
+type ContainerController struct {
+	containers repository.Containers
+	statRepo   repository.Stats
+	retention  config.RetentionConfig
+}
+
+func RegisterContainerRoutes(repo repository.Repository, retention config.RetentionConfig, router *gin.RouterGroup) ContainerController {
+	ctl := ContainerController{containers: repo, statRepo: repo, retention: retention}
+	router.GET("", ctl.list)
+	router.GET("/:id/stats", ctl.stats)
+	router.GET("/:id/series", ctl.series)
+
+	return ctl
+}
+
+// GET /api/containers
+func (ctl ContainerController) list(ctx *gin.Context) {
+	containers, err := ctl.containers.ListContainers(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"items": containers})
+}
+
+// GET /api/containers/:id/stats?from=&to=&limit=&cursor=&fields=&format=json|csv
+func (ctl ContainerController) stats(ctx *gin.Context) {
+	from, to, err := parseTimeRange(ctx, defaultStatsRange)
+	if err != nil {
+		ctx.Error(apperror.InvalidParam(err))
+		return
+	}
+	limit, err := parseLimit(ctx.Query("limit"), defaultStatsLimit, maxStatsLimit)
+	if err != nil {
+		ctx.Error(apperror.InvalidParam(err))
+		return
+	}
+	fields, err := parseFields(ctx.Query("fields"), model.ContainerStatFields)
+	if err != nil {
+		ctx.Error(apperror.InvalidParam(err))
+		return
+	}
+	var after *repository.Cursor
+	if raw := ctx.Query("cursor"); raw != "" {
+		if after, err = decodeStatCursor(raw); err != nil {
+			ctx.Error(apperror.InvalidParam(err))
+			return
+		}
+	}
+
+	// 多查一行用于判断是否还有下一页
+	stats, err := ctl.statRepo.ListStats(ctx.Request.Context(), repository.StatsQuery{
+		ContainerID: ctx.Param("id"),
+		From:        from,
+		To:          to,
+		After:       after,
+		Limit:       limit + 1,
+	})
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	nextCursor := ""
+	if len(stats) > limit {
+		stats = stats[:limit]
+		last := stats[len(stats)-1]
+		nextCursor = encodeStatCursor(repository.Cursor{Time: last.Time, ID: last.ID})
+	}
+
+	if nextCursor != "" {
+		ctx.Header("X-Next-Cursor", nextCursor)
+	}
+	if wantsCSV(ctx) {
+		writeStatsCSV(ctx, fields, stats)
+		return
+	}
+
+	items := make([]statRow, len(stats))
+	for i := range stats {
+		items[i] = statRow{fields: fields, stat: &stats[i]}
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"container_id": ctx.Param("id"),
+		"from":         from,
+		"to":           to,
+		"fields":       fields,
+		"items":        items,
+		"next_cursor":  nextCursor,
+	})
+}
+
+// 只输出选择的字段，并保持字段顺序
+type statRow struct {
+	fields []string
+	stat   *model.ContainerStat
+}
+
+func (r statRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range r.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := json.Marshal(r.stat.Field(name))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%q:", name)
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func wantsCSV(ctx *gin.Context) bool {
+	if format := ctx.Query("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(ctx.GetHeader("Accept"), "text/csv")
+}
+
+func writeStatsCSV(ctx *gin.Context, fields []string, stats []model.ContainerStat) {
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Status(http.StatusOK)
+
+	w := csv.NewWriter(ctx.Writer)
+	w.Write(fields)
+	record := make([]string, len(fields))
+	for i := range stats {
+		for j, name := range fields {
+			switch v := stats[i].Field(name).(type) {
+			case time.Time:
+				record[j] = v.UTC().Format(time.RFC3339Nano)
+			case float64:
+				record[j] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[j] = fmt.Sprint(v)
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+}
+
+// 解析 from/to 参数，默认为最近 defaultRange
+func parseTimeRange(ctx *gin.Context, defaultRange time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if raw := ctx.Query("to"); raw != "" {
+		t, err := parseTimeParam(raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+	from := to.Add(-defaultRange)
+	if raw := ctx.Query("from"); raw != "" {
+		t, err := parseTimeParam(raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// 支持 RFC3339、Unix 秒和 Unix 毫秒
+func parseTimeParam(raw string) (time.Time, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, errors.New("expected RFC3339 or unix timestamp")
+	}
+	return t.UTC(), nil
+}
+
+func parseLimit(raw string, def, max int) (int, error) {
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", raw)
+	}
+	return min(n, max), nil
+}
+
+// 解析逗号分隔的字段列表，为空时返回全部字段
+func parseFields(raw string, allowed []string) ([]string, error) {
+	if raw == "" {
+		return allowed, nil
+	}
+	var fields []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(fields, name) {
+			continue
+		}
+		if !slices.Contains(allowed, name) {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields = append(fields, name)
+	}
+	if len(fields) == 0 {
+		return allowed, nil
+	}
+	return fields, nil
+}
+
+func encodeStatCursor(c repository.Cursor) string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeStatCursor(s string) (*repository.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	n, err1 := strconv.ParseInt(nanos, 10, 64)
+	i, err2 := strconv.ParseInt(id, 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &repository.Cursor{Time: time.Unix(0, n).UTC(), ID: i}, nil
+}
+
+func errInvalidParam(name, value string) error {
+	return fmt.Errorf("invalid %s %q", name, value)
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mysti/config"
+	"go-mysti/middleware"
+	"go-mysti/model"
+	"go-mysti/repository"
+	"go-mysti/repository/memory"
+	"go-mysti/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestContainerRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := memory.New()
+	var rows []model.ContainerStat
+	for i := range 6 {
+		rows = append(rows,
+			model.ContainerStat{Time: testStart.Add(time.Duration(i) * 10 * time.Second), ContainerID: "web", ContainerName: "web-1",
+				CPUPercent: float64(10 * (i + 1)), MemUsage: 100},
+			model.ContainerStat{Time: testStart.Add(time.Duration(i) * 10 * time.Second), ContainerID: "db", ContainerName: "db-1",
+				CPUPercent: 5, MemUsage: 200})
+	}
+	if err := store.InsertStats(context.Background(), rows); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := gin.New()
+	engine.Use(middleware.RequestID())
+	RegisterContainerRoutes(store, config.RetentionConfig{}, engine.Group("/api/containers", middleware.ProblemErrors()))
+	return engine
+}
+
+func doGet(t *testing.T, handler http.Handler, url string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if out != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+	return w
+}
+
+func TestListContainers(t *testing.T) {
+	router := newTestContainerRouter(t)
+
+	var body struct {
+		Items []model.Container `json:"items"`
+	}
+	w := doGet(t, router, "/api/containers", &body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if len(body.Items) != 2 || body.Items[0].ID != "db" || body.Items[1].Name != "web-1" {
+		t.Errorf("items = %+v", body.Items)
+	}
+}
+
+func TestContainerStatsPagination(t *testing.T) {
+	router := newTestContainerRouter(t)
+	base := "/api/containers/web/stats?fields=time,cpu_percent&from=" + testStart.Format(time.RFC3339) +
+		"&to=" + testStart.Add(time.Hour).Format(time.RFC3339) + "&limit=4"
+
+	var page struct {
+		Items      []map[string]any `json:"items"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	w := doGet(t, router, base, &page)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if len(page.Items) != 4 || page.NextCursor == "" || w.Header().Get("X-Next-Cursor") != page.NextCursor {
+		t.Fatalf("first page: %d items, cursor %q", len(page.Items), page.NextCursor)
+	}
+	if len(page.Items[0]) != 2 || page.Items[0]["cpu_percent"] != 10.0 {
+		t.Errorf("first item = %v", page.Items[0])
+	}
+
+	cursor := page.NextCursor
+	page.Items, page.NextCursor = nil, ""
+	doGet(t, router, base+"&cursor="+cursor, &page)
+	if len(page.Items) != 2 || page.NextCursor != "" || page.Items[1]["cpu_percent"] != 60.0 {
+		t.Errorf("second page: %v, cursor %q", page.Items, page.NextCursor)
+	}
+}
+
+func TestContainerStatsInvalidCursor(t *testing.T) {
+	router := newTestContainerRouter(t)
+	w := doGet(t, router, "/api/containers/web/stats?cursor=!!", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var problem middleware.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != 400 || problem.Code != "invalid_param" || problem.RequestID == "" || problem.RequestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("problem = %+v", problem)
+	}
+}
+
+func TestContainerSeries(t *testing.T) {
+	router := newTestContainerRouter(t)
+	url := "/api/containers/web,db/series?metrics=cpu_percent&agg=avg,max,p50&step=30s&from=" +
+		testStart.Format(time.RFC3339) + "&to=" + testStart.Add(time.Minute).Format(time.RFC3339)
+
+	var body struct {
+		Table  string   `json:"table"`
+		Series []Series `json:"series"`
+	}
+	w := doGet(t, router, url, &body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if body.Table != "container_stats" || len(body.Series) != 6 {
+		t.Fatalf("table = %q, %d series", body.Table, len(body.Series))
+	}
+
+	// web 第一个 30s 桶内的 CPU 为 10、20、30
+	want := map[string]float64{"avg": 20, "max": 30, "p50": 20}
+	for _, s := range body.Series[:3] {
+		if s.ContainerID != "web" || len(s.Points) != 2 {
+			t.Fatalf("series = %+v", s)
+		}
+		if got := s.Points[0][1]; got != want[s.Agg] {
+			t.Errorf("%s = %v, want %v", s.Agg, got, want[s.Agg])
+		}
+	}
+}
+
+func TestContainerStatsCSV(t *testing.T) {
+	router := newTestContainerRouter(t)
+	base := "/api/containers/web/stats?fields=time,cpu_percent,mem_usage&limit=2&from=" + testStart.Format(time.RFC3339) +
+		"&to=" + testStart.Add(time.Hour).Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		name, url, accept string
+	}{
+		{"format parameter", base + "&format=csv", ""},
+		{"accept header", base, "text/csv"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+				t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+			}
+			records, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := [][]string{
+				{"time", "cpu_percent", "mem_usage"},
+				{"2024-05-01T12:00:00Z", "10", "100"},
+				{"2024-05-01T12:00:10Z", "20", "100"},
+			}
+			if len(records) != len(want) {
+				t.Fatalf("records = %q", records)
+			}
+			for i := range want {
+				if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+					t.Errorf("record %d = %q, want %q", i, records[i], want[i])
+				}
+			}
+			// CSV 没有地方放游标，只通过响应头返回
+			if w.Header().Get("X-Next-Cursor") == "" {
+				t.Error("X-Next-Cursor is not set")
+			}
+		})
+	}
+
+	// format=json 优先于 Accept
+	req := httptest.NewRequest(http.MethodGet, base+"&format=json", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("format=json Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestContainerSeriesPercentileLimit(t *testing.T) {
+	router := newTestContainerRouter(t)
+	defer func(old int) { maxPercentileRows = old }(maxPercentileRows)
+	maxPercentileRows = 6
+	url := "/api/containers/web,db/series?metrics=cpu_percent&step=30s&from=" +
+		testStart.Format(time.RFC3339) + "&to=" + testStart.Add(time.Minute).Format(time.RFC3339) + "&agg="
+
+	// web 和 db 共 12 行，超过上限
+	w := doGet(t, router, url+"p95", nil)
+	var problem middleware.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusRequestEntityTooLarge || problem.Code != "too_many_samples" {
+		t.Errorf("p95 status = %d, problem = %+v", w.Code, problem)
+	}
+	// SQL 聚合不受限制
+	if w := doGet(t, router, url+"avg", nil); w.Code != http.StatusOK {
+		t.Errorf("avg status = %d, body = %s", w.Code, w.Body)
+	}
+	maxPercentileRows = 12
+	if w := doGet(t, router, url+"p95", nil); w.Code != http.StatusOK {
+		t.Errorf("p95 within limit status = %d, body = %s", w.Code, w.Body)
+	}
+}
+
+func TestCapStep(t *testing.T) {
+	tests := []struct {
+		from      time.Time
+		span      time.Duration
+		step      time.Duration
+		maxPoints int
+		want      time.Duration
+	}{
+		// 对齐时正好 maxPoints 个桶
+		{testStart, 100 * time.Second, 10 * time.Second, 10, 10 * time.Second},
+		// 不对齐时 10s 会产生 11 个桶
+		{testStart.Add(5 * time.Second), 100 * time.Second, 10 * time.Second, 10, 30 * time.Second},
+		{testStart.Add(5 * time.Second), 100 * time.Second, 0, 11, 10 * time.Second},
+		// 超过最大的预设步长
+		{testStart.Add(time.Second), 100 * 24 * time.Hour, 0, 10, 266*time.Hour + 40*time.Minute},
+	}
+	for _, tt := range tests {
+		to := tt.from.Add(tt.span)
+		got := capStep(tt.from, to, tt.step, tt.maxPoints)
+		if got != tt.want {
+			t.Errorf("capStep(%v, %v, %v, %d) = %v, want %v", tt.from, tt.span, tt.step, tt.maxPoints, got, tt.want)
+		}
+	}
+
+	// 任意偏移下桶数都不超过上限
+	for offset := time.Duration(0); offset < time.Minute; offset += 7 * time.Second {
+		from := testStart.Add(offset)
+		for _, maxPoints := range []int{1, 2, 3, 7, 240} {
+			for _, span := range []time.Duration{time.Minute, 17 * time.Minute, 5 * time.Hour, 30 * 24 * time.Hour} {
+				step := capStep(from, from.Add(span), 0, maxPoints)
+				buckets := make(map[int64]bool)
+				for ts := from; ts.Before(from.Add(span)); ts = ts.Add(span / 97) {
+					buckets[ts.Unix()/int64(step/time.Second)] = true
+				}
+				buckets[from.Add(span-time.Nanosecond).Unix()/int64(step/time.Second)] = true
+				if n := bucketCount(from, from.Add(span), step); n > maxPoints || n < len(buckets) {
+					t.Errorf("offset %v span %v max %d: step %v gives %d buckets", offset, span, maxPoints, step, n)
+				}
+			}
+		}
+	}
+}
+
+// 汇总进度固定的 Stats
+type rolledUpStats struct {
+	repository.Stats
+	watermark time.Time
+}
+
+func (s rolledUpStats) RollupWatermark(ctx context.Context, table retention.Table) (time.Time, error) {
+	return s.watermark, nil
+}
+
+func TestChooseTableWithoutRetentionEnabled(t *testing.T) {
+	// 服务内的任务没有启用，但 cron 运行了 server retention run
+	cfg := config.Default().Retention
+	cfg.Enabled = false
+	now := time.Now()
+	from, to := now.AddDate(0, 0, -(cfg.RawDays+3)), now
+	watermark := now.Add(-time.Hour).Truncate(time.Hour)
+
+	for _, tc := range []struct {
+		name      string
+		watermark time.Time
+		table     retention.Table
+		rawFrom   time.Time
+	}{
+		{"rolled up", watermark, retention.MinuteTable, watermark},
+		{"never rolled up", time.Time{}, retention.RawTable, time.Time{}},
+	} {
+		q := &seriesQuery{from: from, to: to, step: time.Hour, aggs: []string{"avg"}}
+		if err := chooseTable(context.Background(), rolledUpStats{watermark: tc.watermark}, cfg, q); err != nil {
+			t.Fatal(err)
+		}
+		if q.table != tc.table || !q.rawFrom.Equal(tc.rawFrom) {
+			t.Errorf("%s: table = %s, raw_from = %v", tc.name, q.table.Name, q.rawFrom)
+		}
+	}
+}
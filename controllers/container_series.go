@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/config"
+	"go-mysti/model"
+	"go-mysti/repository"
+	"go-mysti/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 单条曲线最多返回的点数
+	maxSeriesPoints = 1000
+	// 单次请求最多比较的容器数
+	maxSeriesContainers = 20
+	defaultSeriesRange  = 6 * time.Hour
+)
+
+// 计算百分位数时最多读取的行数，超过时返回 413，避免一次请求把大量样本读入内存
+var maxPercentileRows = 500000
+
+// SQL 可以直接计算的聚合，其余的 pNN 在内存中计算
+var sqlAggregations = []string{"avg", "min", "max", "sum", "count"}
+
+// 自动选择步长时使用的候选值
+var niceSteps = []time.Duration{
+	10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+type seriesQuery struct {
+	ids     []string
+	metrics []string
+	aggs    []string
+	from    time.Time
+	to      time.Time
+	step    time.Duration
+	// 查询的表，原始表或汇总表
+	table retention.Table
+	// 使用汇总表时，不为零值表示之后的数据还没有汇总，从原始表读取
+	rawFrom time.Time
+}
+
+type Series struct {
+	ContainerID string   `json:"container_id"`
+	Metric      string   `json:"metric"`
+	Agg         string   `json:"agg"`
+	Points      [][2]any `json:"points"`
+}
+
+// GET /api/containers/:id/series?step=5m&agg=avg,max,p95&metrics=cpu_percent&from=&to=&fill=null|zero|previous
+//
+// :id 可以是逗号分隔的多个容器 ID，用于对比
+func (ctl ContainerController) series(ctx *gin.Context) {
+	q, err := parseSeriesQuery(ctx)
+	if err != nil {
+		ctx.Error(apperror.InvalidParam(err))
+		return
+	}
+	fill := ctx.DefaultQuery("fill", "null")
+	if !slices.Contains([]string{"null", "zero", "previous"}, fill) {
+		ctx.Error(apperror.InvalidParam(fmt.Errorf("invalid fill %q", fill)))
+		return
+	}
+
+	if err := chooseTable(ctx.Request.Context(), ctl.statRepo, ctl.retention, q); err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	buckets, err := queryBuckets(ctx.Request.Context(), ctl.statRepo, q)
+	if err != nil {
+		ctx.Error(apperror.From(err))
+		return
+	}
+
+	result := gin.H{
+		"from":   q.from,
+		"to":     q.to,
+		"step":   q.step.String(),
+		"table":  q.table.Name,
+		"series": buildSeries(q, buckets, fill),
+	}
+	if !q.rawFrom.IsZero() {
+		result["raw_from"] = q.rawFrom
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// 选择查询的表，汇总表还没有覆盖的最近一段从原始表读取
+func chooseTable(ctx context.Context, stats repository.Stats, cfg config.RetentionConfig, q *seriesQuery) error {
+	q.table = retention.ChooseTable(cfg, q.from, q.step, needsRawValues(q.aggs), time.Now())
+	if q.table.Raw() {
+		return nil
+	}
+	watermark, err := stats.RollupWatermark(ctx, q.table)
+	if err != nil {
+		return err
+	}
+	q.table, q.rawFrom = retention.SplitAtWatermark(q.table, q.from, q.to, watermark)
+	return nil
+}
+
+func parseSeriesQuery(ctx *gin.Context) (*seriesQuery, error) {
+	q := &seriesQuery{}
+	for _, id := range strings.Split(ctx.Param("id"), ",") {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(q.ids, id) {
+			q.ids = append(q.ids, id)
+		}
+	}
+	if len(q.ids) == 0 {
+		return nil, fmt.Errorf("container id is required")
+	}
+	if len(q.ids) > maxSeriesContainers {
+		return nil, fmt.Errorf("at most %d containers can be compared", maxSeriesContainers)
+	}
+
+	var err error
+	if q.from, q.to, err = parseTimeRange(ctx, defaultSeriesRange); err != nil {
+		return nil, err
+	}
+	if q.metrics, err = parseFields(ctx.DefaultQuery("metrics", "cpu_percent,mem_percent"), model.ContainerStatMetrics); err != nil {
+		return nil, err
+	}
+	if q.aggs, err = parseAggregations(ctx.DefaultQuery("agg", "avg")); err != nil {
+		return nil, err
+	}
+
+	maxPoints := maxSeriesPoints
+	if raw := ctx.Query("max_points"); raw != "" {
+		if maxPoints, err = parseLimit(raw, maxSeriesPoints, maxSeriesPoints); err != nil {
+			return nil, fmt.Errorf("invalid max_points %q", raw)
+		}
+	}
+	if raw := ctx.Query("step"); raw != "" {
+		if q.step, err = time.ParseDuration(raw); err != nil || q.step < time.Second {
+			return nil, fmt.Errorf("invalid step %q, expected a duration of at least 1s", raw)
+		}
+		q.step = q.step.Truncate(time.Second)
+	}
+	// 点数超过上限时自动放大步长
+	q.step = capStep(q.from, q.to, q.step, maxPoints)
+	return q, nil
+}
+
+func parseAggregations(raw string) ([]string, error) {
+	var aggs []string
+	for _, agg := range strings.Split(raw, ",") {
+		agg = strings.TrimSpace(agg)
+		if agg == "" || slices.Contains(aggs, agg) {
+			continue
+		}
+		if _, ok := parsePercentile(agg); !ok && !slices.Contains(sqlAggregations, agg) {
+			return nil, fmt.Errorf("unknown aggregation %q, expected one of %s or p1..p99",
+				agg, strings.Join(sqlAggregations, ", "))
+		}
+		aggs = append(aggs, agg)
+	}
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("agg is required")
+	}
+	return aggs, nil
+}
+
+// p95 -> 0.95
+func parsePercentile(agg string) (float64, bool) {
+	if !strings.HasPrefix(agg, "p") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(agg[1:])
+	if err != nil || n < 1 || n > 99 {
+		return 0, false
+	}
+	return float64(n) / 100, true
+}
+
+// 选出桶数不超过 maxPoints 的步长，桶按 Unix 时间对齐，from 不在边界上时会多出一个桶
+func capStep(from, to time.Time, step time.Duration, maxPoints int) time.Duration {
+	if step > 0 && bucketCount(from, to, step) <= maxPoints {
+		return step
+	}
+	for _, nice := range niceSteps {
+		if nice >= step && bucketCount(from, to, nice) <= maxPoints {
+			return nice
+		}
+	}
+	if maxPoints == 1 {
+		// 只有从 Unix 零点开始的桶能保证覆盖整个范围
+		return time.Duration(to.Unix()+1) * time.Second
+	}
+	// 步长不小于 span/(maxPoints-1) 时，加上对齐多出的一个桶也不会超过 maxPoints
+	span := float64(to.Sub(from))
+	minStep := time.Duration(math.Ceil(span/float64(maxPoints-1)/float64(time.Second))) * time.Second
+	return max(minStep, step, time.Second)
+}
+
+// [from, to) 覆盖的桶数，与查询中的 FLOOR(UNIX_TIMESTAMP(__time) / step) 一致
+func bucketCount(from, to time.Time, step time.Duration) int {
+	if !to.After(from) {
+		return 0
+	}
+	seconds := int64(step / time.Second)
+	first := from.Unix() / seconds
+	last := to.Add(-time.Nanosecond).Unix() / seconds
+	return int(last - first + 1)
+}
+
+func needsRawValues(aggs []string) bool {
+	for _, agg := range aggs {
+		if _, ok := parsePercentile(agg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 查询每个桶的聚合值，时间按 step 对齐到 Unix 时间
+//
+// 百分位数无法直接在 MySQL 中计算，取出桶内原始值后在内存中计算；
+// 使用汇总表时以每行的平均值作为样本，结果是近似值。
+func queryBuckets(ctx context.Context, stats repository.Stats, q *seriesQuery) (map[repository.BucketKey]map[string]float64, error) {
+	bq := repository.BucketQuery{ContainerIDs: q.ids, Metrics: q.metrics, From: q.from, To: q.to, Step: q.step,
+		Table: q.table, RawFrom: q.rawFrom}
+	if needsRawValues(q.aggs) {
+		bq.MaxRows = maxPercentileRows
+		raw, err := stats.StatBucketValues(ctx, bq)
+		if errors.Is(err, repository.ErrTooManyRows) {
+			return nil, apperror.Wrap(err, http.StatusRequestEntityTooLarge, "too_many_samples",
+				fmt.Sprintf("more than %d samples are needed for percentiles, narrow the time range or compare fewer containers", maxPercentileRows))
+		}
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[repository.BucketKey]map[string]float64, len(raw))
+		for key, values := range raw {
+			result[key] = aggregate(values, q.aggs)
+		}
+		return result, nil
+	}
+
+	aggs, err := stats.StatBuckets(ctx, bq)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[repository.BucketKey]map[string]float64, len(aggs))
+	for key, a := range aggs {
+		result[key] = map[string]float64{"count": a.Count, "avg": a.Avg, "min": a.Min, "max": a.Max, "sum": a.Sum}
+	}
+	return result, nil
+}
+
+func aggregate(values []float64, aggs []string) map[string]float64 {
+	sort.Float64s(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	result := map[string]float64{
+		"count": float64(len(values)),
+		"sum":   sum,
+		"avg":   sum / float64(len(values)),
+		"min":   values[0],
+		"max":   values[len(values)-1],
+	}
+	for _, agg := range aggs {
+		if p, ok := parsePercentile(agg); ok {
+			result[agg] = percentile(values, p)
+		}
+	}
+	return result
+}
+
+// 线性插值计算百分位数，values 必须已排序
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 1 {
+		return values[0]
+	}
+	rank := p * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
+
+// 按容器、字段、聚合方式生成曲线，并按 fill 填充没有数据的桶
+func buildSeries(q *seriesQuery, buckets map[repository.BucketKey]map[string]float64, fill string) []Series {
+	stepSeconds := int64(q.step / time.Second)
+	first := floorDiv(q.from.Unix(), stepSeconds)
+	last := floorDiv(q.to.Add(-time.Nanosecond).Unix(), stepSeconds)
+
+	series := []Series{}
+	for _, id := range q.ids {
+		for _, metric := range q.metrics {
+			for _, agg := range q.aggs {
+				s := Series{ContainerID: id, Metric: metric, Agg: agg, Points: make([][2]any, 0, last-first+1)}
+				var previous any
+				for bucket := first; bucket <= last; bucket++ {
+					var value any
+					if values, ok := buckets[repository.BucketKey{ContainerID: id, Metric: metric, Bucket: bucket}]; ok {
+						value = values[agg]
+						previous = value
+					} else if fill == "zero" {
+						value = 0.0
+					} else if fill == "previous" {
+						value = previous
+					}
+					s.Points = append(s.Points, [2]any{bucket * stepSeconds * 1000, value})
+				}
+				series = append(series, s)
+			}
+		}
+	}
+	return series
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-mysti/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	checker *health.Checker
+}
+
+// RegisterHealthRoutes 注册 Kubernetes 探针使用的接口
+//
+//	livenessProbe:  httpGet /healthz
+//	readinessProbe: httpGet /readyz
+func RegisterHealthRoutes(checker *health.Checker, router *gin.RouterGroup) HealthController {
+	ctl := HealthController{checker: checker}
+	router.GET("/healthz", ctl.healthz)
+	router.GET("/readyz", ctl.readyz)
+
+	return ctl
+}
+
+// GET /healthz 只表示进程存活，不检查依赖，避免依赖故障时进程被反复重启
+func (ctl HealthController) healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// GET /readyz 所有依赖检查通过时返回 200，否则返回 503
+func (ctl HealthController) readyz(ctx *gin.Context) {
+	results, ok := ctl.checker.Run(ctx.Request.Context())
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "fail", http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, gin.H{"status": status, "checks": results})
+}
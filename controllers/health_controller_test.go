@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-mysti/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := health.Check{Name: "mysql", Run: func(context.Context) error { return nil }}
+	down := health.Check{Name: "redis", Run: func(context.Context) error { return errors.New("connection refused") }}
+
+	for _, tc := range []struct {
+		name   string
+		checks []health.Check
+		code   int
+		status string
+	}{
+		{"ready", []health.Check{ok}, http.StatusOK, "ok"},
+		{"dependency down", []health.Check{ok, down}, http.StatusServiceUnavailable, "fail"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := gin.New()
+			RegisterHealthRoutes(health.NewChecker(time.Second, time.Second, tc.checks...), engine.Group("/"))
+
+			var body struct {
+				Status string                   `json:"status"`
+				Checks map[string]health.Result `json:"checks"`
+			}
+			w := doGet(t, engine, "/readyz", nil)
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tc.code || body.Status != tc.status || len(body.Checks) != len(tc.checks) {
+				t.Errorf("GET /readyz = %d %s", w.Code, w.Body.String())
+			}
+			if w := doGet(t, engine, "/healthz", nil); w.Code != http.StatusOK {
+				t.Errorf("GET /healthz = %d", w.Code)
+			}
+		})
+	}
+}
@@ -1,24 +1,238 @@
 package controllers
 
 import (
-	"database/sql"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/config"
+	"go-mysti/middleware"
+	"go-mysti/repository"
+	"go-mysti/svgchart"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// 未选择容器时最多展示的容器数
+	maxDashboardPanels = 8
+	dashboardTimeInput = "2006-01-02T15:04"
+)
+
+var (
+	dashboardRanges = []string{"15m", "1h", "6h", "24h", "7d"}
+	// 自动刷新间隔（秒），0 表示关闭
+	dashboardRefreshes = []int{0, 10, 30, 60, 300}
+)
+
 type IndexController struct {
-	db *sql.DB
+	containers repository.Containers
+	statRepo   repository.Stats
+	retention  config.RetentionConfig
+}
+
+// 一个容器的图表
+type dashboardPanel struct {
+	ID     string
+	Name   string
+	CPU    template.HTML
+	Memory template.HTML
 }
 
-func RegisterRoutes(db *sql.DB, router *gin.RouterGroup) IndexController {
-	ctl := IndexController{db: db}
+func RegisterRoutes(repo repository.Repository, retention config.RetentionConfig, router *gin.RouterGroup) IndexController {
+	ctl := IndexController{containers: repo, statRepo: repo, retention: retention}
 	router.GET("/", ctl.index)
 
 	return ctl
 }
 
+// TemplateFuncs 返回页面模板使用的函数
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"formatAsDate": func(t time.Time) string {
+			return t.Format("02/01/2006")
+		},
+		"formatTime": func(t time.Time) string {
+			return t.UTC().Format("2006-01-02 15:04:05")
+		},
+		// 表单中的 CSRF 隐藏字段：{{ csrfField .csrfToken }}
+		"csrfField": func(token string) template.HTML {
+			return template.HTML(`<input type="hidden" name="` + middleware.CSRFFormField + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+		"shortID": func(id string) string {
+			if len(id) > 12 {
+				return id[:12]
+			}
+			return id
+		},
+	}
+}
+
+// GET /?id=&range=1h&from=&to=&refresh=30
 func (ctl *IndexController) index(ctx *gin.Context) {
-	ctx.HTML(200, "posts/edit/index.html", gin.H{
-		"title": "Main website",
-	})
+	data := pageData(ctx, "Container stats")
+	data["ranges"] = dashboardRanges
+	data["refreshes"] = dashboardRefreshes
+
+	// 参数错误时仍然展示表单，方便修改
+	q, err := parseDashboardQuery(ctx)
+	if err != nil {
+		data["error"] = err.Error()
+		ctx.HTML(http.StatusBadRequest, "dashboard/index.html", data)
+		return
+	}
+	data["range"] = q.rangeName
+	data["refresh"] = q.refresh
+	data["from"] = q.series.from
+	data["to"] = q.series.to
+	// 只有明确指定 from/to 时才回填，否则切换 range 不会生效
+	if ctx.Query("from") != "" || ctx.Query("to") != "" {
+		data["fromInput"] = q.series.from.Format(dashboardTimeInput)
+		data["toInput"] = q.series.to.Format(dashboardTimeInput)
+	}
+	data["step"] = q.series.step.String()
+
+	containers, err := ctl.containers.ListContainers(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	data["containers"] = containers
+
+	// 未选择容器时展示前几个
+	names := make(map[string]string, len(containers))
+	for _, c := range containers {
+		names[c.ID] = c.Name
+	}
+	if len(q.series.ids) == 0 {
+		for _, c := range containers[:min(len(containers), maxDashboardPanels)] {
+			q.series.ids = append(q.series.ids, c.ID)
+		}
+	}
+	selected := make(map[string]bool, len(q.series.ids))
+	for _, id := range q.series.ids {
+		selected[id] = true
+	}
+	data["selected"] = selected
+
+	var panels []dashboardPanel
+	if len(q.series.ids) > 0 {
+		if err := chooseTable(ctx.Request.Context(), ctl.statRepo, ctl.retention, q.series); err != nil {
+			ctx.Error(apperror.Internal(err))
+			return
+		}
+		buckets, err := queryBuckets(ctx.Request.Context(), ctl.statRepo, q.series)
+		if err != nil {
+			ctx.Error(apperror.Internal(err))
+			return
+		}
+		panels = buildDashboardPanels(q.series, buckets, names)
+	}
+	data["panels"] = panels
+
+	ctx.HTML(http.StatusOK, "dashboard/index.html", data)
+}
+
+type dashboardQuery struct {
+	rangeName string
+	refresh   int
+	series    *seriesQuery
+}
+
+func parseDashboardQuery(ctx *gin.Context) (*dashboardQuery, error) {
+	q := &dashboardQuery{
+		rangeName: ctx.DefaultQuery("range", "1h"),
+		series: &seriesQuery{
+			metrics: []string{"cpu_percent", "mem_usage"},
+			aggs:    []string{"avg", "max"},
+		},
+	}
+	if !slices.Contains(dashboardRanges, q.rangeName) {
+		return nil, errInvalidParam("range", q.rangeName)
+	}
+	if raw := ctx.Query("refresh"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || !slices.Contains(dashboardRefreshes, n) {
+			return nil, errInvalidParam("refresh", raw)
+		}
+		q.refresh = n
+	}
+
+	span := parseRangeName(q.rangeName)
+	q.series.to = time.Now().UTC()
+	if raw := ctx.Query("to"); raw != "" {
+		t, err := time.Parse(dashboardTimeInput, raw)
+		if err != nil {
+			return nil, errInvalidParam("to", raw)
+		}
+		q.series.to = t
+	}
+	q.series.from = q.series.to.Add(-span)
+	if raw := ctx.Query("from"); raw != "" {
+		t, err := time.Parse(dashboardTimeInput, raw)
+		if err != nil {
+			return nil, errInvalidParam("from", raw)
+		}
+		q.series.from = t
+	}
+	if !q.series.from.Before(q.series.to) {
+		return nil, errInvalidParam("from", ctx.Query("from"))
+	}
+	// 图表宽度有限，点数控制在 240 以内
+	q.series.step = capStep(q.series.from, q.series.to, 0, 240)
+
+	for _, id := range ctx.QueryArray("id") {
+		if id != "" && !slices.Contains(q.series.ids, id) && len(q.series.ids) < maxSeriesContainers {
+			q.series.ids = append(q.series.ids, id)
+		}
+	}
+	return q, nil
+}
+
+func parseRangeName(name string) time.Duration {
+	if days, ok := strings.CutSuffix(name, "d"); ok {
+		n, _ := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour
+	}
+	d, _ := time.ParseDuration(name)
+	return d
+}
+
+func buildDashboardPanels(q *seriesQuery, buckets map[repository.BucketKey]map[string]float64, names map[string]string) []dashboardPanel {
+	all := buildSeries(q, buckets, "null")
+	hundred := 100.0
+
+	panels := make([]dashboardPanel, 0, len(q.ids))
+	for _, id := range q.ids {
+		cpu := &svgchart.Chart{Title: "CPU", Width: 560, Height: 220, FormatValue: svgchart.FormatPercent, MaxY: &hundred}
+		memory := &svgchart.Chart{Title: "Memory", Width: 560, Height: 220, FormatValue: svgchart.FormatBytes}
+		for _, s := range all {
+			if s.ContainerID != id {
+				continue
+			}
+			chartSeries := svgchart.Series{Name: s.Agg, Points: toChartPoints(s.Points)}
+			if s.Metric == "cpu_percent" {
+				cpu.Series = append(cpu.Series, chartSeries)
+			} else {
+				memory.Series = append(memory.Series, chartSeries)
+			}
+		}
+		panels = append(panels, dashboardPanel{ID: id, Name: names[id], CPU: cpu.Render(), Memory: memory.Render()})
+	}
+	return panels
+}
+
+func toChartPoints(points [][2]any) []svgchart.Point {
+	result := make([]svgchart.Point, len(points))
+	for i, p := range points {
+		result[i].Time = time.UnixMilli(p[0].(int64)).UTC()
+		if v, ok := p[1].(float64); ok {
+			result[i].Value = &v
+		}
+	}
+	return result
 }
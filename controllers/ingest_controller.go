@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/config"
+	"go-mysti/ingest"
+	"go-mysti/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 最多记住的 Idempotency-Key 数量
+const maxIdempotencyKeys = 100000
+
+type IngestController struct {
+	batcher      *ingest.Batcher
+	keys         *ingest.IdempotencyCache
+	maxBodyBytes int64
+}
+
+func RegisterIngestRoutes(batcher *ingest.Batcher, cfg config.IngestConfig, router *gin.RouterGroup) IngestController {
+	ctl := IngestController{
+		batcher:      batcher,
+		keys:         ingest.NewIdempotencyCache(cfg.IdempotencyTTL, maxIdempotencyKeys),
+		maxBodyBytes: int64(cfg.MaxBodyBytes),
+	}
+	router.POST("/container-stats", ctl.containerStats)
+
+	return ctl
+}
+
+// POST /api/ingest/container-stats
+//
+// 请求体为 JSON 数组或 NDJSON，可以使用 Content-Encoding: gzip 压缩。
+// 通过校验的行进入写入队列后返回 202，队列已满时返回 429，客户端应按 Retry-After 重试。
+// 带 Idempotency-Key 的重试返回第一次的响应，同一个用户用同一个 key 发送不同的请求体时返回 422。
+func (ctl IngestController) containerStats(ctx *gin.Context) {
+	key := strings.TrimSpace(ctx.GetHeader("Idempotency-Key"))
+	if key != "" {
+		fingerprint, err := ctl.fingerprint(ctx)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		// 不同用户的 key 互不影响
+		key = idempotencyScope(ctx) + "\x00" + key
+		cached, inflight, err := ctl.keys.Begin(key, fingerprint)
+		if errors.Is(err, ingest.ErrKeyReused) {
+			ctx.Error(apperror.Wrap(err, http.StatusUnprocessableEntity, "idempotency_key_reused", err.Error()))
+			return
+		}
+		if inflight {
+			ctx.Error(apperror.New(http.StatusConflict, "idempotency_conflict", "a request with this Idempotency-Key is in progress"))
+			return
+		}
+		if cached != nil {
+			ctx.Header("Idempotent-Replayed", "true")
+			ctx.JSON(cached.Status, cached.Body)
+			return
+		}
+	}
+
+	status, body, err := ctl.ingest(ctx)
+	if err != nil {
+		// 错误都是临时性的，允许客户端使用同一个 key 重试
+		if key != "" {
+			ctl.keys.Abort(key)
+		}
+		ctx.Error(err)
+		return
+	}
+
+	if key != "" {
+		ctl.keys.Finish(key, &ingest.Response{Status: status, Body: body})
+	}
+	ctx.JSON(status, body)
+}
+
+// 读取原始请求体并计算摘要，Content-Encoding 也计入摘要；读取后的请求体放回请求中
+func (ctl IngestController) fingerprint(ctx *gin.Context) (string, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, ctl.maxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "", apperror.Wrap(err, http.StatusRequestEntityTooLarge, "body_too_large", err.Error())
+		}
+		return "", apperror.Wrap(err, http.StatusBadRequest, "invalid_body", "invalid body: "+err.Error())
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(data))
+
+	hash := sha256.New()
+	io.WriteString(hash, strings.ToLower(ctx.GetHeader("Content-Encoding"))+"\n")
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// 会话和 bearer token 认证都以用户名标识身份
+func idempotencyScope(ctx *gin.Context) string {
+	if user := middleware.CurrentUser(ctx); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// 返回 202 或 422 的响应体，其余情况返回错误
+func (ctl IngestController) ingest(ctx *gin.Context) (int, gin.H, error) {
+	var body io.Reader = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, ctl.maxBodyBytes)
+	switch strings.ToLower(ctx.GetHeader("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return 0, nil, apperror.Wrap(err, http.StatusBadRequest, "invalid_body", "invalid gzip body: "+err.Error())
+		}
+		defer gz.Close()
+		// 限制解压后的大小
+		body = http.MaxBytesReader(nil, gz, ctl.maxBodyBytes)
+	default:
+		return 0, nil, apperror.New(http.StatusUnsupportedMediaType, "unsupported_encoding", "unsupported Content-Encoding")
+	}
+
+	rows, rowErrors, err := ingest.Decode(body, time.Now())
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return 0, nil, apperror.Wrap(err, http.StatusRequestEntityTooLarge, "body_too_large", err.Error())
+		}
+		return 0, nil, apperror.Wrap(err, http.StatusBadRequest, "invalid_body", "invalid body: "+err.Error())
+	}
+	if rowErrors == nil {
+		rowErrors = []ingest.RowError{}
+	}
+	result := gin.H{"accepted": len(rows), "rejected": len(rowErrors), "errors": rowErrors}
+	if len(rows) == 0 {
+		if len(rowErrors) == 0 {
+			return 0, nil, apperror.BadRequest("invalid_body", "no rows in body")
+		}
+		return http.StatusUnprocessableEntity, result, nil
+	}
+
+	switch err := ctl.batcher.Enqueue(rows); {
+	case errors.Is(err, ingest.ErrQueueFull):
+		ctx.Header("Retry-After", "1")
+		return 0, nil, apperror.Wrap(err, http.StatusTooManyRequests, "queue_full", err.Error())
+	case err != nil:
+		return 0, nil, apperror.Unavailable(err, err.Error())
+	}
+	return http.StatusAccepted, result, nil
+}
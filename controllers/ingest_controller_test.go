@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mysti/config"
+	"go-mysti/ingest"
+	"go-mysti/middleware"
+	"go-mysti/model"
+	"go-mysti/repository/memory"
+	"go-mysti/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 返回写入接口和 alice、bob 两个用户的会话 cookie
+func newTestIngestRouter(t *testing.T, batcher *ingest.Batcher) (http.Handler, map[string]*http.Cookie) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := memory.New()
+	sessions := session.NewManager(session.Options{Secret: []byte(strings.Repeat("x", 32)), CookieName: "session", TTL: time.Hour})
+	cookies := make(map[string]*http.Cookie)
+	for _, name := range []string{"alice", "bob"} {
+		user := &model.User{Username: name}
+		if err := store.CreateUser(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		sessions.New(w, user.ID)
+		cookies[name] = w.Result().Cookies()[0]
+	}
+
+	engine := gin.New()
+	engine.Use(middleware.RequestID())
+	api := engine.Group("/api/ingest", middleware.ProblemErrors(), middleware.Authenticate(sessions, store), middleware.RequireAuth(""))
+	cfg := config.IngestConfig{MaxBodyBytes: 1 << 10, IdempotencyTTL: time.Hour}
+	RegisterIngestRoutes(batcher, cfg, api)
+	return engine, cookies
+}
+
+func ingestRow(id string) string {
+	return `{"time":"` + time.Now().UTC().Format(time.RFC3339) + `","container_id":"` + id + `"}` + "\n"
+}
+
+func postIngest(handler http.Handler, cookie *http.Cookie, body []byte, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/ingest/container-stats", bytes.NewReader(body))
+	r.AddCookie(cookie)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func problemCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var problem middleware.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	return problem.Code
+}
+
+func TestIngest(t *testing.T) {
+	batcher := ingest.NewBatcher(memory.New(), ingest.Options{BatchSize: 10, QueueSize: 10})
+	router, cookies := newTestIngestRouter(t, batcher)
+
+	body := []byte(ingestRow("web") + `{"container_id":"db"}` + "\n")
+	w := postIngest(router, cookies["alice"], body)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"accepted":1`) || !strings.Contains(w.Body.String(), `"rejected":1`) {
+		t.Errorf("POST = %d %s", w.Code, w.Body)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(ingestRow("web")))
+	zw.Close()
+	if w := postIngest(router, cookies["alice"], gz.Bytes(), "Content-Encoding", "gzip"); w.Code != http.StatusAccepted {
+		t.Errorf("gzip POST = %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		header []string
+		status int
+		code   string
+	}{
+		{"all rows invalid", `{"container_id":"db"}`, nil, http.StatusUnprocessableEntity, ""},
+		{"empty array", `[]`, nil, http.StatusBadRequest, "invalid_body"},
+		{"malformed", `[{`, nil, http.StatusBadRequest, "invalid_body"},
+		{"bad gzip", "plain", []string{"Content-Encoding", "gzip"}, http.StatusBadRequest, "invalid_body"},
+		{"unknown encoding", "x", []string{"Content-Encoding", "br"}, http.StatusUnsupportedMediaType, "unsupported_encoding"},
+		{"too large", "[" + strings.Repeat(" ", 2<<10) + "]", nil, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"too large with key", "[" + strings.Repeat(" ", 2<<10) + "]", []string{"Idempotency-Key", "big"}, http.StatusRequestEntityTooLarge, "body_too_large"},
+	}
+	for _, tt := range tests {
+		w := postIngest(router, cookies["alice"], []byte(tt.body), tt.header...)
+		if w.Code != tt.status || tt.code != "" && problemCode(t, w) != tt.code {
+			t.Errorf("%s: %d %s", tt.name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestIngestQueueFull(t *testing.T) {
+	// 先不运行 Run，队列只进不出
+	batcher := ingest.NewBatcher(memory.New(), ingest.Options{BatchSize: 2, QueueSize: 2})
+	router, cookies := newTestIngestRouter(t, batcher)
+
+	body := []byte(ingestRow("web") + ingestRow("db"))
+	if w := postIngest(router, cookies["alice"], body, "Idempotency-Key", "k1"); w.Code != http.StatusAccepted {
+		t.Fatalf("first POST = %d %s", w.Code, w.Body)
+	}
+	w := postIngest(router, cookies["alice"], body, "Idempotency-Key", "k2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" || problemCode(t, w) != "queue_full" {
+		t.Errorf("POST with full queue = %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	// 429 不缓存，队列有空间后可以用同一个 key 重试
+	go batcher.Run()
+	defer batcher.Close()
+	deadline := time.Now().Add(time.Second)
+	for batcher.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if w := postIngest(router, cookies["alice"], body, "Idempotency-Key", "k2"); w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestIngestIdempotency(t *testing.T) {
+	batcher := ingest.NewBatcher(memory.New(), ingest.Options{BatchSize: 100, QueueSize: 100})
+	router, cookies := newTestIngestRouter(t, batcher)
+
+	body := []byte(ingestRow("web"))
+	first := postIngest(router, cookies["alice"], body, "Idempotency-Key", "k1")
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("first POST = %d %s", first.Code, first.Body)
+	}
+
+	replay := postIngest(router, cookies["alice"], body, "Idempotency-Key", "k1")
+	if replay.Code != http.StatusAccepted || replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %v %s", replay.Code, replay.Header(), replay.Body)
+	}
+	if n := batcher.Pending(); n != 1 {
+		t.Errorf("pending = %d, replay was enqueued again", n)
+	}
+
+	// 同一个 key 用于不同的请求体
+	w := postIngest(router, cookies["alice"], []byte(ingestRow("db")), "Idempotency-Key", "k1")
+	if w.Code != http.StatusUnprocessableEntity || problemCode(t, w) != "idempotency_key_reused" {
+		t.Errorf("different body = %d %s", w.Code, w.Body)
+	}
+
+	// 其他用户的同名 key 互不影响
+	w = postIngest(router, cookies["bob"], []byte(ingestRow("db")), "Idempotency-Key", "k1")
+	if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("other user = %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	if n := batcher.Pending(); n != 2 {
+		t.Errorf("pending = %d", n)
+	}
+}
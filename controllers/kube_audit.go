@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/audit"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
+	"go-mysti/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorize 保存解析后的请求属性，审计时使用
+const kubeRequestKey = "kube_request"
+
+// 路径过长时截断，与 kube_audit_log.path 的长度一致
+const maxAuditPathLength = 1024
+
+// 审计需要先读完请求体计算摘要，超过上限的请求直接拒绝，API server 默认的上限为 3MiB
+const maxAuditBodySize = 8 << 20
+
+// audit 在请求结束后记录审计日志，watch、exec 等长连接在断开时记录
+func (ctrl KubeController) audit(ctx *gin.Context) {
+	if ctrl.recorder == nil {
+		ctx.Next()
+		return
+	}
+	start := time.Now()
+	// 先读完请求体，被拒绝或只转发了一部分的请求也记录完整请求体的摘要
+	bodySHA256, err := hashRequestBody(ctx.Request)
+	switch {
+	case errors.Is(err, errAuditBodyTooLarge):
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, kubeauth.NewStatus(http.StatusRequestEntityTooLarge, "RequestEntityTooLarge",
+			fmt.Sprintf("request body is larger than %d bytes", maxAuditBodySize)))
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, kubeauth.NewStatus(http.StatusBadRequest, "BadRequest", "read request body: "+err.Error()))
+	default:
+		ctx.Next()
+	}
+
+	value, _ := ctx.Get(kubeRequestKey)
+	info, _ := value.(kubeauth.RequestInfo)
+	if info.Path == "" {
+		// 路径不合法或没有执行到 authorize 时没有解析结果
+		info = kubeauth.RequestInfo{Cluster: ctx.Param("cluster"), Path: ctx.Param("kubernetesPath"), Verb: strings.ToLower(ctx.Request.Method)}
+	}
+	entry := newAuditEntry(ctx, info, responseStatus(ctx), time.Since(start))
+	entry.BodySHA256 = bodySHA256
+	ctrl.recorder.Record(entry)
+}
+
+var errAuditBodyTooLarge = errors.New("request body too large")
+
+// hashRequestBody 读完请求体并计算 SHA-256，读取的内容放回请求中继续转发；没有请求体时返回空字符串
+func hashRequestBody(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBodySize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxAuditBodySize {
+		return "", errAuditBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if len(data) == 0 {
+		return "", nil
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func newAuditEntry(ctx *gin.Context, info kubeauth.RequestInfo, status int, latency time.Duration) model.AuditEntry {
+	entry := model.AuditEntry{
+		Time:        time.Now().UTC().Add(-latency),
+		Cluster:     info.Cluster,
+		ClientIP:    ctx.ClientIP(),
+		Verb:        info.Verb,
+		Method:      ctx.Request.Method,
+		Path:        info.Path,
+		APIGroup:    info.APIGroup,
+		Resource:    info.Resource,
+		Subresource: info.Subresource,
+		Namespace:   info.Namespace,
+		Name:        info.Name,
+		StatusCode:  status,
+		LatencyMS:   latency.Milliseconds(),
+		RequestID:   middleware.GetRequestID(ctx),
+	}
+	if user := middleware.CurrentUser(ctx); user != nil {
+		entry.Username = user.Username
+	}
+	if len(entry.Path) > maxAuditPathLength {
+		entry.Path = entry.Path[:maxAuditPathLength]
+	}
+	return entry
+}
+
+// 错误由外层的错误处理中间件渲染，此时还没有写入响应
+func responseStatus(ctx *gin.Context) int {
+	if !ctx.Writer.Written() && len(ctx.Errors) > 0 {
+		return apperror.From(ctx.Errors.Last().Err).Status
+	}
+	return ctx.Writer.Status()
+}
+
+// recordKubeAction 把资源浏览页面执行的操作按等价的 API 请求记录，handler 返回错误时使用错误的状态码
+func recordKubeAction(ctx *gin.Context, recorder audit.Recorder, method string, info kubeauth.RequestInfo, start time.Time) {
+	if recorder == nil {
+		return
+	}
+	status := http.StatusOK
+	if len(ctx.Errors) > 0 {
+		status = apperror.From(ctx.Errors.Last().Err).Status
+	}
+	entry := newAuditEntry(ctx, info, status, time.Since(start))
+	entry.Method = method
+	recorder.Record(entry)
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mysti "go-mysti"
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
+	"go-mysti/model"
+	"go-mysti/repository/memory"
+	"go-mysti/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 记录在请求处理完后写入，响应可能先到达客户端，使用 channel 等待
+type chanRecorder chan model.AuditEntry
+
+func (r chanRecorder) Record(entry model.AuditEntry) { r <- entry }
+
+func (r chanRecorder) next(t *testing.T) model.AuditEntry {
+	t.Helper()
+	select {
+	case e := <-r:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audit entry recorded")
+		return model.AuditEntry{}
+	}
+}
+
+func TestKubeProxyAudit(t *testing.T) {
+	cluster, err := kube.NewCluster("prod", newFakeAPIServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &kubeauth.Policy{Rules: []kubeauth.Rule{
+		{Roles: []string{"dev"}, Verbs: []string{"create"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, Namespaces: []string{"dev"}},
+	}}
+	recorder := make(chanRecorder, 10)
+	url, cookie := newTestKubeRouter(t, kube.Clusters{cluster}, policy, nil, recorder, &model.User{Username: "bob", Roles: []string{"dev"}})
+
+	do := func(method, path, body string) int {
+		req, _ := http.NewRequest(method, url+path, strings.NewReader(body))
+		req.AddCookie(cookie)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	body := `{"metadata":{"name":"app"}}`
+	if code := do(http.MethodPost, "/kube/prod/api/v1/namespaces/dev/configmaps", body); code != http.StatusCreated {
+		t.Fatalf("create = %d", code)
+	}
+	sum := sha256.Sum256([]byte(body))
+	e := recorder.next(t)
+	if e.Username != "bob" || e.Cluster != "prod" || e.Verb != "create" || e.Method != http.MethodPost || e.Resource != "configmaps" ||
+		e.Namespace != "dev" || e.Path != "/api/v1/namespaces/dev/configmaps" || e.StatusCode != http.StatusCreated ||
+		e.BodySHA256 != hex.EncodeToString(sum[:]) || e.ClientIP == "" || e.RequestID == "" {
+		t.Errorf("entry = %+v", e)
+	}
+
+	// 被拒绝的请求也要记录完整请求体的摘要
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/kube/prod/api/v1/namespaces/prod/configmaps", body},
+		{http.MethodDelete, "/kube/prod/api/v1/namespaces/dev/configmaps/app", `{"propagationPolicy":"Foreground"}`},
+		{http.MethodPatch, "/kube/prod/api/v1/namespaces/dev/configmaps/app", `{"data":{"key":"value"}}`},
+	} {
+		if code := do(tc.method, tc.path, tc.body); code != http.StatusForbidden {
+			t.Fatalf("%s %s = %d", tc.method, tc.path, code)
+		}
+		sum := sha256.Sum256([]byte(tc.body))
+		if e := recorder.next(t); e.Method != tc.method || e.StatusCode != http.StatusForbidden || e.BodySHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("forbidden %s entry = %+v", tc.method, e)
+		}
+	}
+
+	// 请求体超过上限时拒绝，不转发
+	if code := do(http.MethodPost, "/kube/prod/api/v1/namespaces/dev/configmaps", strings.Repeat("x", maxAuditBodySize+1)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body = %d, want 413", code)
+	}
+	if e := recorder.next(t); e.StatusCode != http.StatusRequestEntityTooLarge || e.BodySHA256 != "" {
+		t.Errorf("large body entry = %+v", e)
+	}
+}
+
+func TestAuditAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := memory.New()
+	admin := &model.User{Username: "admin", Roles: []string{"admin"}}
+	viewer := &model.User{Username: "alice", Roles: []string{"viewer"}}
+	for _, u := range []*model.User{admin, viewer} {
+		if err := store.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	var entries []model.AuditEntry
+	for i := range 5 {
+		entries = append(entries, model.AuditEntry{Time: now.Add(time.Duration(i-5) * time.Minute), Username: "bob", Verb: "get", Namespace: "dev", StatusCode: 200})
+	}
+	entries = append(entries,
+		model.AuditEntry{Time: now.Add(-time.Minute), Username: "carol", Verb: "delete", Namespace: "prod", StatusCode: 403},
+		model.AuditEntry{Time: now.Add(-48 * time.Hour), Username: "carol", Verb: "delete", Namespace: "prod", StatusCode: 200},
+	)
+	if err := store.InsertAuditEntries(ctx, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := session.NewManager(session.Options{Secret: []byte(strings.Repeat("x", 32)), CookieName: "session", TTL: time.Hour})
+	engine := gin.New()
+	engine.SetHTMLTemplate(template.Must(mysti.BuildTemplate("assets/templates", TemplateFuncs())))
+	api := engine.Group("/", middleware.ProblemErrors(), middleware.Authenticate(sessions, store), middleware.RequireAuth(""))
+	pages := engine.Group("/", middleware.HTMLErrors("error/error.html"), middleware.Authenticate(sessions, store), middleware.RequireAuth("/login"))
+	RegisterAuditRoutes(store, api.Group("/api/kube/audit"), pages)
+
+	get := func(user *model.User, path string) (int, string) {
+		w := httptest.NewRecorder()
+		sessions.New(w, user.ID)
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(w.Result().Cookies()[0])
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	list := func(query string) ([]model.AuditEntry, string) {
+		code, body := get(admin, "/api/kube/audit?"+query)
+		if code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", query, code, body)
+		}
+		var resp struct {
+			Items      []model.AuditEntry `json:"items"`
+			NextCursor string             `json:"next_cursor"`
+		}
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Items, resp.NextCursor
+	}
+
+	if items, _ := list("user=carol"); len(items) != 1 || items[0].StatusCode != 403 {
+		t.Errorf("user=carol = %+v", items)
+	}
+	if items, _ := list("min_status=400"); len(items) != 1 || items[0].Username != "carol" {
+		t.Errorf("min_status=400 = %+v", items)
+	}
+	if items, _ := list("from=" + now.Add(-72*time.Hour).Format(time.RFC3339) + "&namespace=prod"); len(items) != 2 {
+		t.Errorf("namespace=prod in 3 days = %+v", items)
+	}
+
+	// 按 ID 倒序翻页
+	first, cursor := list("user=bob&limit=3")
+	second, last := list("user=bob&limit=3&cursor=" + cursor)
+	if len(first) != 3 || len(second) != 2 || last != "" || first[2].ID <= second[0].ID {
+		t.Errorf("pages = %+v %+v, cursor %q", first, second, last)
+	}
+
+	if code, _ := get(admin, "/api/kube/audit?min_status=abc"); code != http.StatusBadRequest {
+		t.Errorf("invalid min_status = %d", code)
+	}
+	if code, _ := get(viewer, "/api/kube/audit"); code != http.StatusForbidden {
+		t.Errorf("viewer = %d", code)
+	}
+	if code, body := get(admin, "/audit?verb=delete"); code != http.StatusOK || !strings.Contains(body, "carol") || strings.Contains(body, "<td>bob</td>") {
+		t.Errorf("page = %d %s", code, body)
+	}
+}
@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-mysti/apperror"
+	"go-mysti/audit"
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
+	"go-mysti/model"
+
+	"github.com/gin-gonic/gin"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubeBrowserController 是 Kubernetes 资源浏览页面
+//
+// 页面使用服务自己的凭据访问 API server，每个操作前按 /kube 代理的限制和策略检查当前用户的权限。
+type KubeBrowserController struct {
+	clusters     kube.Clusters
+	policy       *kubeauth.Policy
+	restrictions *kubeauth.Restrictions
+	recorder     audit.Recorder
+}
+
+// 所有者链接，Via 是中间的 ReplicaSet 等不能浏览的对象
+type ownerLink struct {
+	Kind string
+	Name string
+	Link string
+	Via  string
+}
+
+// RegisterKubeBrowserRoutes 注册资源浏览页面，router 需要登录
+//
+// 删除等修改操作交给 recorder 记录，restrictions 和 recorder 可以为 nil。
+func RegisterKubeBrowserRoutes(clusters kube.Clusters, policy *kubeauth.Policy, restrictions *kubeauth.Restrictions, recorder audit.Recorder, router *gin.RouterGroup) KubeBrowserController {
+	ctl := KubeBrowserController{clusters: clusters, policy: policy, restrictions: restrictions, recorder: recorder}
+	router.GET("/clusters", ctl.index)
+	router.GET("/clusters/:cluster", ctl.redirectToNamespaces)
+	router.GET("/clusters/:cluster/namespaces", ctl.namespaces)
+	router.GET("/clusters/:cluster/namespaces/:namespace", ctl.redirectToPods)
+	router.GET("/clusters/:cluster/namespaces/:namespace/:resource", ctl.list)
+	router.GET("/clusters/:cluster/namespaces/:namespace/:resource/:name", ctl.detail)
+	router.POST("/clusters/:cluster/namespaces/:namespace/pods/:name/delete", middleware.VerifyCSRF(), ctl.deletePod)
+	router.POST("/clusters/:cluster/namespaces/:namespace/pods/:name/restart", middleware.VerifyCSRF(), ctl.restartPod)
+
+	return ctl
+}
+
+// GET /clusters 跳转到第一个有权限的集群
+func (ctl KubeBrowserController) index(ctx *gin.Context) {
+	names := ctl.allowedClusters(middleware.CurrentUser(ctx))
+	if len(names) == 0 {
+		ctx.Error(apperror.NotFound("no kubernetes clusters are available"))
+		return
+	}
+	ctx.Redirect(http.StatusFound, resourcePath(names[0], "", "", ""))
+}
+
+func (ctl KubeBrowserController) redirectToNamespaces(ctx *gin.Context) {
+	ctx.Redirect(http.StatusFound, resourcePath(ctx.Param("cluster"), "", "", ""))
+}
+
+func (ctl KubeBrowserController) redirectToPods(ctx *gin.Context) {
+	ctx.Redirect(http.StatusFound, resourcePath(ctx.Param("cluster"), ctx.Param("namespace"), "pods", ""))
+}
+
+// GET /clusters/{cluster}/namespaces
+func (ctl KubeBrowserController) namespaces(ctx *gin.Context) {
+	cluster, user := ctl.cluster(ctx)
+	if cluster == nil {
+		return
+	}
+	r := findKubeResource("namespaces")
+	if !ctl.require(ctx, user, ctl.request(cluster, r, "list", "", "", "")) {
+		return
+	}
+	rows, err := r.list(ctx.Request.Context(), cluster.Client, "")
+	if err != nil {
+		ctx.Error(kubeAPIError(err))
+		return
+	}
+	for i := range rows {
+		rows[i].Link = resourcePath(cluster.Name, rows[i].Name, "pods", "")
+	}
+	data := ctl.pageData(ctx, cluster, user, "", "Namespaces")
+	data["resource"] = r
+	data["rows"] = rows
+	ctx.HTML(http.StatusOK, "kube/resources.html", data)
+}
+
+// GET /clusters/{cluster}/namespaces/{namespace}/{resource}
+func (ctl KubeBrowserController) list(ctx *gin.Context) {
+	cluster, user := ctl.cluster(ctx)
+	if cluster == nil {
+		return
+	}
+	r := findKubeResource(ctx.Param("resource"))
+	if r == nil || !r.Namespaced {
+		ctx.Error(apperror.NotFound(fmt.Sprintf("resource %q is not supported", ctx.Param("resource"))))
+		return
+	}
+	namespace := ctx.Param("namespace")
+	if !ctl.require(ctx, user, ctl.request(cluster, r, "list", namespace, "", "")) {
+		return
+	}
+	rows, err := r.list(ctx.Request.Context(), cluster.Client, namespace)
+	if err != nil {
+		ctx.Error(kubeAPIError(err))
+		return
+	}
+	for i := range rows {
+		rows[i].Link = resourcePath(cluster.Name, namespace, r.Resource, rows[i].Name)
+		// 事件链接到关联的对象
+		if rows[i].objectKind != "" {
+			rows[i].Link = ""
+			if target := findKubeKind(rows[i].objectKind); target != nil && target.Namespaced {
+				rows[i].Link = resourcePath(cluster.Name, namespace, target.Resource, rows[i].objectName)
+			}
+		}
+	}
+	data := ctl.pageData(ctx, cluster, user, namespace, r.Kind+"s")
+	data["resource"] = r
+	data["rows"] = rows
+	ctx.HTML(http.StatusOK, "kube/resources.html", data)
+}
+
+// GET /clusters/{cluster}/namespaces/{namespace}/{resource}/{name}
+func (ctl KubeBrowserController) detail(ctx *gin.Context) {
+	cluster, user := ctl.cluster(ctx)
+	if cluster == nil {
+		return
+	}
+	r := findKubeResource(ctx.Param("resource"))
+	if r == nil || r.get == nil {
+		ctx.Error(apperror.NotFound(fmt.Sprintf("resource %q is not supported", ctx.Param("resource"))))
+		return
+	}
+	namespace, name := ctx.Param("namespace"), ctx.Param("name")
+	if !ctl.require(ctx, user, ctl.request(cluster, r, "get", namespace, "", name)) {
+		return
+	}
+	obj, err := r.get(ctx.Request.Context(), cluster.Client, namespace, name)
+	if err != nil {
+		ctx.Error(kubeAPIError(err))
+		return
+	}
+	text, err := resourceYAML(r, obj, ctl.restrictions)
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		ctx.Error(apperror.Internal(err))
+		return
+	}
+
+	data := ctl.pageData(ctx, cluster, user, namespace, r.Kind+" "+name)
+	data["resource"] = r
+	data["name"] = name
+	data["yaml"] = text
+	data["age"] = age(accessor.GetCreationTimestamp())
+	data["owners"] = ctl.ownerLinks(ctx.Request.Context(), cluster, user, namespace, accessor.GetOwnerReferences())
+	switch obj := obj.(type) {
+	case *corev1.Pod:
+		canDelete := ctl.allowed(user, ctl.request(cluster, r, "delete", namespace, "", name))
+		data["status"] = podStatus(obj)
+		data["containers"] = obj.Spec.Containers
+		data["canExec"] = ctl.allowed(user, ctl.request(cluster, r, "create", namespace, "exec", name))
+		data["canDelete"] = canDelete
+		// 只有由控制器管理的 pod 删除后会重新创建
+		data["canRestart"] = canDelete && metav1.GetControllerOf(obj) != nil
+	case *appsv1.Deployment:
+		data["status"] = deploymentStatus(obj)
+	}
+	ctx.HTML(http.StatusOK, "kube/resource.html", data)
+}
+
+// POST /clusters/{cluster}/namespaces/{namespace}/pods/{name}/delete
+func (ctl KubeBrowserController) deletePod(ctx *gin.Context) {
+	ctl.removePod(ctx, false)
+}
+
+// POST /clusters/{cluster}/namespaces/{namespace}/pods/{name}/restart
+//
+// 删除由控制器管理的 pod，控制器会创建新的 pod
+func (ctl KubeBrowserController) restartPod(ctx *gin.Context) {
+	ctl.removePod(ctx, true)
+}
+
+func (ctl KubeBrowserController) removePod(ctx *gin.Context, restart bool) {
+	cluster, user := ctl.cluster(ctx)
+	if cluster == nil {
+		return
+	}
+	namespace, name := ctx.Param("namespace"), ctx.Param("name")
+	info := ctl.request(cluster, findKubeResource("pods"), "delete", namespace, "", name)
+	defer recordKubeAction(ctx, ctl.recorder, http.MethodDelete, info, time.Now())
+	if !ctl.require(ctx, user, info) {
+		return
+	}
+	pods := cluster.Client.CoreV1().Pods(namespace)
+	if restart {
+		pod, err := pods.Get(ctx.Request.Context(), name, metav1.GetOptions{})
+		if err != nil {
+			ctx.Error(kubeAPIError(err))
+			return
+		}
+		if metav1.GetControllerOf(pod) == nil {
+			ctx.Error(apperror.BadRequest("not_controlled", "pod is not managed by a controller and would not be recreated"))
+			return
+		}
+	}
+	if err := pods.Delete(ctx.Request.Context(), name, metav1.DeleteOptions{}); err != nil {
+		ctx.Error(kubeAPIError(err))
+		return
+	}
+	ctx.Redirect(http.StatusSeeOther, resourcePath(cluster.Name, namespace, "pods", ""))
+}
+
+// cluster 返回路径中的集群和当前用户，集群不存在或没有权限时返回 404
+func (ctl KubeBrowserController) cluster(ctx *gin.Context) (*kube.Cluster, *model.User) {
+	name := ctx.Param("cluster")
+	user := middleware.CurrentUser(ctx)
+	cluster := ctl.clusters.Get(name)
+	if cluster == nil || user == nil || !ctl.policy.AllowsCluster(user, name) {
+		ctx.Error(apperror.NotFound(fmt.Sprintf("cluster %q not found", name)))
+		return nil, nil
+	}
+	return cluster, user
+}
+
+func (ctl KubeBrowserController) allowedClusters(user *model.User) []string {
+	var names []string
+	for _, cluster := range ctl.clusters {
+		if user != nil && ctl.policy.AllowsCluster(user, cluster.Name) {
+			names = append(names, cluster.Name)
+		}
+	}
+	return names
+}
+
+// request 返回与通过 /kube 代理执行同一操作时相同的请求属性
+func (ctl KubeBrowserController) request(cluster *kube.Cluster, r *kubeResource, verb, namespace, subresource, name string) kubeauth.RequestInfo {
+	info := kubeauth.RequestInfo{
+		Cluster:           cluster.Name,
+		IsResourceRequest: true,
+		Verb:              verb,
+		APIGroup:          r.APIGroup,
+		APIVersion:        r.APIVersion,
+		Namespace:         namespace,
+		Resource:          r.Resource,
+		Subresource:       subresource,
+		Name:              name,
+	}
+	info.Path = info.APIPath()
+	return info
+}
+
+func (ctl KubeBrowserController) require(ctx *gin.Context, user *model.User, info kubeauth.RequestInfo) bool {
+	if status, ok := ctl.restrictions.Check(info); !ok {
+		ctx.Error(apperror.Forbidden(status.Message))
+		return false
+	}
+	if ctl.policy.Authorize(user, info) {
+		return true
+	}
+	ctx.Error(apperror.Forbidden(kubeauth.Forbidden(user.Username, info).Message))
+	return false
+}
+
+// allowed 用于决定是否显示链接和按钮
+func (ctl KubeBrowserController) allowed(user *model.User, info kubeauth.RequestInfo) bool {
+	_, ok := ctl.restrictions.Check(info)
+	return ok && ctl.policy.Authorize(user, info)
+}
+
+// 页面公共数据：集群切换、命名空间列表和资源标签页
+func (ctl KubeBrowserController) pageData(ctx *gin.Context, cluster *kube.Cluster, user *model.User, namespace, title string) gin.H {
+	data := pageData(ctx, title)
+	data["cluster"] = cluster.Name
+	data["clusters"] = ctl.allowedClusters(user)
+	data["namespace"] = namespace
+	var tabs []*kubeResource
+	for _, r := range kubeResources {
+		if r.Namespaced {
+			tabs = append(tabs, r)
+		}
+	}
+	data["resources"] = tabs
+
+	// 没有权限或读取失败时侧栏只显示当前命名空间
+	namespaces := []string{}
+	r := findKubeResource("namespaces")
+	if ctl.allowed(user, ctl.request(cluster, r, "list", "", "", "")) {
+		if rows, err := r.list(ctx.Request.Context(), cluster.Client, ""); err == nil {
+			for _, row := range rows {
+				namespaces = append(namespaces, row.Name)
+			}
+		}
+	}
+	if len(namespaces) == 0 && namespace != "" {
+		namespaces = append(namespaces, namespace)
+	}
+	data["namespaces"] = namespaces
+	return data
+}
+
+// ownerLinks 返回所有者的页面链接，ReplicaSet 解析为管理它的 Deployment
+func (ctl KubeBrowserController) ownerLinks(ctx context.Context, cluster *kube.Cluster, user *model.User, namespace string, refs []metav1.OwnerReference) []ownerLink {
+	replicaSets := &kubeResource{Resource: "replicasets", APIGroup: "apps", APIVersion: "v1"}
+	var links []ownerLink
+	for _, ref := range refs {
+		link := ownerLink{Kind: ref.Kind, Name: ref.Name}
+		if ref.Kind == "ReplicaSet" && ctl.allowed(user, ctl.request(cluster, replicaSets, "get", namespace, "", ref.Name)) {
+			rs, err := cluster.Client.AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if owner := controllerOf(rs, err); owner != nil {
+				link = ownerLink{Kind: owner.Kind, Name: owner.Name, Via: "ReplicaSet/" + ref.Name}
+			}
+		}
+		if r := findKubeKind(link.Kind); r != nil && r.Namespaced {
+			link.Link = resourcePath(cluster.Name, namespace, r.Resource, link.Name)
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+func controllerOf(obj metav1.Object, err error) *metav1.OwnerReference {
+	if err != nil {
+		return nil
+	}
+	return metav1.GetControllerOf(obj)
+}
+
+// kubeAPIError 把 client-go 的错误转换为页面错误
+func kubeAPIError(err error) *apperror.Error {
+	var status apierrors.APIStatus
+	switch {
+	case errors.Is(err, kube.ErrCredentials):
+		return apperror.Unavailable(err, "kubernetes service account credentials are not available")
+	case apierrors.IsNotFound(err):
+		return apperror.NotFound(err.Error())
+	case apierrors.IsForbidden(err):
+		// 服务自己的 service account 没有权限
+		return apperror.Wrap(err, http.StatusForbidden, "forbidden", err.Error())
+	case errors.As(err, &status):
+		return apperror.Wrap(err, http.StatusBadGateway, "bad_gateway", err.Error())
+	default:
+		return apperror.BadGateway(err, "kubernetes API server is unreachable")
+	}
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mysti "go-mysti"
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
+	"go-mysti/model"
+	"go-mysti/repository/memory"
+	"go-mysti/session"
+
+	"github.com/gin-gonic/gin"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ownedBy(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func testKubeObjects() []runtime.Object {
+	meta := func(name string, owners []metav1.OwnerReference) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owners, CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}
+	}
+	running := corev1.ContainerStatus{Name: "app", Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+	crashing := corev1.ContainerStatus{Name: "app", RestartCount: 7, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}
+	secret := &corev1.Secret{ObjectMeta: meta("db", nil), Data: map[string][]byte{"password": []byte("hunter2")}}
+	secret.Annotations = map[string]string{corev1.LastAppliedConfigAnnotation: `{"stringData":{"password":"hunter2"}}`}
+	return []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive}},
+		&appsv1.Deployment{ObjectMeta: meta("web", nil)},
+		&appsv1.ReplicaSet{ObjectMeta: meta("web-5d8", ownedBy("Deployment", "web"))},
+		&corev1.Pod{ObjectMeta: meta("web-5d8-abc", ownedBy("ReplicaSet", "web-5d8")),
+			Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{running}}},
+		&corev1.Pod{ObjectMeta: meta("debug", nil),
+			Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "busybox"}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{crashing}}},
+		secret,
+	}
+}
+
+// 启动资源浏览页面，返回发送请求的函数，POST 请求自动带上 CSRF token，restrictions 可以为 nil
+func newTestKubeBrowser(t *testing.T, client *fake.Clientset, restrictions *kubeauth.Restrictions, user *model.User) func(method, path string) (int, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := memory.New()
+	if err := store.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	sessions := session.NewManager(session.Options{Secret: []byte(strings.Repeat("x", 32)), CookieName: "session", TTL: time.Hour})
+	w := httptest.NewRecorder()
+	s := sessions.New(w, user.ID)
+	cookie := w.Result().Cookies()[0]
+
+	policy := &kubeauth.Policy{Rules: []kubeauth.Rule{
+		{Roles: []string{"*"}, Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"namespaces"}},
+		{Roles: []string{"viewer", "operator"}, Verbs: []string{"get", "list"}, APIGroups: []string{"", "apps"},
+			Resources: []string{"pods", "deployments", "replicasets", "secrets"}, Namespaces: []string{"default"}},
+		{Roles: []string{"operator"}, Verbs: []string{"delete", "create"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/exec"}, Namespaces: []string{"default"}},
+	}}
+	clusters := kube.Clusters{{Name: "prod", Client: client}}
+
+	engine := gin.New()
+	engine.SetHTMLTemplate(template.Must(mysti.BuildTemplate("assets/templates", TemplateFuncs())))
+	pages := engine.Group("/", middleware.HTMLErrors("error/error.html"), middleware.Authenticate(sessions, store), middleware.RequireAuth("/login"))
+	RegisterKubeBrowserRoutes(clusters, policy, restrictions, nil, pages)
+	RegisterTerminalRoutes(clusters, pages)
+
+	return func(method, path string) (int, string) {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(url.Values{middleware.CSRFFormField: {sessions.CSRFToken(s)}}.Encode())
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.AddCookie(cookie)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+}
+
+func TestKubeBrowserPages(t *testing.T) {
+	do := newTestKubeBrowser(t, fake.NewClientset(testKubeObjects()...), nil, &model.User{Username: "alice", Roles: []string{"viewer"}})
+
+	tests := []struct {
+		path   string
+		status int
+		want   []string
+		reject []string
+	}{
+		{"/clusters/prod/namespaces", http.StatusOK, []string{`href="/clusters/prod/namespaces/default/pods"`, `badge ok">Active`}, nil},
+		{"/clusters/prod/namespaces/default/pods", http.StatusOK, []string{`badge ok">Running`, `badge bad">CrashLoopBackOff`, "<td>7</td>"}, nil},
+		{"/clusters/prod/namespaces/default/pods/web-5d8-abc", http.StatusOK,
+			[]string{`href="/clusters/prod/namespaces/default/deployments/web">Deployment/web</a>`, "via ReplicaSet/web-5d8", "kind: Pod"},
+			[]string{"Restart", "Delete", "Terminal"}},
+		{"/clusters/prod/namespaces/default/secrets/db", http.StatusOK, []string{"password: &#39;******&#39;"}, []string{"hunter2", "aHVudGVyMg"}},
+		{"/clusters/prod/namespaces/default/configmaps", http.StatusForbidden, []string{`User &#34;alice&#34; cannot list resource &#34;configmaps&#34;`}, nil},
+		{"/clusters/prod/namespaces/default/pods/missing", http.StatusNotFound, nil, nil},
+		{"/clusters/staging/namespaces", http.StatusNotFound, nil, nil},
+		{"/clusters/prod/namespaces/default/nodes", http.StatusNotFound, nil, nil},
+		{"/clusters/prod/namespaces/default/pods/debug/terminal", http.StatusOK, []string{`data-pod="debug"`}, nil},
+	}
+	for _, tt := range tests {
+		code, body := do(http.MethodGet, tt.path)
+		if code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, code, tt.status)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s: body does not contain %s", tt.path, want)
+			}
+		}
+		for _, reject := range tt.reject {
+			if strings.Contains(body, reject) {
+				t.Errorf("GET %s: body contains %s", tt.path, reject)
+			}
+		}
+	}
+
+	if code, _ := do(http.MethodPost, "/clusters/prod/namespaces/default/pods/debug/delete"); code != http.StatusForbidden {
+		t.Errorf("viewer delete = %d, want 403", code)
+	}
+}
+
+func TestKubeBrowserPodActions(t *testing.T) {
+	client := fake.NewClientset(testKubeObjects()...)
+	do := newTestKubeBrowser(t, client, nil, &model.User{Username: "bob", Roles: []string{"operator"}})
+	exists := func(name string) bool {
+		_, err := client.CoreV1().Pods("default").Get(context.Background(), name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	if _, body := do(http.MethodGet, "/clusters/prod/namespaces/default/pods/web-5d8-abc"); !strings.Contains(body, "Restart") || !strings.Contains(body, "Delete") || !strings.Contains(body, "/terminal?container=app") {
+		t.Error("operator should see restart, delete and terminal actions")
+	}
+	if _, body := do(http.MethodGet, "/clusters/prod/namespaces/default/pods/debug"); strings.Contains(body, "Restart") {
+		t.Error("restart shown for a pod without controller")
+	}
+
+	// 没有控制器的 pod 重启后不会被重新创建
+	if code, _ := do(http.MethodPost, "/clusters/prod/namespaces/default/pods/debug/restart"); code != http.StatusBadRequest || !exists("debug") {
+		t.Errorf("restart debug = %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/clusters/prod/namespaces/default/pods/web-5d8-abc/restart"); code != http.StatusSeeOther || exists("web-5d8-abc") {
+		t.Errorf("restart web = %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/clusters/prod/namespaces/default/pods/debug/delete"); code != http.StatusSeeOther || exists("debug") {
+		t.Errorf("delete debug = %d", code)
+	}
+}
+
+func TestKubeBrowserRestrictions(t *testing.T) {
+	restrictions, err := kubeauth.NewRestrictions(kubeauth.RestrictionOptions{ReadOnly: true, DenyPaths: []string{"/api/v1/secrets"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewClientset(testKubeObjects()...)
+	do := newTestKubeBrowser(t, client, restrictions, &model.User{Username: "bob", Roles: []string{"operator"}})
+
+	if code, body := do(http.MethodGet, "/clusters/prod/namespaces/default/pods/web-5d8-abc"); code != http.StatusOK || strings.Contains(body, "Delete") || strings.Contains(body, "/terminal") {
+		t.Errorf("pod page = %d, actions shown in read-only mode", code)
+	}
+	if code, body := do(http.MethodGet, "/clusters/prod/namespaces/default/secrets"); code != http.StatusForbidden || !strings.Contains(body, "is not allowed by the Kubernetes proxy configuration") {
+		t.Errorf("secrets = %d", code)
+	}
+	if code, body := do(http.MethodPost, "/clusters/prod/namespaces/default/pods/debug/delete"); code != http.StatusForbidden || !strings.Contains(body, "read-only") {
+		t.Errorf("delete = %d", code)
+	}
+	if _, err := client.CoreV1().Pods("default").Get(context.Background(), "debug", metav1.GetOptions{}); err != nil {
+		t.Error("pod deleted in read-only mode")
+	}
+}
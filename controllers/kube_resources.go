@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mysti/kubeauth"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// 页面中的状态标签，Class 对应 app.css 中的 badge 样式
+type badge struct {
+	Text  string
+	Class string
+}
+
+// 资源列表中的一行
+type resourceRow struct {
+	Name string
+	// 详情页地址，为空时不显示链接
+	Link   string
+	Status badge
+	Cells  []string
+	Age    string
+	// 事件关联的对象，用于生成链接
+	objectKind, objectName string
+}
+
+// kubeResource 描述资源浏览页面支持的一种资源
+type kubeResource struct {
+	Resource   string
+	Kind       string
+	APIGroup   string
+	APIVersion string
+	Namespaced bool
+	// 除名称、状态和创建时间外的列
+	Columns []string
+	list    func(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error)
+	get     func(ctx context.Context, client kubernetes.Interface, namespace, name string) (runtime.Object, error)
+}
+
+// 按页面中标签页的顺序排列
+var kubeResources = []*kubeResource{
+	{Resource: "pods", Kind: "Pod", APIVersion: "v1", Namespaced: true, Columns: []string{"Ready", "Restarts", "Node", "IP"},
+		list: listPods, get: func(ctx context.Context, c kubernetes.Interface, ns, name string) (runtime.Object, error) {
+			return c.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+		}},
+	{Resource: "deployments", Kind: "Deployment", APIGroup: "apps", APIVersion: "v1", Namespaced: true, Columns: []string{"Ready", "Up-to-date", "Available"},
+		list: listDeployments, get: func(ctx context.Context, c kubernetes.Interface, ns, name string) (runtime.Object, error) {
+			return c.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+		}},
+	{Resource: "services", Kind: "Service", APIVersion: "v1", Namespaced: true, Columns: []string{"Type", "Cluster IP", "Ports"},
+		list: listServices, get: func(ctx context.Context, c kubernetes.Interface, ns, name string) (runtime.Object, error) {
+			return c.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
+		}},
+	{Resource: "configmaps", Kind: "ConfigMap", APIVersion: "v1", Namespaced: true, Columns: []string{"Data"},
+		list: listConfigMaps, get: func(ctx context.Context, c kubernetes.Interface, ns, name string) (runtime.Object, error) {
+			return c.CoreV1().ConfigMaps(ns).Get(ctx, name, metav1.GetOptions{})
+		}},
+	{Resource: "secrets", Kind: "Secret", APIVersion: "v1", Namespaced: true, Columns: []string{"Type", "Data"},
+		list: listSecrets, get: func(ctx context.Context, c kubernetes.Interface, ns, name string) (runtime.Object, error) {
+			return c.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+		}},
+	{Resource: "events", Kind: "Event", APIVersion: "v1", Namespaced: true, Columns: []string{"Reason", "Message", "Count"},
+		list: listEvents, get: func(ctx context.Context, c kubernetes.Interface, ns, name string) (runtime.Object, error) {
+			return c.CoreV1().Events(ns).Get(ctx, name, metav1.GetOptions{})
+		}},
+	{Resource: "namespaces", Kind: "Namespace", APIVersion: "v1", list: listNamespaces},
+}
+
+func findKubeResource(resource string) *kubeResource {
+	for _, r := range kubeResources {
+		if r.Resource == resource {
+			return r
+		}
+	}
+	return nil
+}
+
+// 根据 Kind 查找，用于所有者和事件对象的链接
+func findKubeKind(kind string) *kubeResource {
+	for _, r := range kubeResources {
+		if r.Kind == kind {
+			return r
+		}
+	}
+	return nil
+}
+
+// 页面地址：/clusters/{cluster}/namespaces/{namespace}/{resource}/{name}
+func resourcePath(cluster, namespace, resource, name string) string {
+	p := "/clusters/" + cluster + "/namespaces"
+	if namespace != "" {
+		p += "/" + namespace + "/" + resource
+	}
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+// 与 kubectl 的 AGE 列相同的格式
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+func listPods(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error) {
+	list, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]resourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		pod := &list.Items[i]
+		ready, restarts := 0, int32(0)
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+		rows = append(rows, resourceRow{
+			Name:   pod.Name,
+			Status: podStatus(pod),
+			Cells:  []string{fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)), strconv.Itoa(int(restarts)), pod.Spec.NodeName, pod.Status.PodIP},
+			Age:    age(pod.CreationTimestamp),
+		})
+	}
+	return rows, nil
+}
+
+// podStatus 按 kubectl get pods 的 STATUS 列计算，容器等待或退出的原因优先于 phase
+func podStatus(pod *corev1.Pod) badge {
+	if pod.DeletionTimestamp != nil {
+		return badge{"Terminating", "warn"}
+	}
+	reason := string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		reason = pod.Status.Reason
+	}
+	ready := pod.Status.Phase == corev1.PodRunning
+	for _, cs := range pod.Status.ContainerStatuses {
+		switch {
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "":
+			reason, ready = cs.State.Waiting.Reason, false
+		case cs.State.Terminated != nil && cs.State.Terminated.Reason != "" && pod.Status.Phase != corev1.PodSucceeded:
+			reason, ready = cs.State.Terminated.Reason, false
+		case !cs.Ready:
+			ready = false
+		}
+	}
+
+	switch {
+	case ready && reason == string(corev1.PodRunning):
+		return badge{reason, "ok"}
+	case pod.Status.Phase == corev1.PodSucceeded:
+		return badge{reason, ""}
+	case pod.Status.Phase == corev1.PodFailed, strings.HasSuffix(reason, "BackOff"), reason == "Error", reason == "OOMKilled", reason == "ErrImagePull":
+		return badge{reason, "bad"}
+	default:
+		return badge{reason, "warn"}
+	}
+}
+
+func listDeployments(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error) {
+	list, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]resourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		d := &list.Items[i]
+		s := d.Status
+		rows = append(rows, resourceRow{
+			Name:   d.Name,
+			Status: deploymentStatus(d),
+			Cells:  []string{fmt.Sprintf("%d/%d", s.ReadyReplicas, s.Replicas), strconv.Itoa(int(s.UpdatedReplicas)), strconv.Itoa(int(s.AvailableReplicas))},
+			Age:    age(d.CreationTimestamp),
+		})
+	}
+	return rows, nil
+}
+
+func deploymentStatus(d *appsv1.Deployment) badge {
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse {
+			return badge{c.Reason, "bad"}
+		}
+		if c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue {
+			return badge{c.Reason, "bad"}
+		}
+	}
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	s := d.Status
+	if s.ObservedGeneration >= d.Generation && s.UpdatedReplicas == desired && s.AvailableReplicas == desired && s.Replicas == desired {
+		return badge{"Available", "ok"}
+	}
+	return badge{"Progressing", "warn"}
+}
+
+func listServices(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error) {
+	list, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]resourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		svc := &list.Items[i]
+		var ports []string
+		for _, p := range svc.Spec.Ports {
+			port := strconv.Itoa(int(p.Port))
+			if p.NodePort != 0 {
+				port += ":" + strconv.Itoa(int(p.NodePort))
+			}
+			ports = append(ports, port+"/"+string(p.Protocol))
+		}
+		rows = append(rows, resourceRow{
+			Name:  svc.Name,
+			Cells: []string{string(svc.Spec.Type), svc.Spec.ClusterIP, strings.Join(ports, ",")},
+			Age:   age(svc.CreationTimestamp),
+		})
+	}
+	return rows, nil
+}
+
+func listConfigMaps(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error) {
+	list, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]resourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		cm := &list.Items[i]
+		rows = append(rows, resourceRow{
+			Name:  cm.Name,
+			Cells: []string{strconv.Itoa(len(cm.Data) + len(cm.BinaryData))},
+			Age:   age(cm.CreationTimestamp),
+		})
+	}
+	return rows, nil
+}
+
+func listSecrets(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error) {
+	list, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]resourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		secret := &list.Items[i]
+		rows = append(rows, resourceRow{
+			Name:  secret.Name,
+			Cells: []string{string(secret.Type), strconv.Itoa(len(secret.Data))},
+			Age:   age(secret.CreationTimestamp),
+		})
+	}
+	return rows, nil
+}
+
+// 事件按最后发生时间倒序，名称列显示关联的对象
+func listEvents(ctx context.Context, client kubernetes.Interface, namespace string) ([]resourceRow, error) {
+	list, err := client.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	events := list.Items
+	slices.SortFunc(events, func(a, b corev1.Event) int {
+		return eventTime(&b).Compare(eventTime(&a).Time)
+	})
+	rows := make([]resourceRow, 0, len(events))
+	for i := range events {
+		ev := &events[i]
+		obj := ev.InvolvedObject
+		row := resourceRow{
+			Name:   strings.ToLower(obj.Kind) + "/" + obj.Name,
+			Status: badge{ev.Type, ""},
+			Cells:  []string{ev.Reason, ev.Message, strconv.Itoa(int(ev.Count))},
+			Age:    age(eventTime(ev)),
+
+			objectKind: obj.Kind,
+			objectName: obj.Name,
+		}
+		if ev.Type == corev1.EventTypeWarning {
+			row.Status.Class = "warn"
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// events.k8s.io 写入的事件没有 lastTimestamp，使用 eventTime
+func eventTime(ev *corev1.Event) metav1.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp
+	case !ev.EventTime.IsZero():
+		return metav1.Time{Time: ev.EventTime.Time}
+	default:
+		return ev.CreationTimestamp
+	}
+}
+
+func listNamespaces(ctx context.Context, client kubernetes.Interface, _ string) ([]resourceRow, error) {
+	list, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]resourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		ns := &list.Items[i]
+		status := badge{string(ns.Status.Phase), "ok"}
+		if ns.Status.Phase != corev1.NamespaceActive {
+			status.Class = "warn"
+		}
+		rows = append(rows, resourceRow{Name: ns.Name, Status: status, Age: age(ns.CreationTimestamp)})
+	}
+	return rows, nil
+}
+
+// 被替换的 Secret 值
+const maskedValue = "******"
+
+// resourceYAML 返回对象的 YAML，去掉 managedFields 和 restrictions 配置的字段，Secret 的数据被替换为 ******
+func resourceYAML(r *kubeResource, obj runtime.Object, restrictions *kubeauth.Restrictions) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", err
+	}
+	// typed client 返回的对象没有 apiVersion 和 kind
+	m["apiVersion"] = r.APIVersion
+	if r.APIGroup != "" {
+		m["apiVersion"] = r.APIGroup + "/" + r.APIVersion
+	}
+	m["kind"] = r.Kind
+	restrictions.StripObject(m)
+	metadata, _ := m["metadata"].(map[string]any)
+	delete(metadata, "managedFields")
+
+	if r.Kind == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			values, _ := m[field].(map[string]any)
+			for k := range values {
+				values[k] = maskedValue
+			}
+		}
+		// kubectl apply 保存的上一次配置中也有明文数据
+		annotations, _ := metadata["annotations"].(map[string]any)
+		if _, ok := annotations[corev1.LastAppliedConfigAnnotation]; ok {
+			annotations[corev1.LastAppliedConfigAnnotation] = maskedValue
+		}
+	}
+	out, err := yaml.Marshal(m)
+	return string(out), err
+}
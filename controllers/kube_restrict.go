@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-mysti/kubeauth"
+)
+
+// 配置了 strip_fields 时只请求 JSON 响应，protobuf、CBOR 和 YAML 等格式无法改写
+func acceptJSONOnly(h http.Header) {
+	var types []string
+	for _, value := range h.Values("Accept") {
+		for _, t := range strings.Split(value, ",") {
+			// application/json;as=Table 等带参数的类型也是 JSON
+			if t = strings.TrimSpace(t); isJSON(t) {
+				types = append(types, t)
+			}
+		}
+	}
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	h.Set("Accept", strings.Join(types, ", "))
+	// 压缩的响应需要先解压才能改写，让 transport 不使用压缩
+	h.Del("Accept-Encoding")
+}
+
+// stripResponse 删除成功的 JSON 响应中配置的字段，watch 按事件逐行处理
+//
+// 其他格式的成功响应无法改写，替换为 406，不把字段原样返回给客户端；
+// 只有纯文本的日志和没有内容的响应例外。
+func stripResponse(restrictions *kubeauth.Restrictions, info kubeauth.RequestInfo, resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil
+	}
+	if contentType := resp.Header.Get("Content-Type"); !isJSON(contentType) {
+		if (info.Resource == "pods" && info.Subresource == "log") || resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		return notAcceptable(resp, contentType)
+	}
+	if info.Verb == "watch" {
+		resp.Body = &strippedWatch{ReadCloser: resp.Body, reader: bufio.NewReader(resp.Body), restrictions: restrictions}
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		return nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if out, ok := stripJSON(restrictions, data); ok {
+		data = out
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
+
+// 把响应替换为 406 Status
+func notAcceptable(resp *http.Response, contentType string) error {
+	resp.Body.Close()
+	data, err := json.Marshal(kubeauth.NewStatus(http.StatusNotAcceptable, "NotAcceptable",
+		fmt.Sprintf("response of type %q cannot be filtered, only JSON is allowed when fields are stripped", contentType)))
+	if err != nil {
+		return err
+	}
+	resp.StatusCode = http.StatusNotAcceptable
+	resp.Status = "406 Not Acceptable"
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
+
+// stripJSON 返回删除字段后的 JSON，没有修改或不是 JSON 对象时返回 false
+func stripJSON(restrictions *kubeauth.Restrictions, data []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// 保留整数精度
+	decoder.UseNumber()
+	var obj map[string]any
+	if err := decoder.Decode(&obj); err != nil || !restrictions.StripObject(obj) {
+		return nil, false
+	}
+	out, err := json.Marshal(obj)
+	return out, err == nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// strippedWatch 逐行读取 watch 事件，每次 Read 返回一个完整的事件，代理收到后立即写出
+type strippedWatch struct {
+	io.ReadCloser
+	reader       *bufio.Reader
+	restrictions *kubeauth.Restrictions
+	pending      []byte
+}
+
+func (w *strippedWatch) Read(p []byte) (int, error) {
+	if len(w.pending) == 0 {
+		line, err := w.reader.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		if out, ok := stripJSON(w.restrictions, line); ok {
+			line = append(out, '\n')
+		}
+		w.pending = line
+	}
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/model"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestKubeProxyRestrictions(t *testing.T) {
+	var requests []string
+	var accept string
+	cluster, err := kube.NewCluster("default", newFakeAPIServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			for _, name := range []string{"a", "b"} {
+				fmt.Fprintf(w, `{"type":"ADDED","object":{"kind":"ConfigMap","metadata":{"name":%q,"managedFields":[{}]}}}`+"\n", name)
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+		io.WriteString(w, `{"kind":"ConfigMapList","items":[{"metadata":{"name":"a","managedFields":[{}],"generation":9007199254740993}}]}`)
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restrictions, err := kubeauth.NewRestrictions(kubeauth.RestrictionOptions{
+		ReadOnly:    true,
+		DenyPaths:   []string{"/api/v1/secrets"},
+		StripFields: []string{"metadata.managedFields"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &model.User{Username: "admin", Roles: []string{"admin"}}
+	url, cookie := newTestKubeRouter(t, kube.Clusters{cluster}, kubeauth.DefaultPolicy(), restrictions, nil, admin)
+
+	do := func(method, path string) (int, string) {
+		req, _ := http.NewRequest(method, url+path, nil)
+		req.AddCookie(cookie)
+		req.Header.Set("Accept", "application/vnd.kubernetes.protobuf, application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// 被拒绝的请求不会转发
+	if code, body := do(http.MethodDelete, "/kube/default/api/v1/namespaces/default/configmaps/a"); code != http.StatusForbidden ||
+		!strings.Contains(body, `"kind":"Status"`) || !strings.Contains(body, "read-only") {
+		t.Errorf("delete = %d %s", code, body)
+	}
+	if code, body := do(http.MethodGet, "/kube/default/api/v1/watch/namespaces/default/secrets"); code != http.StatusForbidden ||
+		!strings.Contains(body, `path \"/api/v1/namespaces/default/secrets\" is not allowed`) {
+		t.Errorf("watch secrets = %d %s", code, body)
+	}
+	// deny_paths 中的 /api/v1/secrets 覆盖每个 namespace
+	if code, _ := do(http.MethodGet, "/kube/default/api/v1/namespaces/kube-system/secrets/token"); code != http.StatusForbidden {
+		t.Errorf("get secret = %d", code)
+	}
+	if len(requests) != 0 {
+		t.Errorf("forwarded %v", requests)
+	}
+
+	code, body := do(http.MethodGet, "/kube/default/api/v1/namespaces/default/configmaps")
+	if code != http.StatusOK || body != `{"items":[{"metadata":{"generation":9007199254740993,"name":"a"}}],"kind":"ConfigMapList"}` {
+		t.Errorf("list = %d %s", code, body)
+	}
+	if accept != "application/json" {
+		t.Errorf("Accept = %q", accept)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/kube/default/api/v1/namespaces/default/configmaps?watch=true", nil)
+	req.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	var events []string
+	for scanner.Scan() {
+		events = append(events, scanner.Text())
+	}
+	if len(events) != 2 || events[1] != `{"object":{"kind":"ConfigMap","metadata":{"name":"b"}},"type":"ADDED"}` {
+		t.Errorf("watch events = %q", events)
+	}
+}
+
+func newStripTestRouter(t *testing.T, apiServer http.Handler) (string, *http.Cookie) {
+	t.Helper()
+	cluster, err := kube.NewCluster("default", newFakeAPIServer(t, apiServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restrictions, err := kubeauth.NewRestrictions(kubeauth.RestrictionOptions{StripFields: []string{"Secret:data"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &model.User{Username: "admin", Roles: []string{"admin"}}
+	return newTestKubeRouter(t, kube.Clusters{cluster}, kubeauth.DefaultPolicy(), restrictions, nil, admin)
+}
+
+// 字段无法删除时不能把原始响应返回给客户端
+func TestKubeProxyStripFailsClosed(t *testing.T) {
+	var accept string
+	url, cookie := newStripTestRouter(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/log"):
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "hello\n")
+		case r.URL.Query().Get("format") == "yaml":
+			// 不遵守 Accept 的上游
+			w.Header().Set("Content-Type", "application/yaml")
+			io.WriteString(w, "kind: Secret\ndata:\n  password: c2VjcmV0\n")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"kind":"Secret","metadata":{"name":"db"},"data":{"password":"c2VjcmV0"}}`)
+		}
+	}))
+
+	tests := []struct {
+		name, path, accept string
+		code               int
+		wantAccept         string
+		want               string
+	}{
+		{"yaml accept is rewritten", "/secrets/db", "application/yaml", http.StatusOK, "application/json", `{"kind":"Secret","metadata":{"name":"db"}}`},
+		{"json types are kept", "/secrets/db", "application/json;as=Table;v=v1;g=meta.k8s.io, application/yaml, application/json",
+			http.StatusOK, "application/json;as=Table;v=v1;g=meta.k8s.io, application/json", `"kind":"Secret"`},
+		{"wildcard", "/secrets/db", "*/*", http.StatusOK, "application/json", `"kind":"Secret"`},
+		{"non-json response", "/secrets/db?format=yaml", "application/yaml", http.StatusNotAcceptable, "application/json", `"reason":"NotAcceptable"`},
+		{"logs are plain text", "/pods/web/log", "text/plain", http.StatusOK, "application/json", "hello\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, url+"/kube/default/api/v1/namespaces/default"+tt.path, nil)
+			req.AddCookie(cookie)
+			req.Header.Set("Accept", tt.accept)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.code || !strings.Contains(string(body), tt.want) || strings.Contains(string(body), "c2VjcmV0") {
+				t.Errorf("response = %d %s", resp.StatusCode, body)
+			}
+			if accept != tt.wantAccept {
+				t.Errorf("upstream Accept = %q, want %q", accept, tt.wantAccept)
+			}
+		})
+	}
+}
+
+// 升级后的连接无法过滤，只允许 exec、attach 和 portforward
+func TestKubeProxyStripRejectsWebSocket(t *testing.T) {
+	var upstream []string
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	url, cookie := newStripTestRouter(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = append(upstream, r.URL.Path)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ADDED","object":{"kind":"Secret","data":{"password":"c2VjcmV0"}}}`))
+		conn.Close()
+	}))
+	wsURL := "ws" + strings.TrimPrefix(url, "http") + "/kube/default/api/v1/namespaces/default"
+	header := http.Header{"Cookie": {cookie.String()}}
+
+	for _, path := range []string{"/secrets?watch=true", "/pods/web/log?follow=true"} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+path, header)
+		if err == nil {
+			t.Errorf("%s: dial succeeded", path)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "only pods exec, attach and portforward") {
+			t.Errorf("%s: response = %d %s", path, resp.StatusCode, body)
+		}
+	}
+	if len(upstream) != 0 {
+		t.Errorf("forwarded %v", upstream)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL+"/pods/web/exec?command=sh&stdout=true", header)
+	if err != nil {
+		t.Fatalf("exec dial: %v %v", err, resp)
+	}
+	conn.Close()
+	if len(upstream) != 1 {
+		t.Errorf("upstream requests = %v", upstream)
+	}
+}
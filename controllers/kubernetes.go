@@ -1,78 +1,205 @@
 package controllers
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
+	"net/http/httputil"
+	"net/url"
+	"strings"
 
-	"github.com/gin-gonic/gin"
-)
+	"go-mysti/apperror"
+	"go-mysti/audit"
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
 
-const (
-	KUBERNETES_API_SERVER = "https://kubernetes.default.svc"
-	SERVICE_ACCOUNT_PATH  = "/var/run/secrets/kubernetes.io/serviceaccount"
-	KUBERNETES_CA_CERT    = SERVICE_ACCOUNT_PATH + "/ca.crt"
-	KUBERNETES_TOKEN      = SERVICE_ACCOUNT_PATH + "/token"
-	KUBERNETES_NAMESPACE  = SERVICE_ACCOUNT_PATH + "/namespace"
+	"github.com/gin-gonic/gin"
 )
 
 type KubeController struct {
+	clusters kube.Clusters
+	policy   *kubeauth.Policy
+	// 对所有用户生效的只读、路径和字段限制，可以为 nil
+	restrictions *kubeauth.Restrictions
+	recorder     audit.Recorder
 }
 
-func RegisterKubeRoutes(router *gin.RouterGroup) KubeController {
-	ctl := KubeController{}
-	router.GET("/*kubernetesPath", ctl.proxy)
+// RegisterKubeRoutes 注册集群列表和 Kubernetes API 代理，/kube/{cluster}/api/... 转发到对应集群
+//
+// 请求转发前先检查 restrictions，再按 policy 检查当前用户的权限，包括被拒绝的请求在内都交给 recorder 记录。
+// restrictions 和 recorder 可以为 nil。
+func RegisterKubeRoutes(clusters kube.Clusters, policy *kubeauth.Policy, restrictions *kubeauth.Restrictions, recorder audit.Recorder, router *gin.RouterGroup) KubeController {
+	ctl := KubeController{clusters: clusters, policy: policy, restrictions: restrictions, recorder: recorder}
+	router.GET("", ctl.list)
+	router.Any("/:cluster/*kubernetesPath", ctl.audit, ctl.authorize, ctl.proxy)
 
 	return ctl
 }
 
-func (ctrl KubeController) proxy(ctx *gin.Context) {
-	targetUri := ctx.Param("kubernetesPath")
+type clusterItem struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
 
-	// 1. 读取 ServiceAccount token
-	token, err := os.ReadFile(KUBERNETES_TOKEN)
-	if err != nil {
-		panic(err)
+// list 返回当前用户有权限访问的集群，第一个是默认集群
+func (ctrl KubeController) list(ctx *gin.Context) {
+	user := middleware.CurrentUser(ctx)
+	items := []clusterItem{}
+	for i, cluster := range ctrl.clusters {
+		if user != nil && ctrl.policy.AllowsCluster(user, cluster.Name) {
+			items = append(items, clusterItem{Name: cluster.Name, Default: i == 0})
+		}
 	}
+	ctx.JSON(http.StatusOK, gin.H{"items": items})
+}
 
-	// 2. 读取 CA 证书
-	caCert, err := os.ReadFile(KUBERNETES_CA_CERT)
+// 拒绝时返回 Kubernetes Status，kubectl 等客户端可以直接显示
+func (ctrl KubeController) authorize(ctx *gin.Context) {
+	name := ctx.Param("cluster")
+	if ctrl.clusters.Get(name) == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, kubeauth.NewStatus(http.StatusNotFound, "NotFound", fmt.Sprintf("cluster %q not found", name)))
+		return
+	}
+	info, err := kubeauth.ParseRequest(ctx.Request.Method, ctx.Param("kubernetesPath"), ctx.Request.URL.Query())
 	if err != nil {
-		panic(err)
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, kubeauth.NewStatus(http.StatusBadRequest, "BadRequest", err.Error()))
+		return
 	}
+	info.Cluster = name
+	ctx.Set(kubeRequestKey, info)
+	// WebSocket 不受同源策略和 CSRF 检查限制（升级请求是 GET），拒绝其他站点页面发起的连接
+	if isWebSocketUpgrade(ctx.Request) && !sameOrigin(ctx.Request) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, kubeauth.NewStatus(http.StatusForbidden, "Forbidden", "websocket origin not allowed"))
+		return
+	}
+	user := middleware.CurrentUser(ctx)
+	if user == nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, kubeauth.NewStatus(http.StatusUnauthorized, "Unauthorized", "login required"))
+		return
+	}
+	if status, ok := ctrl.restrictions.Check(info); !ok {
+		ctx.AbortWithStatusJSON(status.Code, status)
+		return
+	}
+	// 升级后的连接不经过 ModifyResponse，无法删除字段；exec、attach 和 portforward 传输的不是 API 对象
+	if isWebSocketUpgrade(ctx.Request) && ctrl.restrictions.StripsFields() && !streamsWithoutObjects(info) {
+		log.Printf("[%s] rejected websocket upgrade of %s %q by %s: strip_fields cannot filter websocket responses",
+			middleware.GetRequestID(ctx), info.Verb, info.Path, user.Username)
+		ctx.AbortWithStatusJSON(http.StatusForbidden, kubeauth.NewStatus(http.StatusForbidden, "Forbidden",
+			"only pods exec, attach and portforward can use websocket when fields are stripped"))
+		return
+	}
+	if !ctrl.policy.Authorize(user, info) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, kubeauth.Forbidden(user.Username, info))
+		return
+	}
+	ctx.Next()
+}
 
-	// 4. 构造 TLS 客户端
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+// pods 的 exec、attach 和 portforward 只传输终端和端口数据
+func streamsWithoutObjects(info kubeauth.RequestInfo) bool {
+	if info.Resource != "pods" || info.APIGroup != "" {
+		return false
+	}
+	switch info.Subresource {
+	case "exec", "attach", "portforward":
+		return true
+	}
+	return false
+}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: caCertPool,
-			},
-		},
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// 与 gorilla/websocket 的默认检查相同：没有 Origin（非浏览器客户端）或 Origin 的主机与请求的 Host 相同
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
 	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
 
-	// 5. 构造请求
-	url := fmt.Sprintf("%s%s", KUBERNETES_API_SERVER, targetUri)
+// kubectl 等客户端通过 WebSocket 子协议传递的 token，与 Authorization 一样不转发
+const bearerProtocolPrefix = "base64url.bearer.authorization.k8s.io."
 
-	req, err := http.NewRequest(ctx.Request.Method, url, ctx.Request.Body)
-	if err != nil {
-		panic(err)
+// 不转发给 API server 的请求头：认证信息由代理替换，Impersonate-* 会让调用方借用 service account 的模拟权限
+func stripKubeRequestHeaders(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(name, "Impersonate-") {
+			h.Del(name)
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+string(token))
+	h.Del("Authorization")
+	h.Del("Cookie")
+	h.Del(middleware.CSRFHeader)
 
-	// 6. 发送请求
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
+	var protocols []string
+	for _, value := range h.Values("Sec-Websocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" && !strings.HasPrefix(protocol, bearerProtocolPrefix) {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	h.Del("Sec-Websocket-Protocol")
+	if len(protocols) > 0 {
+		h.Set("Sec-Websocket-Protocol", strings.Join(protocols, ", "))
 	}
-	defer resp.Body.Close()
+}
+
+// proxy 把请求原样转发给 API server，保留方法、查询参数、状态码和响应头，watch 等分块响应边收边写
+//
+// 配置了 strip_fields 时只请求 JSON 格式，并在返回前删除响应中的字段。
+//
+// exec、attach、portforward 和 log 的 WebSocket 升级请求也原样转发，API server 返回 101 后
+// ReverseProxy 接管客户端连接，在两端之间双向复制数据。http.Transport 对 WebSocket 升级请求总是使用 HTTP/1.1 连接。
+func (ctrl KubeController) proxy(ctx *gin.Context) {
+	cluster := ctrl.clusters.Get(ctx.Param("cluster"))
+	target := cluster.Server
 
-	body, _ := io.ReadAll(resp.Body)
-	ctx.Header("Content-Type", resp.Header.Get("Content-Type"))
-	ctx.Writer.Write(body)
+	kubernetesPath := ctx.Param("kubernetesPath")
+	value, _ := ctx.Get(kubeRequestKey)
+	info, _ := value.(kubeauth.RequestInfo)
+	strip := ctrl.restrictions.StripsFields()
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = target.Scheme
+			r.Out.URL.Host = target.Host
+			r.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + kubernetesPath
+			r.Out.URL.RawPath = ""
+			r.Out.URL.RawQuery = r.In.URL.RawQuery
+			r.Out.Host = target.Host
+			// Authorization 由 transport 设置为 service account token
+			stripKubeRequestHeaders(r.Out.Header)
+			if strip {
+				acceptJSONOnly(r.Out.Header)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if !strip {
+				return nil
+			}
+			return stripResponse(ctrl.restrictions, info, resp)
+		},
+		Transport: cluster.Transport,
+		// 立即写出每次读取到的数据，watch 和 follow 日志不会被缓冲
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			switch {
+			case errors.Is(err, context.Canceled):
+				// 客户端断开时不需要响应
+			case errors.Is(err, kube.ErrCredentials):
+				ctx.Error(apperror.Unavailable(err, "kubernetes service account credentials are not available"))
+			default:
+				ctx.Error(apperror.BadGateway(err, "kubernetes API server is unreachable"))
+			}
+		},
+	}
+	proxy.ServeHTTP(ctx.Writer, ctx.Request)
 }
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mysti/audit"
+	"go-mysti/kube"
+	"go-mysti/kubeauth"
+	"go-mysti/middleware"
+	"go-mysti/model"
+	"go-mysti/repository/memory"
+	"go-mysti/session"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/rest"
+)
+
+// 启动支持 HTTP/2 的假 API server，返回使用 token 文件和 CA 文件访问它的配置
+func newFakeAPIServer(t *testing.T, handler http.Handler) *rest.Config {
+	t.Helper()
+	upstream := httptest.NewUnstartedServer(handler)
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+	dir := t.TempDir()
+	cfg := &rest.Config{
+		Host:            upstream.URL,
+		BearerTokenFile: filepath.Join(dir, "token"),
+		TLSClientConfig: rest.TLSClientConfig{CAFile: filepath.Join(dir, "ca.crt")},
+	}
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	if err := os.WriteFile(cfg.CAFile, caCert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.BearerTokenFile, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// 启动 /kube 代理，返回代理地址和以 user 登录的 cookie，restrictions 和 recorder 可以为 nil
+func newTestKubeRouter(t *testing.T, clusters kube.Clusters, policy *kubeauth.Policy, restrictions *kubeauth.Restrictions, recorder audit.Recorder, user *model.User) (string, *http.Cookie) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := memory.New()
+	if err := store.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	sessions := session.NewManager(session.Options{Secret: []byte(strings.Repeat("x", 32)), CookieName: "session", TTL: time.Hour})
+	w := httptest.NewRecorder()
+	sessions.New(w, user.ID)
+	cookie := w.Result().Cookies()[0]
+
+	engine := gin.New()
+	engine.Use(middleware.RequestID())
+	api := engine.Group("/kube", middleware.ProblemErrors(), middleware.Authenticate(sessions, store), middleware.RequireAuth(""))
+	RegisterKubeRoutes(clusters, policy, restrictions, recorder, api)
+
+	proxy := httptest.NewServer(engine)
+	t.Cleanup(proxy.Close)
+	t.Cleanup(clusters.CloseIdleConnections)
+	return proxy.URL, cookie
+}
+
+// 使用一个名为 default 的集群，以 admin 登录
+func newTestKubeProxy(t *testing.T, apiServer http.Handler) (string, *http.Cookie) {
+	t.Helper()
+	cluster, err := kube.NewCluster("default", newFakeAPIServer(t, apiServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &model.User{Username: "admin", Roles: []string{"admin"}}
+	return newTestKubeRouter(t, kube.Clusters{cluster}, kubeauth.DefaultPolicy(), nil, nil, admin)
+}
+
+func TestKubeProxyForwardsRequest(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	url, cookie := newTestKubeProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Audit-Id", "abc")
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"kind":"Status","code":409}`)
+	}))
+
+	req, _ := http.NewRequest(http.MethodPatch, url+"/kube/default/apis/apps/v1/namespaces/default/deployments/web?fieldManager=kubectl&dryRun=All", strings.NewReader(`{"spec":{}}`))
+	req.AddCookie(cookie)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("Accept", "application/json;as=Table;g=meta.k8s.io;v=v1")
+	req.Header.Set("Impersonate-User", "system:admin")
+	req.Header.Set("Impersonate-Extra-Scopes", "all")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusConflict || string(body) != `{"kind":"Status","code":409}` {
+		t.Errorf("response = %d %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Audit-Id") != "abc" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("response headers = %v", resp.Header)
+	}
+
+	if got.Method != http.MethodPatch || got.URL.Path != "/apis/apps/v1/namespaces/default/deployments/web" || got.URL.RawQuery != "fieldManager=kubectl&dryRun=All" {
+		t.Errorf("upstream request = %s %s", got.Method, got.URL)
+	}
+	if gotBody != `{"spec":{}}` {
+		t.Errorf("upstream body = %q", gotBody)
+	}
+	if got.Header.Get("Authorization") != "Bearer sa-token" {
+		t.Errorf("Authorization = %q", got.Header.Get("Authorization"))
+	}
+	if got.Header.Get("Content-Type") != "application/merge-patch+json" || !strings.Contains(got.Header.Get("Accept"), "as=Table") {
+		t.Errorf("upstream headers = %v", got.Header)
+	}
+	for _, name := range []string{"Cookie", "Impersonate-User", "Impersonate-Extra-Scopes"} {
+		if v := got.Header.Get(name); v != "" {
+			t.Errorf("%s forwarded: %q", name, v)
+		}
+	}
+}
+
+func TestKubeProxyStreamsWatch(t *testing.T) {
+	release := make(chan struct{})
+	url, cookie := newTestKubeProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" || r.URL.Query().Get("labelSelector") != "app=web" {
+			http.Error(w, "bad query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"type":"ADDED"}`+"\n")
+		w.(http.Flusher).Flush()
+		// 第一条事件被客户端读到之后才结束响应
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, `{"type":"DELETED"}`+"\n")
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/kube/default/api/v1/namespaces/default/pods?watch=true&labelSelector=app%3Dweb", nil)
+	req.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+
+	lines := bufio.NewReader(resp.Body)
+	first := make(chan string, 1)
+	go func() {
+		line, _ := lines.ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		if line != `{"type":"ADDED"}`+"\n" {
+			t.Errorf("first event = %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first watch event was not flushed")
+	}
+	close(release)
+	if line, _ := lines.ReadString('\n'); line != `{"type":"DELETED"}`+"\n" {
+		t.Errorf("second event = %q", line)
+	}
+}
+
+func TestKubeProxyUpstreamError(t *testing.T) {
+	url, cookie := newTestKubeProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 不写响应直接断开连接
+		panic(http.ErrAbortHandler)
+	}))
+	req, _ := http.NewRequest(http.MethodGet, url+"/kube/default/version", nil)
+	req.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("response = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestKubeProxyMultipleClusters(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name+" "+r.URL.Path)
+		})
+	}
+	var clusters kube.Clusters
+	for _, name := range []string{"prod", "staging", "dev"} {
+		cluster, err := kube.NewCluster(name, newFakeAPIServer(t, handler(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clusters = append(clusters, cluster)
+	}
+	policy := &kubeauth.Policy{Rules: []kubeauth.Rule{
+		{Roles: []string{"dev"}, Clusters: []string{"staging", "dev"}, Verbs: []string{"*"}, NonResourceURLs: []string{"*"}},
+	}}
+	url, cookie := newTestKubeRouter(t, clusters, policy, nil, nil, &model.User{Username: "bob", Roles: []string{"dev"}})
+
+	get := func(path string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, url+path, nil)
+		req.AddCookie(cookie)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/kube"); code != http.StatusOK || body != `{"items":[{"name":"staging","default":false},{"name":"dev","default":false}]}` {
+		t.Errorf("list = %d %s", code, body)
+	}
+	if code, body := get("/kube/staging/version"); code != http.StatusOK || body != "staging /version" {
+		t.Errorf("staging = %d %s", code, body)
+	}
+	if code, body := get("/kube/dev/version"); code != http.StatusOK || body != "dev /version" {
+		t.Errorf("dev = %d %s", code, body)
+	}
+	if code, body := get("/kube/prod/version"); code != http.StatusForbidden || !strings.Contains(body, `"reason":"Forbidden"`) {
+		t.Errorf("prod = %d %s", code, body)
+	}
+	if code, body := get("/kube/missing/version"); code != http.StatusNotFound || !strings.Contains(body, `"reason":"NotFound"`) {
+		t.Errorf("missing = %d %s", code, body)
+	}
+}
+
+func TestKubeProxyWebSocketExec(t *testing.T) {
+	var got *http.Request
+	// kube-apiserver 不检查 Origin
+	upgrader := websocket.Upgrader{Subprotocols: []string{"v5.channel.k8s.io"}, CheckOrigin: func(*http.Request) bool { return true }}
+	url, cookie := newTestKubeProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 把 stdin 回显到 stdout
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg[0] = 1
+			if conn.WriteMessage(websocket.BinaryMessage, msg) != nil {
+				return
+			}
+		}
+	}))
+
+	wsURL := "ws" + strings.TrimPrefix(url, "http") + "/kube/default/api/v1/namespaces/default/pods/web/exec?command=sh&stdin=true&stdout=true&tty=true"
+	header := http.Header{"Cookie": {cookie.String()}, "Origin": {url}}
+	dialer := websocket.Dialer{Subprotocols: []string{"v5.channel.k8s.io", "base64url.bearer.authorization.k8s.io.c2VjcmV0"}}
+	conn, resp, err := dialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("dial: %v %v", err, resp)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "v5.channel.k8s.io" {
+		t.Errorf("subprotocol = %q", conn.Subprotocol())
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("\x00ls\r")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "\x01ls\r" {
+		t.Errorf("read = %q %v", msg, err)
+	}
+
+	if got.URL.Query().Get("command") != "sh" || got.Header.Get("Authorization") != "Bearer sa-token" {
+		t.Errorf("upstream request = %s %v", got.URL, got.Header)
+	}
+	if p := got.Header.Get("Sec-Websocket-Protocol"); p != "v5.channel.k8s.io" {
+		t.Errorf("forwarded subprotocols = %q", p)
+	}
+}
+
+func TestKubeProxyWebSocketChecks(t *testing.T) {
+	cluster, err := kube.NewCluster("default", newFakeAPIServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected upstream request %s", r.URL)
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &kubeauth.Policy{Rules: []kubeauth.Rule{
+		{Roles: []string{"viewer"}, Verbs: []string{"get", "list", "watch"}, Resources: []string{"pods", "pods/log"}},
+	}}
+	url, cookie := newTestKubeRouter(t, kube.Clusters{cluster}, policy, nil, nil, &model.User{Username: "alice", Roles: []string{"viewer"}})
+	wsURL := "ws" + strings.TrimPrefix(url, "http") + "/kube/default/api/v1/namespaces/default/pods/web"
+
+	tests := []struct {
+		path, origin string
+		want         string
+	}{
+		// 其他站点的页面不能借用登录会话
+		{"/log?follow=true", "https://evil.example.com", "websocket origin not allowed"},
+		// WebSocket 的 exec 请求需要 create 权限
+		{"/exec?command=sh", url, `cannot create resource \"pods/exec\"`},
+	}
+	for _, tt := range tests {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+tt.path, http.Header{"Cookie": {cookie.String()}, "Origin": {tt.origin}})
+		if err == nil {
+			t.Errorf("%s: dial succeeded", tt.path)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), tt.want) {
+			t.Errorf("%s: response = %d %s", tt.path, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-mysti/apperror"
+	"go-mysti/kube"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 没有指定命令时优先使用 bash，镜像中没有 bash 时使用 sh
+var defaultTerminalCommand = []string{"sh", "-c", "command -v bash >/dev/null && exec bash || exec sh"}
+
+type TerminalController struct {
+	clusters kube.Clusters
+}
+
+// RegisterTerminalRoutes 注册 pod 终端页面，router 需要登录
+//
+// 页面通过 WebSocket 连接 /kube/{cluster}/.../pods/{pod}/exec，权限由 /kube 代理检查。
+func RegisterTerminalRoutes(clusters kube.Clusters, router *gin.RouterGroup) TerminalController {
+	ctl := TerminalController{clusters: clusters}
+	// 与资源详情页使用相同的路由参数，否则 /pods/{name} 会进入这条路由的分支而找不到详情页
+	router.GET("/clusters/:cluster/namespaces/:namespace/:resource/:name/terminal", ctl.terminal)
+
+	return ctl
+}
+
+// GET /clusters/{cluster}/namespaces/{namespace}/pods/{pod}/terminal?container=&command=
+//
+// 使用默认 shell 时打开页面即连接；指定了 command 时需要点击 Run 才会执行。
+func (ctl TerminalController) terminal(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if ctx.Param("resource") != "pods" {
+		ctx.Error(apperror.NotFound("page not found"))
+		return
+	}
+	if ctl.clusters.Get(cluster) == nil {
+		ctx.Error(apperror.NotFound(fmt.Sprintf("cluster %q not found", cluster)))
+		return
+	}
+	// exec 不经过 shell，命令按空白拆分为参数
+	command := strings.Fields(ctx.Query("command"))
+	// 链接可以来自其他站点，指定了命令时只展示，用户确认后才执行
+	confirm := len(command) > 0
+	if !confirm {
+		command = defaultTerminalCommand
+	}
+	commandJSON, _ := json.Marshal(command)
+
+	data := pageData(ctx, "Terminal "+ctx.Param("name"))
+	data["cluster"] = cluster
+	data["namespace"] = ctx.Param("namespace")
+	data["pod"] = ctx.Param("name")
+	data["container"] = ctx.Query("container")
+	data["command"] = string(commandJSON)
+	data["commandText"] = strings.Join(command, " ")
+	data["confirm"] = confirm
+	ctx.HTML(http.StatusOK, "kube/terminal.html", data)
+}
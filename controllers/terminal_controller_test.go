@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mysti "go-mysti"
+	"go-mysti/kube"
+	"go-mysti/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTerminalPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cluster, err := kube.NewCluster("prod", newFakeAPIServer(t, http.NotFoundHandler()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.SetHTMLTemplate(template.Must(mysti.BuildTemplate("assets/templates", TemplateFuncs())))
+	RegisterTerminalRoutes(kube.Clusters{cluster}, engine.Group("/", middleware.HTMLErrors("error/error.html")))
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, html.UnescapeString(w.Body.String())
+	}
+
+	code, body := get("/clusters/prod/namespaces/default/pods/web/terminal?container=app&command=/bin/ash+-l")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %s", code, body)
+	}
+	for _, want := range []string{`data-cluster="prod"`, `data-pod="web"`, `data-container="app"`, `data-command="["/bin/ash","-l"]"`, "/static/terminal.js"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+	// 链接指定的命令需要确认后才执行
+	for _, want := range []string{`data-autoconnect="false"`, "<code>/bin/ash -l</code>", ">Run</button>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("custom command page does not contain %s", want)
+		}
+	}
+
+	_, body = get("/clusters/prod/namespaces/default/pods/web/terminal")
+	if !strings.Contains(body, `"sh","-c"`) {
+		t.Error("default command is not used")
+	}
+	if !strings.Contains(body, `data-autoconnect="true"`) || strings.Contains(body, ">Run</button>") {
+		t.Error("default command does not connect automatically")
+	}
+	// 只有空白的命令按默认命令处理
+	if _, body := get("/clusters/prod/namespaces/default/pods/web/terminal?command=+"); !strings.Contains(body, `data-autoconnect="true"`) {
+		t.Error("blank command requires confirmation")
+	}
+	if code, _ := get("/clusters/missing/namespaces/default/pods/web/terminal"); code != http.StatusNotFound {
+		t.Errorf("unknown cluster status = %d", code)
+	}
+}
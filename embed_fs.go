@@ -23,8 +23,12 @@ func GetAssetFS(subPath string) fs.FS {
 	return subFS
 }
 
-func BuildTemplate(subPath string) (*template.Template, error) {
+// 按 templates 下的相对路径命名模板，funcs 在解析前注册
+func BuildTemplate(subPath string, funcs ...template.FuncMap) (*template.Template, error) {
 	tmpl := template.New("")
+	for _, f := range funcs {
+		tmpl.Funcs(f)
+	}
 	fsys := GetAssetFS(subPath)
 
 	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
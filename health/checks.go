@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SQL 检查数据库连接
+func SQL(name string, db *sql.DB) Check {
+	return Check{Name: name, Run: db.PingContext}
+}
+
+// Redis 发送 PING
+func Redis(client *redis.Client) Check {
+	return Check{Name: "redis", Run: func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}}
+}
+
+// Kubernetes 通过 /kube 代理使用的 transport 请求 /version
+func Kubernetes(apiServer string, transport http.RoundTripper) Check {
+	return Check{Name: "kubernetes", Run: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(apiServer, "/")+"/version", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET /version: %s", resp.Status)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,99 @@
+// Package health 执行依赖检查并缓存结果，供 /readyz 使用
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check 是一项依赖检查
+type Check struct {
+	Name string
+	// 返回 nil 表示依赖可用
+	Run func(ctx context.Context) error
+}
+
+// Result 是一项检查的结果
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// OK 表示检查通过
+func (r Result) OK() bool {
+	return r.Status == "ok"
+}
+
+// Checker 并发执行所有检查
+//
+// 每项检查有独立的超时，结果缓存 TTL 时间，探针请求频繁时不会打满依赖；
+// 同一项检查同时只会执行一次，其余请求等待并共享结果。
+type Checker struct {
+	timeout time.Duration
+	ttl     time.Duration
+	checks  []*cachedCheck
+	// 测试时替换为固定的时钟
+	now func() time.Time
+}
+
+type cachedCheck struct {
+	Check
+
+	mu     sync.Mutex
+	result Result
+}
+
+func NewChecker(timeout, ttl time.Duration, checks ...Check) *Checker {
+	c := &Checker{timeout: timeout, ttl: ttl, now: time.Now}
+	for _, check := range checks {
+		c.checks = append(c.checks, &cachedCheck{Check: check})
+	}
+	return c
+}
+
+// Run 返回每项检查的结果，所有检查都通过时 ok 为 true
+func (c *Checker) Run(ctx context.Context) (results map[string]Result, ok bool) {
+	results = make(map[string]Result, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ok = true
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.Name] = result
+			ok = ok && result.OK()
+		}()
+	}
+	wg.Wait()
+	return results, ok
+}
+
+func (c *Checker) run(ctx context.Context, check *cachedCheck) Result {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+
+	now := c.now()
+	if !check.result.CheckedAt.IsZero() && now.Sub(check.result.CheckedAt) < c.ttl {
+		return check.result
+	}
+
+	// 不使用请求的 context，客户端断开时结果仍然可以缓存
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+	err := check.Run(ctx)
+
+	result := Result{Status: "ok", Duration: c.now().Sub(now).Round(time.Microsecond).String(), CheckedAt: now.UTC()}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+	check.result = result
+	return result
+}
@@ -0,0 +1,180 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 返回可以手动拨动的时钟
+func fakeClock(c *Checker) func(time.Duration) {
+	var mu sync.Mutex
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func countingCheck(name string, calls *atomic.Int32, err error) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		calls.Add(1)
+		return err
+	}}
+}
+
+func TestCheckerCache(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second, 10*time.Second, countingCheck("db", &calls, nil))
+	advance := fakeClock(c)
+
+	for range 3 {
+		if _, ok := c.Run(context.Background()); !ok {
+			t.Fatal("Run() not ok")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times within TTL, want 1", n)
+	}
+
+	advance(9 * time.Second)
+	c.Run(context.Background())
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times before TTL expired, want 1", n)
+	}
+
+	advance(time.Second)
+	results, _ := c.Run(context.Background())
+	if n := calls.Load(); n != 2 {
+		t.Errorf("check ran %d times after TTL expired, want 2", n)
+	}
+	if want := time.Date(2024, 6, 1, 12, 0, 10, 0, time.UTC); !results["db"].CheckedAt.Equal(want) {
+		t.Errorf("checked_at = %s, want %s", results["db"].CheckedAt, want)
+	}
+}
+
+func TestCheckerCachesFailures(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second, 10*time.Second, countingCheck("db", &calls, errors.New("connection refused")))
+	fakeClock(c)
+
+	for range 2 {
+		results, ok := c.Run(context.Background())
+		if ok {
+			t.Fatal("Run() ok with a failing check")
+		}
+		if r := results["db"]; r.Status != "fail" || r.Error != "connection refused" {
+			t.Errorf("result = %+v", r)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times, want 1", n)
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	slow := Check{Name: "slow", Run: func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			return nil
+		}
+	}}
+	var calls atomic.Int32
+	c := NewChecker(50*time.Millisecond, time.Second, slow, countingCheck("fast", &calls, nil))
+
+	start := time.Now()
+	results, ok := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Run() took %s, the timeout was not applied", elapsed)
+	}
+	if ok {
+		t.Error("Run() ok with a timed out check")
+	}
+	if r := results["slow"]; r.OK() || r.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow result = %+v", r)
+	}
+	if r := results["fast"]; !r.OK() {
+		t.Errorf("fast result = %+v", r)
+	}
+}
+
+// 请求取消不影响检查，结果仍然缓存
+func TestCheckerIgnoresRequestCancel(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second, time.Minute, Check{Name: "db", Run: func(ctx context.Context) error {
+		calls.Add(1)
+		return ctx.Err()
+	}})
+	fakeClock(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := c.Run(ctx); !ok {
+		t.Error("Run() with a canceled request not ok")
+	}
+	c.Run(context.Background())
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times, want 1", n)
+	}
+}
+
+func TestCheckerAggregation(t *testing.T) {
+	var calls atomic.Int32
+	for _, tc := range []struct {
+		name   string
+		checks []Check
+		want   bool
+	}{
+		{"no checks", nil, true},
+		{"all ok", []Check{countingCheck("a", &calls, nil), countingCheck("b", &calls, nil)}, true},
+		{"one failed", []Check{countingCheck("a", &calls, nil), countingCheck("b", &calls, errors.New("down"))}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results, ok := NewChecker(time.Second, time.Second, tc.checks...).Run(context.Background())
+			if ok != tc.want {
+				t.Errorf("ok = %v, want %v", ok, tc.want)
+			}
+			if len(results) != len(tc.checks) {
+				t.Errorf("got %d results, want %d", len(results), len(tc.checks))
+			}
+		})
+	}
+}
+
+// 并发请求共享同一次检查
+func TestCheckerSingleFlight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := NewChecker(time.Second, time.Minute, Check{Name: "db", Run: func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		return nil
+	}})
+	fakeClock(c)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Run(context.Background())
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times, want 1", n)
+	}
+}
@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go-mysti/model"
+)
+
+// ErrQueueFull 表示缓冲队列已满，调用方应稍后重试
+var ErrQueueFull = errors.New("ingest queue is full")
+
+// ErrClosed 表示 Batcher 已关闭
+var ErrClosed = errors.New("ingest batcher is closed")
+
+// Writer 写入一批数据，通常是 repository.Stats
+type Writer interface {
+	InsertStats(ctx context.Context, rows []model.ContainerStat) error
+}
+
+type Options struct {
+	// 每条 INSERT 最多包含的行数
+	BatchSize int
+	// 缓冲区未满时的刷新间隔
+	FlushInterval time.Duration
+	// 缓冲区最多容纳的行数，超出后 Enqueue 返回 ErrQueueFull
+	QueueSize int
+}
+
+// Batcher 把写入的数据缓冲起来，按批次交给 Writer 写入 container_stats
+type Batcher struct {
+	writer Writer
+	opts   Options
+
+	mu      sync.Mutex
+	pending []model.ContainerStat
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func NewBatcher(writer Writer, opts Options) *Batcher {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.QueueSize < opts.BatchSize {
+		opts.QueueSize = opts.BatchSize * 20
+	}
+	return &Batcher{
+		writer: writer,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Enqueue 把数据放入缓冲区，要么全部接受，要么在队列已满时全部拒绝
+func (b *Batcher) Enqueue(rows []model.ContainerStat) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	if len(b.pending)+len(rows) > b.opts.QueueSize {
+		b.mu.Unlock()
+		return ErrQueueFull
+	}
+	b.pending = append(b.pending, rows...)
+	full := len(b.pending) >= b.opts.BatchSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending 返回缓冲区中尚未写入的行数
+func (b *Batcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// Run 在后台写入数据，直到 Close 被调用，返回前会写完缓冲区中的数据
+func (b *Batcher) Run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.wake:
+		}
+
+		b.mu.Lock()
+		closed := b.closed
+		b.mu.Unlock()
+
+		b.flush()
+		if closed {
+			return
+		}
+	}
+}
+
+// Close 停止接收数据并等待缓冲区写完
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	<-b.done
+}
+
+// 写入缓冲区中的全部数据，失败的批次放回缓冲区等待下次重试
+func (b *Batcher) flush() {
+	for {
+		b.mu.Lock()
+		n := min(len(b.pending), b.opts.BatchSize)
+		if n == 0 {
+			b.mu.Unlock()
+			return
+		}
+		batch := make([]model.ContainerStat, n)
+		copy(batch, b.pending)
+		b.pending = b.pending[n:]
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := b.writer.InsertStats(ctx, batch)
+		cancel()
+		if err != nil {
+			log.Printf("ingest: insert %d rows: %v", len(batch), err)
+
+			b.mu.Lock()
+			if !b.closed && len(b.pending)+len(batch) <= b.opts.QueueSize {
+				b.pending = append(batch, b.pending...)
+			} else {
+				log.Printf("ingest: dropped %d rows", len(batch))
+			}
+			b.mu.Unlock()
+			return
+		}
+	}
+}
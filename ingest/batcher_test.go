@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-mysti/model"
+)
+
+// 记录每次写入的批次，fail 大于 0 时前 fail 次写入失败
+type fakeWriter struct {
+	mu      sync.Mutex
+	batches [][]model.ContainerStat
+	fail    int
+}
+
+func (w *fakeWriter) InsertStats(ctx context.Context, rows []model.ContainerStat) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fail > 0 {
+		w.fail--
+		return errors.New("database is down")
+	}
+	w.batches = append(w.batches, rows)
+	return nil
+}
+
+func (w *fakeWriter) sizes() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var sizes []int
+	for _, b := range w.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func testRows(n int) []model.ContainerStat {
+	rows := make([]model.ContainerStat, n)
+	for i := range rows {
+		rows[i] = model.ContainerStat{ContainerID: "web", PIDs: uint64(i)}
+	}
+	return rows
+}
+
+func TestBatcherQueueFull(t *testing.T) {
+	b := NewBatcher(&fakeWriter{}, Options{BatchSize: 2, QueueSize: 5, FlushInterval: time.Hour})
+	if err := b.Enqueue(testRows(4)); err != nil {
+		t.Fatal(err)
+	}
+	// 要么全部接受，要么全部拒绝
+	if err := b.Enqueue(testRows(2)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("err = %v, want ErrQueueFull", err)
+	}
+	if n := b.Pending(); n != 4 {
+		t.Errorf("pending = %d", n)
+	}
+	if err := b.Enqueue(testRows(1)); err != nil {
+		t.Errorf("enqueue within capacity: %v", err)
+	}
+	if err := b.Enqueue(nil); err != nil {
+		t.Errorf("enqueue nothing: %v", err)
+	}
+}
+
+func TestBatcherFlush(t *testing.T) {
+	w := &fakeWriter{}
+	b := NewBatcher(w, Options{BatchSize: 3, QueueSize: 100, FlushInterval: time.Hour})
+	go b.Run()
+
+	// 达到批次大小时立即写入
+	b.Enqueue(testRows(7))
+	deadline := time.Now().Add(time.Second)
+	for b.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+
+	sizes := w.sizes()
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v", sizes)
+	}
+	if w.batches[2][0].PIDs != 6 {
+		t.Errorf("rows written out of order: %+v", w.batches[2])
+	}
+	if err := b.Enqueue(testRows(1)); !errors.Is(err, ErrClosed) {
+		t.Errorf("enqueue after Close: err = %v", err)
+	}
+}
+
+func TestBatcherRetry(t *testing.T) {
+	w := &fakeWriter{fail: 1}
+	b := NewBatcher(w, Options{BatchSize: 10, QueueSize: 100, FlushInterval: 5 * time.Millisecond})
+	go b.Run()
+
+	b.Enqueue(testRows(2))
+	deadline := time.Now().Add(time.Second)
+	for len(w.sizes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+	// 失败的批次放回队列，下次定时刷新时写入
+	if sizes := w.sizes(); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("batch sizes = %v", sizes)
+	}
+}
+
+func TestBatcherCloseFlushes(t *testing.T) {
+	w := &fakeWriter{}
+	b := NewBatcher(w, Options{BatchSize: 10, QueueSize: 100, FlushInterval: time.Hour})
+	go b.Run()
+	b.Enqueue(testRows(4))
+	b.Close()
+	if sizes := w.sizes(); len(sizes) != 1 || sizes[0] != 4 {
+		t.Errorf("batch sizes after Close = %v", sizes)
+	}
+	// 重复关闭不会阻塞
+	b.Close()
+}
@@ -0,0 +1,229 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mysti/model"
+)
+
+const (
+	maxContainerIDLength   = 64
+	maxContainerNameLength = 255
+	// 允许的时钟偏差
+	maxFutureSkew = 5 * time.Minute
+	// NDJSON 单行最大长度
+	maxLineBytes = 1 << 20
+)
+
+// RowError 是单行数据的校验错误
+type RowError struct {
+	// 从 0 开始的行序号，JSON 数组中为元素下标，NDJSON 中为非空行的序号
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// 写入时接受的字段，time 可以是 RFC3339 字符串或 Unix 秒/毫秒
+type inputRow struct {
+	Time            flexTime `json:"time"`
+	ContainerID     string   `json:"container_id"`
+	ContainerName   string   `json:"container_name"`
+	CPUPercent      float64  `json:"cpu_percent"`
+	MemUsage        uint64   `json:"mem_usage"`
+	MemLimit        uint64   `json:"mem_limit"`
+	MemPercent      float64  `json:"mem_percent"`
+	NetRxBytes      uint64   `json:"net_rx_bytes"`
+	NetTxBytes      uint64   `json:"net_tx_bytes"`
+	BlockReadBytes  uint64   `json:"block_read_bytes"`
+	BlockWriteBytes uint64   `json:"block_write_bytes"`
+	PIDs            uint64   `json:"pids"`
+}
+
+type flexTime struct {
+	time.Time
+}
+
+func (t *flexTime) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return errors.New("time must be RFC3339 or a unix timestamp")
+		}
+		t.Time = parsed
+		return nil
+	}
+	n, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return errors.New("time must be RFC3339 or a unix timestamp")
+	}
+	if n > 1e12 {
+		t.Time = time.UnixMilli(int64(n))
+	} else {
+		sec := int64(n)
+		t.Time = time.Unix(sec, int64((n-float64(sec))*1e9))
+	}
+	return nil
+}
+
+// Decode 解析 JSON 数组或 NDJSON，返回通过校验的行和每行的错误
+//
+// 整体格式错误（例如数组不完整）时返回 error，单行的错误记录在 RowError 中。
+func Decode(r io.Reader, now time.Time) ([]model.ContainerStat, []RowError, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, nil, errors.New("empty body")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if first == '[' {
+		return decodeArray(br, now)
+	}
+	return decodeLines(br, now)
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c, br.UnreadByte()
+		}
+	}
+}
+
+func decodeArray(r io.Reader, now time.Time) ([]model.ContainerStat, []RowError, error) {
+	decoder := json.NewDecoder(r)
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+
+	var rows []model.ContainerStat
+	var rowErrors []RowError
+	for index := 0; decoder.More(); index++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, nil, fmt.Errorf("element %d: %w", index, err)
+		}
+		row, err := parseRow(raw, now)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Index: index, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+	return rows, rowErrors, nil
+}
+
+func decodeLines(r io.Reader, now time.Time) ([]model.ContainerStat, []RowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+
+	var rows []model.ContainerStat
+	var rowErrors []RowError
+	index := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		row, err := parseRow(line, now)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Index: index, Error: err.Error()})
+		} else {
+			rows = append(rows, row)
+		}
+		index++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, rowErrors, nil
+}
+
+func parseRow(data []byte, now time.Time) (model.ContainerStat, error) {
+	var in inputRow
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&in); err != nil {
+		return model.ContainerStat{}, cleanJSONError(err)
+	}
+	if err := in.validate(now); err != nil {
+		return model.ContainerStat{}, err
+	}
+	return model.ContainerStat{
+		Time:            in.Time.UTC(),
+		ContainerID:     in.ContainerID,
+		ContainerName:   in.ContainerName,
+		CPUPercent:      in.CPUPercent,
+		MemUsage:        in.MemUsage,
+		MemLimit:        in.MemLimit,
+		MemPercent:      in.MemPercent,
+		NetRxBytes:      in.NetRxBytes,
+		NetTxBytes:      in.NetTxBytes,
+		BlockReadBytes:  in.BlockReadBytes,
+		BlockWriteBytes: in.BlockWriteBytes,
+		PIDs:            in.PIDs,
+	}, nil
+}
+
+// Validate 校验一行数据，采集器写入前也使用同样的规则
+func Validate(s *model.ContainerStat, now time.Time) error {
+	in := inputRow{
+		Time:          flexTime{s.Time},
+		ContainerID:   s.ContainerID,
+		ContainerName: s.ContainerName,
+		CPUPercent:    s.CPUPercent,
+		MemPercent:    s.MemPercent,
+	}
+	return in.validate(now)
+}
+
+func (in *inputRow) validate(now time.Time) error {
+	switch {
+	case in.Time.IsZero():
+		return errors.New("time is required")
+	case in.Time.After(now.Add(maxFutureSkew)):
+		return fmt.Errorf("time %s is in the future", in.Time.UTC().Format(time.RFC3339))
+	case strings.TrimSpace(in.ContainerID) == "":
+		return errors.New("container_id is required")
+	case len(in.ContainerID) > maxContainerIDLength:
+		return fmt.Errorf("container_id exceeds %d characters", maxContainerIDLength)
+	case len(in.ContainerName) > maxContainerNameLength:
+		return fmt.Errorf("container_name exceeds %d characters", maxContainerNameLength)
+	case in.CPUPercent < 0:
+		return errors.New("cpu_percent must not be negative")
+	case in.MemPercent < 0 || in.MemPercent > 100:
+		return errors.New("mem_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// 去掉 json 包错误信息中的 Go 类型名
+func cleanJSONError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return fmt.Errorf("expected an object, got %s", typeErr.Value)
+		}
+		return fmt.Errorf("%s: invalid value %s", typeErr.Field, typeErr.Value)
+	}
+	return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+}
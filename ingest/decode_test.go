@@ -0,0 +1,93 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		accepted int
+		errors   []RowError
+	}{
+		{"array", `[{"time":"2024-05-01T11:59:00Z","container_id":"web","cpu_percent":1.5},
+			{"time":1714564740,"container_id":"db"}]`, 2, nil},
+		{"empty array", " [ ] ", 0, nil},
+		{"ndjson", `{"time":"2024-05-01T11:59:00Z","container_id":"web"}
+
+{"time":1714564740000,"container_id":"db"}
+`, 2, nil},
+		{"array row errors", `[{"time":"2024-05-01T11:59:00Z","container_id":"web"},
+			{"container_id":"db"},
+			{"time":"2024-05-01T11:59:00Z","container_id":"db","mem_percent":101},
+			{"time":"2024-05-01T11:59:00Z","container_id":"db","unknown":1},
+			{"time":"2024-05-01T11:59:00Z","container_id":"db","pids":"many"},
+			"not an object"]`, 1, []RowError{
+			{1, "time is required"},
+			{2, "mem_percent must be between 0 and 100"},
+			{3, `unknown field "unknown"`},
+			{4, "pids: invalid value string"},
+			{5, "expected an object, got string"},
+		}},
+		// NDJSON 的序号不计空行
+		{"ndjson row errors", `{"time":"yesterday","container_id":"web"}
+
+{"time":"2024-05-01T13:00:00Z","container_id":"web"}
+{"time":"2024-05-01T11:59:00Z","container_id":""}
+{"time":"2024-05-01T11:59:00Z","container_id":"web","cpu_percent":-1}
+`, 0, []RowError{
+			{0, "time must be RFC3339 or a unix timestamp"},
+			{1, "time 2024-05-01T13:00:00Z is in the future"},
+			{2, "container_id is required"},
+			{3, "cpu_percent must not be negative"},
+		}},
+	}
+	for _, tt := range tests {
+		rows, rowErrors, err := Decode(strings.NewReader(tt.body), testNow)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(rows) != tt.accepted || len(rowErrors) != len(tt.errors) {
+			t.Errorf("%s: %d rows, errors %+v", tt.name, len(rows), rowErrors)
+			continue
+		}
+		for i, want := range tt.errors {
+			if got := rowErrors[i]; got.Index != want.Index || !strings.Contains(got.Error, want.Error) {
+				t.Errorf("%s: error %d = %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeTime(t *testing.T) {
+	body := `{"time":1714564740,"container_id":"a"}
+{"time":1714564740.5,"container_id":"b"}
+{"time":1714564740250,"container_id":"c"}
+{"time":"2024-05-01T13:59:00+02:00","container_id":"d"}`
+	rows, rowErrors, err := Decode(strings.NewReader(body), testNow)
+	if err != nil || len(rowErrors) > 0 {
+		t.Fatal(err, rowErrors)
+	}
+	base := time.Date(2024, 5, 1, 11, 59, 0, 0, time.UTC)
+	want := []time.Time{base, base.Add(500 * time.Millisecond), base.Add(250 * time.Millisecond), base}
+	for i, row := range rows {
+		if !row.Time.Equal(want[i]) || row.Time.Location() != time.UTC {
+			t.Errorf("row %s time = %s, want %s", row.ContainerID, row.Time, want[i])
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, body := range []string{"", "  \n", `[{"time":1,"container_id":"a"}`, `[{"time":1,"container_id":"a"} {}]`,
+		`{"container_id":"` + strings.Repeat("x", maxLineBytes) + `"}`} {
+		if _, _, err := Decode(strings.NewReader(body), testNow); err == nil {
+			t.Errorf("Decode(%.40q) succeeded", body)
+		}
+	}
+}
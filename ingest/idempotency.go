@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrKeyReused 表示同一个 Idempotency-Key 用于了不同的请求体
+var ErrKeyReused = errors.New("Idempotency-Key was already used with a different request body")
+
+// Response 是缓存的响应，相同的 Idempotency-Key 重试时原样返回
+type Response struct {
+	Status int
+	Body   any
+}
+
+type idempotencyEntry struct {
+	key string
+	// 请求体的摘要，同一个 key 只能用于相同的请求体
+	fingerprint string
+	response    *Response
+	expires     time.Time
+	// 请求仍在处理中
+	inflight bool
+}
+
+// IdempotencyCache 在内存中保存最近的响应，超过容量时淘汰最早的记录
+//
+// key 由调用方按认证身份区分，不同用户使用相同的 Idempotency-Key 互不影响。
+type IdempotencyCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func NewIdempotencyCache(ttl time.Duration, maxSize int) *IdempotencyCache {
+	return &IdempotencyCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Begin 开始处理一个请求
+//
+// 同一个 key 的请求体摘要不同时返回 ErrKeyReused；已有缓存的响应时返回该响应；
+// 同一个 key 的请求仍在处理中时 inflight 为 true；
+// 否则记录为处理中，调用方处理完成后必须调用 Finish 或 Abort。
+func (c *IdempotencyCache) Begin(key, fingerprint string) (cached *Response, inflight bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*idempotencyEntry)
+		if !entry.inflight && !now.Before(entry.expires) {
+			c.remove(elem)
+		} else {
+			if entry.fingerprint != fingerprint {
+				return nil, false, ErrKeyReused
+			}
+			if entry.inflight {
+				return nil, true, nil
+			}
+			return entry.response, false, nil
+		}
+	}
+
+	c.evict(now)
+	elem := c.order.PushBack(&idempotencyEntry{key: key, fingerprint: fingerprint, inflight: true})
+	c.entries[key] = elem
+	return nil, false, nil
+}
+
+// Finish 保存响应
+func (c *IdempotencyCache) Finish(key string, response *Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*idempotencyEntry)
+		entry.response = response
+		entry.inflight = false
+		entry.expires = time.Now().Add(c.ttl)
+	}
+}
+
+// Abort 放弃处理，客户端可以使用同一个 key 重试
+func (c *IdempotencyCache) Abort(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// 删除过期记录，并在超过容量时删除最早的已完成记录
+func (c *IdempotencyCache) evict(now time.Time) {
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*idempotencyEntry)
+		if !entry.inflight && (now.After(entry.expires) || c.order.Len() >= c.maxSize) {
+			c.remove(elem)
+		} else if !entry.inflight {
+			break
+		}
+		elem = next
+	}
+}
+
+func (c *IdempotencyCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*idempotencyEntry).key)
+}
@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	c := NewIdempotencyCache(time.Hour, 10)
+
+	if cached, inflight, err := c.Begin("a", "h1"); cached != nil || inflight || err != nil {
+		t.Fatalf("first Begin = %v, %v, %v", cached, inflight, err)
+	}
+	if _, inflight, err := c.Begin("a", "h1"); !inflight || err != nil {
+		t.Errorf("Begin while in flight = %v, %v", inflight, err)
+	}
+	// 不同的请求体优先报告 key 被复用
+	if _, _, err := c.Begin("a", "h2"); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("Begin with another body while in flight: err = %v", err)
+	}
+
+	c.Finish("a", &Response{Status: 202, Body: "ok"})
+	if cached, inflight, err := c.Begin("a", "h1"); cached == nil || cached.Status != 202 || inflight || err != nil {
+		t.Errorf("Begin after Finish = %v, %v, %v", cached, inflight, err)
+	}
+	if _, _, err := c.Begin("a", "h2"); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("Begin with another body: err = %v", err)
+	}
+
+	// Abort 之后可以用任意请求体重试
+	c.Begin("b", "h1")
+	c.Abort("b")
+	if cached, inflight, err := c.Begin("b", "h2"); cached != nil || inflight || err != nil {
+		t.Errorf("Begin after Abort = %v, %v, %v", cached, inflight, err)
+	}
+}
+
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	c := NewIdempotencyCache(time.Millisecond, 10)
+	c.Begin("a", "h1")
+	c.Finish("a", &Response{Status: 202})
+	time.Sleep(5 * time.Millisecond)
+	// 过期后 key 可以用于新的请求体
+	if cached, inflight, err := c.Begin("a", "h2"); cached != nil || inflight || err != nil {
+		t.Errorf("Begin after expiry = %v, %v, %v", cached, inflight, err)
+	}
+}
+
+func TestIdempotencyCacheEviction(t *testing.T) {
+	c := NewIdempotencyCache(time.Hour, 3)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Begin(key, "h")
+		c.Finish(key, &Response{Status: 202})
+	}
+	c.Begin("d", "h")
+	if c.order.Len() > 3 {
+		t.Errorf("cache holds %d entries", c.order.Len())
+	}
+	if cached, _, _ := c.Begin("a", "h"); cached != nil {
+		t.Error("oldest entry was not evicted")
+	}
+	if cached, _, _ := c.Begin("c", "h"); cached == nil {
+		t.Error("newest finished entry was evicted")
+	}
+
+	// 处理中的记录不会被淘汰
+	c = NewIdempotencyCache(time.Hour, 2)
+	c.Begin("a", "h")
+	c.Begin("b", "h")
+	c.Begin("c", "h")
+	if _, inflight, _ := c.Begin("a", "h"); !inflight {
+		t.Error("in-flight entry was evicted")
+	}
+}
@@ -0,0 +1,92 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-mysti/model"
+)
+
+// Claims 是 token 中的声明
+type Claims map[string]any
+
+// 按 a.b.c 形式的路径取值，用于 realm_access.roles 这类嵌套声明
+func (c Claims) lookup(path string) (any, bool) {
+	var v any = map[string]any(c)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// String 返回字符串声明，不存在或类型不对时返回空字符串
+func (c Claims) String(path string) string {
+	v, _ := c.lookup(path)
+	s, _ := v.(string)
+	return s
+}
+
+// Strings 返回字符串数组声明，单个字符串按空格拆分（例如 scope）
+func (c Claims) Strings(path string) []string {
+	v, _ := c.lookup(path)
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// ClaimMapping 把声明映射为用户
+type ClaimMapping struct {
+	// 用户名使用的声明，默认为 sub
+	UsernameClaim string
+	// 角色使用的声明，支持 a.b 形式的嵌套路径，为空时不映射角色
+	RolesClaim string
+}
+
+// User 根据声明创建用户，token 用户不在 users 表中，ID 为 0
+func (m ClaimMapping) User(claims Claims) (*model.User, error) {
+	usernameClaim := m.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "sub"
+	}
+	username := claims.String(usernameClaim)
+	if username == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, usernameClaim)
+	}
+	user := &model.User{Username: username, Roles: []string{}}
+	if m.RolesClaim != "" {
+		if roles := claims.Strings(m.RolesClaim); roles != nil {
+			user.Roles = roles
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,205 @@
+// Package jwtauth 校验 JWT bearer token
+//
+// 支持 RS256/384/512、PS256/384/512、ES256/384/512、EdDSA 以及使用共享密钥的 HS256/384/512，
+// 公钥可以来自 PEM 文件、JWKS 文件或 OIDC 提供方的 JWKS URL。
+package jwtauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken 表示 token 格式、签名或声明不合法，错误信息可以返回给客户端
+var ErrInvalidToken = errors.New("invalid token")
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type Options struct {
+	Keys KeySource
+	// 要求 iss 等于该值，为空时不检查
+	Issuer string
+	// 要求 aud 包含其中之一，为空时不检查
+	Audiences []string
+	// 校验 exp、nbf、iat 时允许的时钟偏差
+	Leeway time.Duration
+}
+
+// Verifier 校验 token 的签名和标准声明
+type Verifier struct {
+	opts Options
+	now  func() time.Time
+}
+
+func NewVerifier(opts Options) *Verifier {
+	return &Verifier{opts: opts, now: time.Now}
+}
+
+// Verify 校验 token 并返回其中的声明
+//
+// 签名、格式或声明不合法时返回的错误包装了 ErrInvalidToken；获取公钥失败时返回其他错误。
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("malformed token")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, invalid("malformed header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed signature")
+	}
+	hash, ok := algorithmHashes[h.Alg]
+	if !ok {
+		return nil, invalid("unsupported algorithm %q", h.Alg)
+	}
+
+	keys, err := v.opts.Keys.Keys(ctx, h.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("load verification keys: %w", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if key.ID != "" && h.Kid != "" && key.ID != h.Kid {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != h.Alg {
+			continue
+		}
+		if verifySignature(h.Alg, hash, key.Key, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalid("signature verification failed")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalid("malformed claims")
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validate(claims Claims) error {
+	now := v.now()
+	leeway := v.opts.Leeway
+
+	exp, ok := claims.time("exp")
+	if !ok {
+		return invalid("missing exp claim")
+	}
+	if !now.Before(exp.Add(leeway)) {
+		return invalid("token expired")
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return invalid("token not valid yet")
+	}
+	if iat, ok := claims.time("iat"); ok && now.Add(leeway).Before(iat) {
+		return invalid("token issued in the future")
+	}
+
+	if v.opts.Issuer != "" && claims.String("iss") != v.opts.Issuer {
+		return invalid("unexpected issuer")
+	}
+	if len(v.opts.Audiences) > 0 {
+		aud := claims.Strings("aud")
+		if !slices.ContainsFunc(v.opts.Audiences, func(a string) bool { return slices.Contains(aud, a) }) {
+			return invalid("unexpected audience")
+		}
+	}
+	return nil
+}
+
+var algorithmHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+// 密钥类型必须与算法匹配，避免把 RSA 公钥当作 HMAC 密钥使用
+func verifySignature(alg string, hash crypto.Hash, key any, signed, sig []byte) bool {
+	digest := func() []byte {
+		h := hash.New()
+		h.Write(signed)
+		return h.Sum(nil)
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest(), sig) == nil
+		case "PS":
+			return rsa.VerifyPSS(k, hash, digest(), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size || curveAlgorithm(k) != alg {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest(), r, s)
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(k, signed, sig)
+	case []byte:
+		if alg[:2] != "HS" {
+			return false
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	}
+	return false
+}
+
+func curveAlgorithm(k *ecdsa.PublicKey) string {
+	switch k.Curve.Params().BitSize {
+	case 256:
+		return "ES256"
+	case 384:
+		return "ES384"
+	case 521:
+		return "ES512"
+	}
+	return ""
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
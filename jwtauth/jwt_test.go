@@ -0,0 +1,299 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.test"
+	testAudience = "mysti"
+)
+
+var b64 = base64.RawURLEncoding.EncodeToString
+
+// 签名 token，signer 返回对 "header.payload" 的签名
+func signToken(t *testing.T, header map[string]any, claims map[string]any, signer func([]byte) []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := b64(h) + "." + b64(c)
+	return signed + "." + b64(signer([]byte(signed)))
+}
+
+func rsaSigner(key *rsa.PrivateKey) func([]byte) []byte {
+	return func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			panic(err)
+		}
+		return sig
+	}
+}
+
+func ecSigner(key *ecdsa.PrivateKey) func([]byte) []byte {
+	return func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			panic(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+}
+
+func hmacSigner(secret []byte) func([]byte) []byte {
+	return func(data []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   testIssuer,
+		"aud":   []string{"other", testAudience},
+		"sub":   "ci-bot",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"roles": []string{"viewer", "ingest"},
+	}
+}
+
+func newTestVerifier(keys KeySource) *Verifier {
+	return NewVerifier(Options{Keys: keys, Issuer: testIssuer, Audiences: []string{testAudience}, Leeway: time.Minute})
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(StaticKeys(Key{Key: &key.PublicKey}))
+	header := map[string]any{"alg": "RS256", "typ": "JWT"}
+
+	claims, err := v.Verify(context.Background(), signToken(t, header, validClaims(), rsaSigner(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := ClaimMapping{RolesClaim: "roles"}.User(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "ci-bot" || !slices.Equal(user.Roles, []string{"viewer", "ingest"}) {
+		t.Errorf("user = %+v", user)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]any)
+		want   string
+	}{
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, "token expired"},
+		{"missing exp", func(c map[string]any) { delete(c, "exp") }, "missing exp claim"},
+		{"not yet valid", func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, "not valid yet"},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.test" }, "unexpected issuer"},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "other" }, "unexpected audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validClaims()
+			tt.modify(c)
+			_, err := v.Verify(context.Background(), signToken(t, header, c, rsaSigner(key)))
+			if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// 篡改声明后签名不再匹配
+	token := signToken(t, header, validClaims(), rsaSigner(key))
+	parts := strings.Split(token, ".")
+	forged := validClaims()
+	forged["sub"] = "admin"
+	payload, _ := json.Marshal(forged)
+	if _, err := v.Verify(context.Background(), parts[0]+"."+b64(payload)+"."+parts[2]); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("tampered token: err = %v", err)
+	}
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(StaticKeys(Key{Key: &key.PublicKey}))
+
+	// alg=none
+	none := signToken(t, map[string]any{"alg": "none"}, validClaims(), func([]byte) []byte { return nil })
+	if _, err := v.Verify(context.Background(), none); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("alg none: err = %v", err)
+	}
+
+	// 用 RSA 公钥作为 HMAC 密钥签名
+	der, _ := json.Marshal(key.PublicKey)
+	hs := signToken(t, map[string]any{"alg": "HS256"}, validClaims(), hmacSigner(der))
+	if _, err := v.Verify(context.Background(), hs); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("HS256 with RSA key: err = %v", err)
+	}
+}
+
+func TestVerifyHMACAndEdDSA(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(StaticKeys(Key{Key: secret}, Key{ID: "ed", Key: pub}))
+
+	hs := signToken(t, map[string]any{"alg": "HS256"}, validClaims(), hmacSigner(secret))
+	if _, err := v.Verify(context.Background(), hs); err != nil {
+		t.Errorf("HS256: %v", err)
+	}
+	ed := signToken(t, map[string]any{"alg": "EdDSA", "kid": "ed"}, validClaims(), func(data []byte) []byte {
+		return ed25519.Sign(priv, data)
+	})
+	if _, err := v.Verify(context.Background(), ed); err != nil {
+		t.Errorf("EdDSA: %v", err)
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]any {
+	return map[string]any{
+		"kty": "EC", "crv": "P-256", "kid": kid, "alg": "ES256", "use": "sig",
+		"x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]any {
+	return map[string]any{
+		"kty": "RSA", "kid": kid, "alg": "RS256",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestJWKSURLRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	var jwks atomic.Value
+	jwks.Store([]any{ecJWK("old", &oldKey.PublicKey)})
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": jwks.Load()})
+	}))
+	defer srv.Close()
+
+	source := JWKSURL(srv.URL, srv.Client(), time.Hour).(*jwksURL)
+	v := newTestVerifier(source)
+
+	token := signToken(t, map[string]any{"alg": "ES256", "kid": "old"}, validClaims(), ecSigner(oldKey))
+	for range 3 {
+		if _, err := v.Verify(context.Background(), token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1 (cached)", n)
+	}
+
+	// 轮换后出现新的 kid，超过最小刷新间隔时重新获取
+	jwks.Store([]any{ecJWK("old", &oldKey.PublicKey), ecJWK("new", &newKey.PublicKey)})
+	source.attemptedAt = time.Now().Add(-minJWKSRefreshInterval)
+	token = signToken(t, map[string]any{"alg": "ES256", "kid": "new"}, validClaims(), ecSigner(newKey))
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+
+	// 未知 kid 在最小刷新间隔内不会再次请求
+	token = signToken(t, map[string]any{"alg": "ES256", "kid": "unknown"}, validClaims(), ecSigner(newKey))
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown kid: err = %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2 (rate limited)", n)
+	}
+}
+
+func TestJWKSFileReload(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	write := func(keys ...any) {
+		data, _ := json.Marshal(map[string]any{"keys": keys})
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(rsaJWK("k1", &key1.PublicKey))
+	v := newTestVerifier(JWKSFile(path))
+
+	token1 := signToken(t, map[string]any{"alg": "RS256", "kid": "k1"}, validClaims(), rsaSigner(key1))
+	if _, err := v.Verify(context.Background(), token1); err != nil {
+		t.Fatal(err)
+	}
+
+	write(rsaJWK("k2", &key2.PublicKey))
+	// 保证修改时间变化
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+
+	token2 := signToken(t, map[string]any{"alg": "RS256", "kid": "k2"}, validClaims(), rsaSigner(key2))
+	if _, err := v.Verify(context.Background(), token2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(context.Background(), token1); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("removed key still accepted: err = %v", err)
+	}
+}
+
+func TestClaimMappingNestedRoles(t *testing.T) {
+	claims := Claims{"preferred_username": "alice", "realm_access": map[string]any{"roles": []any{"admin"}}}
+	user, err := ClaimMapping{UsernameClaim: "preferred_username", RolesClaim: "realm_access.roles"}.User(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || fmt.Sprint(user.Roles) != "[admin]" {
+		t.Errorf("user = %+v", user)
+	}
+	if _, err := (ClaimMapping{}).User(Claims{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("missing sub: err = %v", err)
+	}
+}
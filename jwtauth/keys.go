@@ -0,0 +1,301 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Key 是一个校验密钥
+type Key struct {
+	// kid，为空时可以校验任意 kid 的 token
+	ID string
+	// 限定的算法，为空时按密钥类型匹配
+	Algorithm string
+	// *rsa.PublicKey、*ecdsa.PublicKey、ed25519.PublicKey 或 HMAC 共享密钥 []byte
+	Key any
+}
+
+// KeySource 提供校验密钥，kid 是 token 头中的 kid，来源可以据此决定是否需要刷新
+type KeySource interface {
+	Keys(ctx context.Context, kid string) ([]Key, error)
+}
+
+type staticKeys []Key
+
+func (s staticKeys) Keys(context.Context, string) ([]Key, error) {
+	return s, nil
+}
+
+// StaticKeys 返回固定的密钥
+func StaticKeys(keys ...Key) KeySource {
+	return staticKeys(keys)
+}
+
+type multiSource []KeySource
+
+func (m multiSource) Keys(ctx context.Context, kid string) ([]Key, error) {
+	var keys []Key
+	var errs []error
+	for _, source := range m {
+		k, err := source.Keys(ctx, kid)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, k...)
+	}
+	// 部分来源失败时仍然使用其余来源的密钥
+	if len(keys) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return keys, nil
+}
+
+// MultiSource 合并多个密钥来源
+func MultiSource(sources ...KeySource) KeySource {
+	return multiSource(sources)
+}
+
+// LoadPEMKey 读取 PEM 格式的公钥或证书，kid 为文件中可选的 "kid" 头
+func LoadPEMKey(file string) (Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("%s: no PEM block found", file)
+	}
+	var pub any
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	default:
+		return Key{}, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return Key{ID: block.Headers["kid"], Key: pub}, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS 解析 JWK Set，跳过不支持的和非签名用途的密钥
+//
+// 对称密钥（kty=oct）不会从 JWKS 中加载。
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+	keys := make([]Key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parse JWKS key %q: %w", k.Kid, err)
+		}
+		if pub != nil {
+			keys = append(keys, Key{ID: k.Kid, Algorithm: k.Alg, Key: pub})
+		}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64(k.N)
+		e, err2 := b64(k.E)
+		if err := errors.Join(err1, err2); err != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := b64(k.X)
+		y, err2 := b64(k.Y)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := b64(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+type jwksFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []Key
+}
+
+// JWKSFile 从文件读取 JWKS，文件修改后自动重新加载，便于挂载 Secret 后轮换密钥
+func JWKSFile(path string) KeySource {
+	return &jwksFile{path: path}
+}
+
+func (f *jwksFile) Keys(context.Context, string) ([]Key, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.keys != nil && info.ModTime().Equal(f.modTime) {
+		return f.keys, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	f.keys, f.modTime = keys, info.ModTime()
+	return keys, nil
+}
+
+// 两次请求 JWKS 的最小间隔，防止伪造的 kid 或 IdP 故障时每个请求都去访问 IdP
+const minJWKSRefreshInterval = 10 * time.Second
+
+type jwksURL struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+
+	mu          sync.Mutex
+	keys        []Key
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error
+}
+
+// JWKSURL 从 URL 获取 JWKS 并缓存 refresh 时间，遇到未知 kid 时提前刷新
+//
+// client 为 nil 时使用 10 秒超时的默认客户端，refresh 默认为 10 分钟。
+func JWKSURL(url string, client *http.Client, refresh time.Duration) KeySource {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if refresh <= 0 {
+		refresh = 10 * time.Minute
+	}
+	return &jwksURL{url: url, client: client, refresh: refresh}
+}
+
+func (u *jwksURL) Keys(ctx context.Context, kid string) ([]Key, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stale := u.keys == nil || time.Since(u.fetchedAt) >= u.refresh || (kid != "" && !hasKey(u.keys, kid))
+	if !stale || time.Since(u.attemptedAt) < minJWKSRefreshInterval {
+		if u.keys == nil {
+			return nil, u.lastErr
+		}
+		return u.keys, nil
+	}
+
+	u.attemptedAt = time.Now()
+	keys, err := u.fetch(ctx)
+	if err != nil {
+		u.lastErr = err
+		// 刷新失败时继续使用旧的密钥
+		if u.keys != nil {
+			return u.keys, nil
+		}
+		return nil, err
+	}
+	u.keys, u.fetchedAt, u.lastErr = keys, time.Now(), nil
+	return keys, nil
+}
+
+func (u *jwksURL) fetch(ctx context.Context) ([]Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u.url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+func hasKey(keys []Key, kid string) bool {
+	for _, k := range keys {
+		if k.ID == kid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package kube
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster 是一个可以通过 /kube/{name}/ 访问的 API server
+type Cluster struct {
+	Name string
+	// API server 地址，可能带有前置代理的路径前缀，例如 https://rancher/k8s/clusters/c-xxx
+	Server *url.URL
+	// 负责认证和 TLS
+	Transport http.RoundTripper
+	// 使用同一个 Transport 的 typed client，供资源浏览页面使用
+	Client kubernetes.Interface
+}
+
+// NewCluster 根据 rest.Config 创建集群
+//
+// 只使用 token 文件和 CA 文件认证时（集群内配置）使用 Transport，token 和 CA 轮换后自动重新加载；
+// 其他情况（客户端证书、exec 插件等）使用 client-go 的 transport。
+func NewCluster(name string, cfg *rest.Config) (*Cluster, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid cluster name %q: must be non-empty and must not contain /", name)
+	}
+	server, _, err := rest.DefaultServerUrlFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", name, err)
+	}
+
+	var transport http.RoundTripper
+	if tokenFileOnly(cfg) {
+		transport = NewTransport(cfg.BearerTokenFile, cfg.CAFile)
+	} else if transport, err = rest.TransportFor(cfg); err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", name, err)
+	}
+	client, err := kubernetes.NewForConfigAndClient(rest.CopyConfig(cfg), &http.Client{Transport: transport})
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", name, err)
+	}
+	return &Cluster{Name: name, Server: server, Transport: transport, Client: client}, nil
+}
+
+func tokenFileOnly(cfg *rest.Config) bool {
+	return cfg.BearerTokenFile != "" && cfg.BearerToken == "" && cfg.CAFile != "" && len(cfg.CAData) == 0 &&
+		cfg.CertFile == "" && len(cfg.CertData) == 0 && cfg.Username == "" && !cfg.Insecure && cfg.ServerName == "" &&
+		cfg.ExecProvider == nil && cfg.AuthProvider == nil && cfg.Impersonate.UserName == "" &&
+		cfg.Proxy == nil && cfg.WrapTransport == nil && cfg.Transport == nil
+}
+
+// Options 描述要连接的集群，对应配置中的 kubernetes 部分
+type Options struct {
+	// 本地集群的名称
+	Name string
+	// 使用 rest.InClusterConfig，忽略 APIServer、TokenFile 和 CACertFile
+	InCluster bool
+	// 为空且 InCluster 为 false 时没有本地集群
+	APIServer  string
+	TokenFile  string
+	CACertFile string
+	// kubeconfig 中的每个 context 作为一个集群，名称为 context 名
+	Kubeconfig string
+	// 使用的 context，为空时使用全部
+	Contexts []string
+}
+
+// Clusters 是按配置顺序排列的集群，第一个是默认集群
+type Clusters []*Cluster
+
+// Get 按名称查找集群，不存在时返回 nil
+func (c Clusters) Get(name string) *Cluster {
+	for _, cluster := range c {
+		if cluster.Name == name {
+			return cluster
+		}
+	}
+	return nil
+}
+
+// CloseIdleConnections 关闭所有集群的空闲连接
+func (c Clusters) CloseIdleConnections() {
+	for _, cluster := range c {
+		if closer, ok := cluster.Transport.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
+
+// LoadClusters 创建本地集群和 kubeconfig 中的集群，都没有配置时返回空列表
+func LoadClusters(opts Options) (Clusters, error) {
+	var clusters Clusters
+	add := func(name string, cfg *rest.Config) error {
+		if clusters.Get(name) != nil {
+			return fmt.Errorf("duplicate cluster name %q", name)
+		}
+		cluster, err := NewCluster(name, cfg)
+		if err != nil {
+			return err
+		}
+		clusters = append(clusters, cluster)
+		return nil
+	}
+
+	switch {
+	case opts.InCluster:
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+		// InClusterConfig 同时设置了读取一次的 BearerToken，清空后按文件轮换；允许覆盖默认的文件位置，便于测试
+		cfg.BearerToken = ""
+		if opts.TokenFile != "" {
+			cfg.BearerTokenFile = opts.TokenFile
+		}
+		if opts.CACertFile != "" {
+			cfg.CAFile = opts.CACertFile
+		}
+		if err := add(opts.Name, cfg); err != nil {
+			return nil, err
+		}
+	case opts.APIServer != "":
+		cfg := &rest.Config{
+			Host:            opts.APIServer,
+			BearerTokenFile: opts.TokenFile,
+			TLSClientConfig: rest.TLSClientConfig{CAFile: opts.CACertFile},
+		}
+		if err := add(opts.Name, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Kubeconfig != "" {
+		// 使用 loading rules 读取，kubeconfig 中的相对路径按文件所在目录解析
+		raw, err := (&clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.Kubeconfig}).Load()
+		if err != nil {
+			return nil, err
+		}
+		contexts := opts.Contexts
+		if len(contexts) == 0 {
+			for name := range raw.Contexts {
+				contexts = append(contexts, name)
+			}
+			slices.Sort(contexts)
+		}
+		for _, name := range contexts {
+			if _, ok := raw.Contexts[name]; !ok {
+				return nil, fmt.Errorf("%s: context %q not found", opts.Kubeconfig, name)
+			}
+			cfg, err := clientcmd.NewNonInteractiveClientConfig(*raw, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+			if err != nil {
+				return nil, fmt.Errorf("%s: context %s: %w", opts.Kubeconfig, name, err)
+			}
+			if err := add(name, cfg); err != nil {
+				return nil, fmt.Errorf("%s: %w", opts.Kubeconfig, err)
+			}
+		}
+	}
+	return clusters, nil
+}
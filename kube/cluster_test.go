@@ -0,0 +1,97 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+    insecure-skip-tls-verify: true
+- name: rancher
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/c-abc
+    certificate-authority: ca.crt
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: staging
+  context: {cluster: rancher, user: admin}
+users:
+- name: admin
+  user: {token: secret}
+`
+
+func writeKubeconfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// 相对路径按 kubeconfig 所在目录解析
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), selfSignedPEM(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadClusters(t *testing.T) {
+	s := newFakeAPIServer(t)
+	token := s.write(t, "token", []byte("token"))
+	ca := s.write(t, "ca.crt", s.caPEM())
+
+	clusters, err := LoadClusters(Options{Name: "local", APIServer: s.URL, TokenFile: token, CACertFile: ca, Kubeconfig: writeKubeconfig(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range clusters {
+		names = append(names, c.Name+"="+c.Server.String())
+	}
+	want := "local=" + s.URL + " prod=https://prod.example.com:6443 staging=https://rancher.example.com/k8s/clusters/c-abc"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("clusters = %s, want %s", got, want)
+	}
+	// 只使用 token 文件的集群使用可以重新加载的 Transport
+	if _, ok := clusters.Get("local").Transport.(*Transport); !ok {
+		t.Errorf("local transport = %T", clusters.Get("local").Transport)
+	}
+	if _, ok := clusters.Get("prod").Transport.(*Transport); ok {
+		t.Error("kubeconfig cluster should use the client-go transport")
+	}
+	if clusters.Get("missing") != nil {
+		t.Error("Get(missing) != nil")
+	}
+}
+
+func TestLoadClustersErrors(t *testing.T) {
+	kubeconfig := writeKubeconfig(t)
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Kubeconfig: kubeconfig, Contexts: []string{"dev"}}, `context "dev" not found`},
+		{Options{Name: "prod", APIServer: "https://local", Kubeconfig: kubeconfig}, `duplicate cluster name "prod"`},
+		{Options{Name: "a/b", APIServer: "https://local"}, "invalid cluster name"},
+		{Options{Kubeconfig: filepath.Join(t.TempDir(), "missing")}, "no such file"},
+	}
+	for _, tt := range tests {
+		_, err := LoadClusters(tt.opts)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadClusters(%+v) = %v, want %q", tt.opts, err, tt.want)
+		}
+	}
+
+	clusters, err := LoadClusters(Options{Kubeconfig: kubeconfig, Contexts: []string{"staging"}})
+	if err != nil || len(clusters) != 1 || clusters[0].Name != "staging" {
+		t.Errorf("contexts filter: %v %v", clusters, err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package kube 提供访问 Kubernetes API server 的长连接 transport
+package kube
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 集群内的默认地址和 service account 文件位置，用作配置默认值，测试时可以修改
+var (
+	DefaultAPIServer  = "https://kubernetes.default.svc"
+	DefaultTokenFile  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	DefaultCACertFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// ErrCredentials 表示 token 或 CA 证书不可用，调用方应返回 503 而不是 502
+var ErrCredentials = errors.New("kubernetes credentials are not available")
+
+const (
+	// 两次检查文件是否变化的最小间隔，与 client-go 的 cachingTokenSource 一致
+	fileRecheckInterval = time.Minute
+	// token 在过期前这么久重新读取，kubelet 会在有效期过去 80% 时轮换
+	tokenExpiryMargin = 10 * time.Second
+)
+
+// Transport 使用 service account token 访问 API server，连接在请求之间复用（支持 HTTP/2）
+//
+// token 文件变化或 token 过期时重新读取，CA 证书变化时重建底层连接池。
+type Transport struct {
+	token *watchedFile
+	ca    *watchedFile
+	now   func() time.Time
+
+	mu          sync.Mutex
+	tokenValue  string
+	tokenExpiry time.Time
+	base        *http.Transport
+}
+
+// NewTransport 创建 transport，参数为空时使用默认的 service account 路径
+//
+// 文件在第一次请求时读取，启动时文件不存在不会报错。
+func NewTransport(tokenFile, caCertFile string) *Transport {
+	if tokenFile == "" {
+		tokenFile = DefaultTokenFile
+	}
+	if caCertFile == "" {
+		caCertFile = DefaultCACertFile
+	}
+	return &Transport{token: &watchedFile{path: tokenFile}, ca: &watchedFile{path: caCertFile}, now: time.Now}
+}
+
+// RoundTrip 设置 Authorization 请求头后交给底层连接池
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, base, err := t.current()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return base.RoundTrip(req)
+}
+
+// CloseIdleConnections 关闭空闲连接，http.Client.CloseIdleConnections 会调用
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	base := t.base
+	t.mu.Unlock()
+	if base != nil {
+		base.CloseIdleConnections()
+	}
+}
+
+func (t *Transport) current() (string, *http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+
+	// 过期的 token 不等检查间隔，立即重新读取
+	expired := !t.tokenExpiry.IsZero() && !now.Before(t.tokenExpiry.Add(-tokenExpiryMargin))
+	data, changed, err := t.token.read(now, expired)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrCredentials, err)
+	}
+	if changed {
+		t.tokenValue = strings.TrimSpace(string(data))
+		t.tokenExpiry = tokenExpiry(t.tokenValue)
+	}
+
+	data, changed, err = t.ca.read(now, false)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrCredentials, err)
+	}
+	if changed || t.base == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return "", nil, fmt.Errorf("%w: no certificates found in %s", ErrCredentials, t.ca.path)
+		}
+		if t.base != nil {
+			log.Printf("kubernetes CA bundle %s changed, reconnecting", t.ca.path)
+			// 进行中的请求继续使用旧连接，空闲连接立即关闭
+			t.base.CloseIdleConnections()
+		}
+		t.base = newBaseTransport(pool)
+	}
+	return t.tokenValue, t.base, nil
+}
+
+func newBaseTransport(pool *x509.CertPool) *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 25,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// 读取 token 中的 exp，不校验签名，无法解析时返回零值（只按文件变化重新读取）
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// watchedFile 缓存文件内容，按修改时间和大小判断文件是否变化
+//
+// 挂载的 Secret 通过替换符号链接更新，os.Stat 跟随链接，能看到新文件的修改时间。
+type watchedFile struct {
+	path      string
+	data      []byte
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+}
+
+// read 返回文件内容，changed 表示与上次返回的内容不同
+//
+// 文件暂时不可读时继续使用已缓存的内容。
+func (f *watchedFile) read(now time.Time, force bool) (data []byte, changed bool, err error) {
+	if f.data != nil && !force && now.Sub(f.checkedAt) < fileRecheckInterval {
+		return f.data, false, nil
+	}
+	f.checkedAt = now
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.cached(err)
+	}
+	if f.data != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.data, false, nil
+	}
+	data, err = os.ReadFile(f.path)
+	if err != nil {
+		return f.cached(err)
+	}
+	changed = !bytes.Equal(data, f.data)
+	f.data, f.modTime, f.size = data, info.ModTime(), info.Size()
+	return data, changed, nil
+}
+
+func (f *watchedFile) cached(err error) ([]byte, bool, error) {
+	if f.data == nil {
+		return nil, false, err
+	}
+	log.Printf("reload %s: %v, using the cached copy", f.path, err)
+	return f.data, false, nil
+}
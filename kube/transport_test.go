@@ -0,0 +1,193 @@
+package kube
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeAPIServer struct {
+	*httptest.Server
+	conns    atomic.Int32
+	lastAuth atomic.Value
+	lastHTTP atomic.Int32
+	dir      string
+	now      time.Time
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	t.Helper()
+	s := &fakeAPIServer{dir: t.TempDir(), now: time.Now()}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lastAuth.Store(r.Header.Get("Authorization"))
+		s.lastHTTP.Store(int32(r.ProtoMajor))
+		fmt.Fprint(w, `{"major":"1"}`)
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.conns.Add(1)
+		}
+	}
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeAPIServer) caPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+}
+
+// 写文件并把修改时间设置为 s.now，模拟 kubelet 更新挂载的文件
+func (s *fakeAPIServer) write(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, s.now, s.now); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (s *fakeAPIServer) transport(t *testing.T, token string) *Transport {
+	tr := NewTransport(s.write(t, "token", []byte(token+"\n")), s.write(t, "ca.crt", s.caPEM()))
+	tr.now = func() time.Time { return s.now }
+	t.Cleanup(tr.CloseIdleConnections)
+	return tr
+}
+
+func (s *fakeAPIServer) get(t *testing.T, tr *Transport) error {
+	t.Helper()
+	resp, err := (&http.Client{Transport: tr}).Get(s.URL + "/version")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *fakeAPIServer) wantToken(t *testing.T, tr *Transport, token string) {
+	t.Helper()
+	if err := s.get(t, tr); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.lastAuth.Load(); got != "Bearer "+token {
+		t.Errorf("Authorization = %q, want %q", got, "Bearer "+token)
+	}
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+	s := newFakeAPIServer(t)
+	tr := s.transport(t, "token-1")
+	for range 5 {
+		s.wantToken(t, tr, "token-1")
+	}
+	if n := s.conns.Load(); n != 1 {
+		t.Errorf("connections = %d, want 1", n)
+	}
+	if v := s.lastHTTP.Load(); v != 2 {
+		t.Errorf("HTTP/%d, want HTTP/2", v)
+	}
+}
+
+func TestTransportReloadsRotatedToken(t *testing.T) {
+	s := newFakeAPIServer(t)
+	tr := s.transport(t, "token-1")
+	s.wantToken(t, tr, "token-1")
+
+	s.now = s.now.Add(time.Second)
+	s.write(t, "token", []byte("token-2"))
+	// 检查间隔内继续使用缓存的 token
+	s.wantToken(t, tr, "token-1")
+
+	s.now = s.now.Add(fileRecheckInterval)
+	s.wantToken(t, tr, "token-2")
+}
+
+func TestTransportReloadsExpiredToken(t *testing.T) {
+	s := newFakeAPIServer(t)
+	jwt := func(exp time.Time) string {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+		return "e30." + payload + ".sig"
+	}
+	first := jwt(s.now.Add(30 * time.Second))
+	tr := s.transport(t, first)
+	s.wantToken(t, tr, first)
+
+	second := jwt(s.now.Add(time.Hour))
+	s.now = s.now.Add(25 * time.Second)
+	s.write(t, "token", []byte(second))
+	// 没到检查间隔，但旧 token 即将过期
+	s.wantToken(t, tr, second)
+}
+
+func TestTransportReloadsCA(t *testing.T) {
+	s := newFakeAPIServer(t)
+	// 启动时挂载的还是旧的 CA
+	tr := NewTransport(s.write(t, "token", []byte("token")), s.write(t, "ca.crt", selfSignedPEM(t)))
+	tr.now = func() time.Time { return s.now }
+	t.Cleanup(tr.CloseIdleConnections)
+
+	var unknownAuthority x509.UnknownAuthorityError
+	if err := s.get(t, tr); !errors.As(err, &unknownAuthority) {
+		t.Fatalf("err = %v, want unknown authority", err)
+	}
+
+	s.now = s.now.Add(fileRecheckInterval + time.Second)
+	s.write(t, "ca.crt", s.caPEM())
+	s.wantToken(t, tr, "token")
+}
+
+func TestTransportMissingCredentials(t *testing.T) {
+	s := newFakeAPIServer(t)
+	tr := NewTransport(filepath.Join(s.dir, "missing-token"), filepath.Join(s.dir, "missing-ca.crt"))
+	if err := s.get(t, tr); !errors.Is(err, ErrCredentials) {
+		t.Errorf("err = %v, want ErrCredentials", err)
+	}
+
+	// 已经读取过的文件被删除时继续使用缓存
+	tr = s.transport(t, "token")
+	s.wantToken(t, tr, "token")
+	os.Remove(filepath.Join(s.dir, "token"))
+	s.now = s.now.Add(fileRecheckInterval)
+	s.wantToken(t, tr, "token")
+}
+
+func selfSignedPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
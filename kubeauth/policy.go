@@ -0,0 +1,167 @@
+package kubeauth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"go-mysti/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule 允许拥有其中任一角色（或用户名）的用户执行匹配的请求，规则之间是或的关系
+//
+// 除 Namespaces 外，列表中的 "*" 匹配任意值。
+type Rule struct {
+	// 应用中的角色，"*" 表示任意已登录用户
+	Roles []string `yaml:"roles"`
+	// 用户名，用于 bearer token 中没有角色的调用方
+	Users []string `yaml:"users"`
+	// 集群名称，为空时匹配所有集群
+	Clusters []string `yaml:"clusters"`
+	Verbs    []string `yaml:"verbs"`
+	// 核心 API 组为 ""
+	APIGroups []string `yaml:"api_groups"`
+	// 子资源写作 pods/log，pods/* 匹配 pods 的所有子资源，"*" 匹配所有资源及其子资源
+	Resources []string `yaml:"resources"`
+	// 为空时匹配所有命名空间和集群级资源，否则只匹配列出的命名空间
+	Namespaces    []string `yaml:"namespaces"`
+	ResourceNames []string `yaml:"resource_names"`
+	// 非资源请求的路径，以 * 结尾时按前缀匹配，例如 /apis/*
+	NonResourceURLs []string `yaml:"non_resource_urls"`
+}
+
+// Policy 是 /kube 代理的访问策略，没有规则匹配的请求被拒绝
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// DefaultPolicy 只允许 admin 角色访问，未配置策略文件时使用
+func DefaultPolicy() *Policy {
+	return &Policy{Rules: []Rule{
+		{Roles: []string{"admin"}, Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+		{Roles: []string{"admin"}, Verbs: []string{"*"}, NonResourceURLs: []string{"*"}},
+	}}
+}
+
+// LoadPolicy 读取 YAML 格式的策略文件
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &policy, nil
+}
+
+// Validate 检查每条规则都指定了主体、动词和匹配对象
+func (p *Policy) Validate() error {
+	var errs []error
+	for i, r := range p.Rules {
+		fail := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("rules[%d]: %s", i, fmt.Sprintf(format, args...)))
+		}
+		if len(r.Roles) == 0 && len(r.Users) == 0 {
+			fail("roles or users is required")
+		}
+		if len(r.Verbs) == 0 {
+			fail("verbs is required")
+		}
+		switch {
+		case len(r.NonResourceURLs) > 0 && (len(r.Resources) > 0 || len(r.APIGroups) > 0 || len(r.Namespaces) > 0 || len(r.ResourceNames) > 0):
+			fail("non_resource_urls cannot be combined with resource fields")
+		case len(r.NonResourceURLs) == 0 && (len(r.Resources) == 0 || len(r.APIGroups) == 0):
+			fail("api_groups and resources are required, or non_resource_urls")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Authorize 判断用户能否执行请求
+func (p *Policy) Authorize(user *model.User, info RequestInfo) bool {
+	if user == nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		if r.appliesTo(user) && r.matches(info) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsCluster 判断是否有规则允许用户访问集群中的某些请求，用于过滤集群列表
+func (p *Policy) AllowsCluster(user *model.User, cluster string) bool {
+	for _, r := range p.Rules {
+		if r.appliesTo(user) && (len(r.Clusters) == 0 || matchAny(r.Clusters, cluster)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) appliesTo(user *model.User) bool {
+	if slices.Contains(r.Users, user.Username) || slices.Contains(r.Roles, "*") {
+		return true
+	}
+	return slices.ContainsFunc(r.Roles, user.HasRole)
+}
+
+func (r Rule) matches(info RequestInfo) bool {
+	if len(r.Clusters) > 0 && !matchAny(r.Clusters, info.Cluster) {
+		return false
+	}
+	if !matchAny(r.Verbs, info.Verb) {
+		return false
+	}
+	if !info.IsResourceRequest {
+		return slices.ContainsFunc(r.NonResourceURLs, func(pattern string) bool {
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+				return strings.HasPrefix(info.Path, prefix)
+			}
+			return pattern == info.Path
+		})
+	}
+	if !matchAny(r.APIGroups, info.APIGroup) || !r.matchesResource(info) {
+		return false
+	}
+	// 限定了命名空间的规则不匹配集群级资源和跨命名空间的列表
+	if len(r.Namespaces) > 0 && (info.Namespace == "" || !slices.Contains(r.Namespaces, info.Namespace)) {
+		return false
+	}
+	// 限定了名称的规则不匹配 list、watch、create 等没有名称的请求
+	if len(r.ResourceNames) > 0 && !slices.Contains(r.ResourceNames, info.Name) {
+		return false
+	}
+	return true
+}
+
+func (r Rule) matchesResource(info RequestInfo) bool {
+	for _, pattern := range r.Resources {
+		if pattern == "*" {
+			return true
+		}
+		resource, subresource, _ := strings.Cut(pattern, "/")
+		if (resource == "*" || resource == info.Resource) && (subresource == "*" && info.Subresource != "" || subresource == info.Subresource) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string) bool {
+	return slices.Contains(patterns, "*") || slices.Contains(patterns, value)
+}
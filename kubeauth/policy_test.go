@@ -0,0 +1,132 @@
+package kubeauth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-mysti/model"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		method, path, query string
+		want                RequestInfo
+	}{
+		{"GET", "/api/v1/namespaces/default/pods", "", RequestInfo{IsResourceRequest: true, Verb: "list", APIVersion: "v1", Namespace: "default", Resource: "pods"}},
+		{"GET", "/api/v1/namespaces/default/pods", "watch=true", RequestInfo{IsResourceRequest: true, Verb: "watch", APIVersion: "v1", Namespace: "default", Resource: "pods"}},
+		{"GET", "/api/v1/watch/namespaces/default/pods", "", RequestInfo{IsResourceRequest: true, Verb: "watch", APIVersion: "v1", Namespace: "default", Resource: "pods"}},
+		{"GET", "/api/v1/namespaces/default/pods/web/log", "", RequestInfo{IsResourceRequest: true, Verb: "get", APIVersion: "v1", Namespace: "default", Resource: "pods", Name: "web", Subresource: "log"}},
+		{"POST", "/api/v1/namespaces/default/pods/web/exec", "", RequestInfo{IsResourceRequest: true, Verb: "create", APIVersion: "v1", Namespace: "default", Resource: "pods", Name: "web", Subresource: "exec"}},
+		{"GET", "/api/v1/namespaces/default/pods/web/exec", "command=sh&stdin=true", RequestInfo{IsResourceRequest: true, Verb: "create", APIVersion: "v1", Namespace: "default", Resource: "pods", Name: "web", Subresource: "exec"}},
+		{"GET", "/api/v1/namespaces/default/pods/web/portforward", "ports=80", RequestInfo{IsResourceRequest: true, Verb: "create", APIVersion: "v1", Namespace: "default", Resource: "pods", Name: "web", Subresource: "portforward"}},
+		{"PATCH", "/apis/apps/v1/namespaces/prod/deployments/api", "", RequestInfo{IsResourceRequest: true, Verb: "patch", APIGroup: "apps", APIVersion: "v1", Namespace: "prod", Resource: "deployments", Name: "api"}},
+		{"DELETE", "/apis/apps/v1/namespaces/prod/deployments", "", RequestInfo{IsResourceRequest: true, Verb: "deletecollection", APIGroup: "apps", APIVersion: "v1", Namespace: "prod", Resource: "deployments"}},
+		{"GET", "/api/v1/namespaces/prod", "", RequestInfo{IsResourceRequest: true, Verb: "get", APIVersion: "v1", Namespace: "prod", Resource: "namespaces", Name: "prod"}},
+		{"PUT", "/api/v1/namespaces/prod/finalize", "", RequestInfo{IsResourceRequest: true, Verb: "update", APIVersion: "v1", Namespace: "prod", Resource: "namespaces", Name: "prod", Subresource: "finalize"}},
+		{"GET", "/api/v1/nodes", "", RequestInfo{IsResourceRequest: true, Verb: "list", APIVersion: "v1", Resource: "nodes"}},
+		{"GET", "/apis/apps/v1", "", RequestInfo{Verb: "get"}},
+		{"GET", "/version", "", RequestInfo{Verb: "get"}},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := ParseRequest(tt.method, tt.path, query)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.method, tt.path, err)
+			continue
+		}
+		tt.want.Path = tt.path
+		if got != tt.want {
+			t.Errorf("%s %s?%s\n got  %+v\n want %+v", tt.method, tt.path, tt.query, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"/api/v1/namespaces/default/pods/../../../secrets", "/api/v1//secrets", "/api/./v1/secrets"} {
+		if _, err := ParseRequest("GET", path, nil); err != ErrInvalidPath {
+			t.Errorf("%s: err = %v, want ErrInvalidPath", path, err)
+		}
+	}
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Roles: []string{"viewer"}, Verbs: []string{"get", "list", "watch"}, APIGroups: []string{"", "apps"}, Resources: []string{"pods", "pods/log", "deployments"}, Namespaces: []string{"default"}},
+		{Roles: []string{"*"}, Verbs: []string{"get"}, NonResourceURLs: []string{"/version", "/apis/*"}},
+		{Users: []string{"deployer"}, Verbs: []string{"patch"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}, ResourceNames: []string{"api"}},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	viewer := &model.User{Username: "alice", Roles: []string{"viewer"}}
+	deployer := &model.User{Username: "deployer"}
+	admin := &model.User{Username: "root", Roles: []string{"admin"}}
+
+	tests := []struct {
+		user         *model.User
+		method, path string
+		want         bool
+	}{
+		{viewer, "GET", "/api/v1/namespaces/default/pods", true},
+		{viewer, "GET", "/api/v1/namespaces/default/pods/web/log", true},
+		{viewer, "GET", "/apis/apps/v1/namespaces/default/deployments/api", true},
+		{viewer, "POST", "/api/v1/namespaces/default/pods/web/exec", false},
+		{viewer, "GET", "/api/v1/namespaces/default/pods/web/exec", false},
+		{viewer, "DELETE", "/api/v1/namespaces/default/pods/web", false},
+		{viewer, "GET", "/api/v1/namespaces/kube-system/pods", false},
+		{viewer, "GET", "/api/v1/pods", false},
+		{viewer, "GET", "/api/v1/namespaces/default/secrets", false},
+		{viewer, "GET", "/version", true},
+		{viewer, "GET", "/apis/apps/v1", true},
+		{viewer, "GET", "/metrics", false},
+		{deployer, "PATCH", "/apis/apps/v1/namespaces/prod/deployments/api", true},
+		{deployer, "PATCH", "/apis/apps/v1/namespaces/prod/deployments/db", false},
+		{admin, "GET", "/api/v1/namespaces/default/pods", false},
+		{nil, "GET", "/version", false},
+	}
+	for _, tt := range tests {
+		info, err := ParseRequest(tt.method, tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := policy.Authorize(tt.user, info); got != tt.want {
+			t.Errorf("%v %s %s = %v, want %v", tt.user, tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	info, _ := ParseRequest("DELETE", "/api/v1/namespaces/default/pods/web", nil)
+	if !DefaultPolicy().Authorize(admin, info) || DefaultPolicy().Authorize(viewer, info) {
+		t.Error("default policy should only allow the admin role")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		{Roles: []string{"viewer"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		{Roles: []string{"viewer"}, Verbs: []string{"get"}, Resources: []string{"pods"}},
+		{Roles: []string{"viewer"}, Verbs: []string{"get"}, Resources: []string{"pods"}, APIGroups: []string{""}, NonResourceURLs: []string{"/version"}},
+	}}
+	err := policy.Validate()
+	if err == nil {
+		t.Fatal("want error")
+	}
+	for _, want := range []string{"rules[0]: roles or users", "rules[1]: verbs", "rules[2]: api_groups", "rules[3]: non_resource_urls"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestForbiddenMessage(t *testing.T) {
+	info, _ := ParseRequest("GET", "/api/v1/namespaces/default/pods/web/log", nil)
+	status := Forbidden("alice", info)
+	want := `pods "web" is forbidden: User "alice" cannot get resource "pods/log" in API group "" in the namespace "default"`
+	if status.Message != want || status.Code != 403 || status.Reason != "Forbidden" || status.Kind != "Status" {
+		t.Errorf("status = %+v", status)
+	}
+
+	info, _ = ParseRequest("GET", "/api/v1/nodes", nil)
+	if msg := Forbidden("alice", info).Message; !strings.HasSuffix(msg, "at the cluster scope") {
+		t.Errorf("message = %q", msg)
+	}
+}
@@ -0,0 +1,126 @@
+// Package kubeauth 对 /kube 代理的请求做基于角色的访问控制
+//
+// 请求按 kube-apiserver 的规则解析为动词、API 组、资源和命名空间，再与策略中的规则匹配。
+package kubeauth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// RequestInfo 是从代理 URL 解析出的 Kubernetes 请求属性
+type RequestInfo struct {
+	// 集群名称，由调用方根据路由设置
+	Cluster string
+	// 资源请求为 true，/version、/healthz、发现接口等为 false
+	IsResourceRequest bool
+	// 原始路径，非资源请求按路径匹配
+	Path string
+	// get、list、watch、create、update、patch、delete、deletecollection，非资源请求为小写的 HTTP 方法
+	Verb        string
+	APIGroup    string
+	APIVersion  string
+	Namespace   string
+	Resource    string
+	Subresource string
+	Name        string
+}
+
+// 出现在命名空间名称后面时属于 namespaces 资源本身的子资源
+var namespaceSubresources = map[string]bool{"status": true, "finalize": true}
+
+// 通过 WebSocket（GET）访问时也需要 create 权限的 pods 子资源，与 kube-apiserver 1.31 之后的行为一致
+var podConnectSubresources = map[string]bool{"exec": true, "attach": true, "portforward": true}
+
+// ErrInvalidPath 表示路径包含 .、.. 或空段，这类路径可能在 API server 上被解析为其他资源，直接拒绝
+var ErrInvalidPath = errors.New("invalid kubernetes API path")
+
+// ParseRequest 解析 Kubernetes API 请求，path 是 API server 上的路径，例如 /api/v1/namespaces/default/pods
+func ParseRequest(method, urlPath string, query url.Values) (RequestInfo, error) {
+	if urlPath != "/" && path.Clean(urlPath) != strings.TrimSuffix(urlPath, "/") {
+		return RequestInfo{}, ErrInvalidPath
+	}
+	info := RequestInfo{Path: urlPath, Verb: strings.ToLower(method)}
+	if method == http.MethodHead {
+		info.Verb = "get"
+	}
+
+	parts := splitPath(urlPath)
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		info.APIVersion = parts[1]
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		info.APIGroup, info.APIVersion = parts[1], parts[2]
+		parts = parts[3:]
+	default:
+		// /api、/apis/apps/v1 这类发现接口和其他路径都是非资源请求
+		return info, nil
+	}
+	info.IsResourceRequest = true
+
+	// 已废弃的 /watch/ 前缀
+	watchPrefix := false
+	if parts[0] == "watch" && len(parts) > 1 {
+		watchPrefix = true
+		parts = parts[1:]
+	}
+
+	if parts[0] == "namespaces" && len(parts) > 1 {
+		info.Namespace = parts[1]
+		// /namespaces/{name}/status 等是 namespaces 资源的子资源，其他情况是命名空间内的资源
+		if len(parts) > 2 && !namespaceSubresources[parts[2]] {
+			parts = parts[2:]
+		}
+	}
+	info.Resource = parts[0]
+	if len(parts) > 1 {
+		info.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		info.Subresource = parts[2]
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		switch {
+		case watchPrefix || (info.Name == "" && isTrue(query.Get("watch"))):
+			info.Verb = "watch"
+		case info.Name == "":
+			info.Verb = "list"
+		case info.Resource == "pods" && podConnectSubresources[info.Subresource]:
+			info.Verb = "create"
+		default:
+			info.Verb = "get"
+		}
+	case http.MethodPost:
+		info.Verb = "create"
+	case http.MethodPut:
+		info.Verb = "update"
+	case http.MethodPatch:
+		info.Verb = "patch"
+	case http.MethodDelete:
+		if info.Name == "" {
+			info.Verb = "deletecollection"
+		} else {
+			info.Verb = "delete"
+		}
+	}
+	return info, nil
+}
+
+// 路径已经校验过，去掉首尾的 / 后拆分即可
+func splitPath(urlPath string) []string {
+	urlPath = strings.Trim(urlPath, "/")
+	if urlPath == "" {
+		return nil
+	}
+	return strings.Split(urlPath, "/")
+}
+
+func isTrue(s string) bool {
+	return s == "1" || strings.EqualFold(s, "true")
+}
@@ -0,0 +1,283 @@
+package kubeauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 只读模式允许的动词，HEAD 请求解析为 get
+var readOnlyVerbs = map[string]bool{"get": true, "list": true, "watch": true}
+
+// Restrictions 是对所有用户生效的代理限制，在策略之前检查，nil 表示没有限制
+type Restrictions struct {
+	readOnly bool
+	allow    []*regexp.Regexp
+	deny     []*regexp.Regexp
+	strip    []fieldRule
+}
+
+// RestrictionOptions 对应 kubernetes 配置中的 read_only、allow_paths、deny_paths 和 strip_fields
+type RestrictionOptions struct {
+	// 只允许 get、list、watch
+	ReadOnly bool
+	// 路径模式，* 匹配一个路径段中的任意字符，** 匹配任意多段；模式匹配路径本身或它的上级路径。
+	// 集群范围的资源路径同时匹配所有 namespace 中的同一资源，例如 /api/v1/secrets 也匹配
+	// /api/v1/namespaces/default/secrets/db。
+	// AllowPaths 不为空时只允许匹配的路径，DenyPaths 优先
+	AllowPaths []string
+	DenyPaths  []string
+	// 从 JSON 响应中删除的字段，格式为 [Kind:]a.b.c，包含 . 的键写作 [key]，例如
+	// Secret:data、metadata.managedFields、metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]
+	StripFields []string
+}
+
+// NewRestrictions 编译路径模式和字段，没有任何限制时返回 nil
+func NewRestrictions(opts RestrictionOptions) (*Restrictions, error) {
+	if !opts.ReadOnly && len(opts.AllowPaths) == 0 && len(opts.DenyPaths) == 0 && len(opts.StripFields) == 0 {
+		return nil, nil
+	}
+	r := &Restrictions{readOnly: opts.ReadOnly}
+	var errs []error
+	for _, p := range opts.AllowPaths {
+		pattern, err := compilePathPattern(p)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		r.allow = append(r.allow, pattern)
+	}
+	for _, p := range opts.DenyPaths {
+		pattern, err := compilePathPattern(p)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		r.deny = append(r.deny, pattern)
+	}
+	for _, f := range opts.StripFields {
+		rule, err := parseFieldRule(f)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		r.strip = append(r.strip, rule)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Check 检查请求是否被限制，被拒绝时返回 Forbidden Status
+func (r *Restrictions) Check(info RequestInfo) (Status, bool) {
+	if r == nil {
+		return Status{}, true
+	}
+	if r.readOnly && !readOnlyVerbs[info.Verb] {
+		return NewStatus(http.StatusForbidden, "Forbidden",
+			fmt.Sprintf("the Kubernetes proxy is read-only: %s %q is not allowed", info.Verb, info.Path)), false
+	}
+	apiPath := info.APIPath()
+	paths := []string{apiPath}
+	if clusterPath := info.clusterPath(); clusterPath != "" {
+		paths = append(paths, clusterPath)
+	}
+	if matchPaths(r.deny, paths) {
+		return pathForbidden(apiPath), false
+	}
+	if len(r.allow) == 0 || matchPaths(r.allow, paths) {
+		return Status{}, true
+	}
+	return pathForbidden(apiPath), false
+}
+
+func matchPaths(patterns []*regexp.Regexp, paths []string) bool {
+	for _, p := range patterns {
+		for _, path := range paths {
+			if p.MatchString(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func pathForbidden(apiPath string) Status {
+	return NewStatus(http.StatusForbidden, "Forbidden",
+		fmt.Sprintf("path %q is not allowed by the Kubernetes proxy configuration", apiPath))
+}
+
+// StripsFields 表示需要改写响应
+func (r *Restrictions) StripsFields() bool {
+	return r != nil && len(r.strip) > 0
+}
+
+// StripObject 删除 JSON 解码后的对象中的字段，List 按元素处理，Table 处理每行附带的对象，
+// watch 事件处理其中的 object；返回是否有修改
+func (r *Restrictions) StripObject(obj map[string]any) bool {
+	if !r.StripsFields() {
+		return false
+	}
+	kind, _ := obj["kind"].(string)
+	switch {
+	case kind == "Table":
+		changed := false
+		rows, _ := obj["rows"].([]any)
+		for _, row := range rows {
+			if row, ok := row.(map[string]any); ok {
+				if o, ok := row["object"].(map[string]any); ok && r.StripObject(o) {
+					changed = true
+				}
+			}
+		}
+		return changed
+	case kind == "" && obj["type"] != nil && obj["object"] != nil:
+		// watch 事件：{"type":"ADDED","object":{...}}
+		o, ok := obj["object"].(map[string]any)
+		return ok && r.StripObject(o)
+	case strings.HasSuffix(kind, "List"):
+		// 列表元素通常没有 kind
+		changed := false
+		items, _ := obj["items"].([]any)
+		for _, item := range items {
+			if item, ok := item.(map[string]any); ok {
+				itemKind, ok := item["kind"].(string)
+				if !ok {
+					itemKind = strings.TrimSuffix(kind, "List")
+				}
+				changed = r.stripFields(item, itemKind) || changed
+			}
+		}
+		return changed
+	}
+	return r.stripFields(obj, kind)
+}
+
+func (r *Restrictions) stripFields(obj map[string]any, kind string) bool {
+	changed := false
+	for _, rule := range r.strip {
+		if rule.kind != "" && rule.kind != kind {
+			continue
+		}
+		if deleteField(obj, rule.path) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func deleteField(obj map[string]any, path []string) bool {
+	for _, key := range path[:len(path)-1] {
+		next, ok := obj[key].(map[string]any)
+		if !ok {
+			return false
+		}
+		obj = next
+	}
+	last := path[len(path)-1]
+	if _, ok := obj[last]; !ok {
+		return false
+	}
+	delete(obj, last)
+	return true
+}
+
+// APIPath 返回资源请求在 API server 上的规范路径，去掉已废弃的 /watch/ 前缀；非资源请求返回原始路径
+func (info RequestInfo) APIPath() string {
+	if !info.IsResourceRequest {
+		return info.Path
+	}
+	var b strings.Builder
+	if info.APIGroup == "" {
+		b.WriteString("/api/" + info.APIVersion)
+	} else {
+		b.WriteString("/apis/" + info.APIGroup + "/" + info.APIVersion)
+	}
+	if info.Namespace != "" && info.Resource != "namespaces" {
+		b.WriteString("/namespaces/" + info.Namespace)
+	}
+	for _, part := range []string{info.Resource, info.Name, info.Subresource} {
+		if part == "" {
+			break
+		}
+		b.WriteString("/" + part)
+	}
+	return b.String()
+}
+
+// clusterPath 返回去掉 namespace 后的路径，例如 /api/v1/namespaces/default/secrets/db 返回 /api/v1/secrets/db，
+// 使 /api/v1/secrets 这样的模式覆盖所有 namespace；不属于某个 namespace 的请求返回空字符串
+func (info RequestInfo) clusterPath() string {
+	if !info.IsResourceRequest || info.Namespace == "" || info.Resource == "namespaces" {
+		return ""
+	}
+	return RequestInfo{
+		IsResourceRequest: true,
+		APIGroup:          info.APIGroup,
+		APIVersion:        info.APIVersion,
+		Resource:          info.Resource,
+		Name:              info.Name,
+		Subresource:       info.Subresource,
+	}.APIPath()
+}
+
+// 路径模式转换为正则表达式，同时匹配下级路径，例如 /api/v1/secrets 也匹配其中的每个 secret
+func compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("path pattern %q must start with /", pattern)
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("(/.*)?$")
+	return regexp.Compile(b.String())
+}
+
+type fieldRule struct {
+	kind string
+	path []string
+}
+
+func parseFieldRule(s string) (fieldRule, error) {
+	var rule fieldRule
+	field := s
+	if kind, rest, ok := strings.Cut(s, ":"); ok && !strings.Contains(kind, "[") {
+		rule.kind, field = kind, rest
+	}
+	for field != "" {
+		var key string
+		if strings.HasPrefix(field, "[") {
+			end := strings.Index(field, "]")
+			if end < 0 {
+				return rule, fmt.Errorf("strip field %q: missing ]", s)
+			}
+			key, field = field[1:end], field[end+1:]
+		} else {
+			end := strings.IndexAny(field, ".[")
+			if end < 0 {
+				end = len(field)
+			}
+			key, field = field[:end], field[end:]
+		}
+		if key == "" {
+			return rule, fmt.Errorf("strip field %q: empty key", s)
+		}
+		rule.path = append(rule.path, key)
+		field = strings.TrimPrefix(field, ".")
+	}
+	if len(rule.path) == 0 {
+		return rule, fmt.Errorf("strip field %q: empty path", s)
+	}
+	return rule, nil
+}
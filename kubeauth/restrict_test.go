@@ -0,0 +1,136 @@
+package kubeauth
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRestrictionsCheck(t *testing.T) {
+	r, err := NewRestrictions(RestrictionOptions{
+		ReadOnly:   true,
+		AllowPaths: []string{"/api", "/apis/apps/v1/namespaces/*/deployments", "/version"},
+		DenyPaths:  []string{"/api/v1/secrets", "/api/**/log"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method, path, query string
+		allowed             bool
+	}{
+		{"GET", "/api/v1/namespaces/default/pods", "", true},
+		{"GET", "/api/v1/namespaces/default/pods", "watch=1", true},
+		{"GET", "/apis/apps/v1/namespaces/prod/deployments/web", "", true},
+		{"GET", "/version", "", true},
+		{"GET", "/api/v1/secrets", "", false},
+		{"GET", "/api/v1/namespaces/default/secrets/db", "", false},
+		// 已废弃的 watch 前缀按规范路径匹配
+		{"GET", "/api/v1/watch/namespaces/default/secrets", "", false},
+		{"GET", "/api/v1/namespaces/default/pods/web/log", "", false},
+		{"GET", "/apis/apps/v1/namespaces/prod/replicasets", "", false},
+		{"GET", "/versions", "", false},
+		{"PATCH", "/apis/apps/v1/namespaces/prod/deployments/web", "", false},
+		{"GET", "/api/v1/namespaces/default/pods/web/exec", "command=sh", false},
+		{"POST", "/api/v1/namespaces/default/pods/web/exec", "", false},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		info, err := ParseRequest(tt.method, tt.path, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, ok := r.Check(info)
+		if ok != tt.allowed {
+			t.Errorf("%s %s?%s: allowed = %v, want %v", tt.method, tt.path, tt.query, ok, tt.allowed)
+		}
+		if !ok && (status.Code != 403 || status.Reason != "Forbidden" || status.Kind != "Status") {
+			t.Errorf("%s %s: status = %+v", tt.method, tt.path, status)
+		}
+	}
+
+	var none *Restrictions
+	if _, ok := none.Check(RequestInfo{Verb: "delete", Path: "/api/v1/nodes/a"}); !ok {
+		t.Error("nil restrictions should allow everything")
+	}
+}
+
+// 集群范围的路径同时覆盖每个 namespace 中的同一资源
+func TestRestrictionsClusterPath(t *testing.T) {
+	r, err := NewRestrictions(RestrictionOptions{DenyPaths: []string{"/api/v1/secrets", "/apis/apps/v1/deployments/*/scale"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method, path string
+		allowed      bool
+	}{
+		{"GET", "/api/v1/secrets", false},
+		{"GET", "/api/v1/namespaces/kube-system/secrets/token", false},
+		{"DELETE", "/api/v1/namespaces/kube-system/secrets/token", false},
+		{"GET", "/api/v1/namespaces/default/secrets", false},
+		{"GET", "/api/v1/watch/namespaces/default/secrets", false},
+		{"GET", "/api/v1/namespaces/default/configmaps/app", true},
+		{"GET", "/apis/apps/v1/namespaces/prod/deployments/web", true},
+		{"PUT", "/apis/apps/v1/namespaces/prod/deployments/web/scale", false},
+		// 名为 secrets 的 namespace 不是 secrets 资源
+		{"GET", "/api/v1/namespaces/secrets", true},
+		{"GET", "/api/v1/namespaces/secrets/configmaps", true},
+	}
+	for _, tt := range tests {
+		info, err := ParseRequest(tt.method, tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := r.Check(info); ok != tt.allowed {
+			t.Errorf("%s %s: allowed = %v, want %v", tt.method, tt.path, ok, tt.allowed)
+		}
+	}
+}
+
+func TestNewRestrictions(t *testing.T) {
+	if r, err := NewRestrictions(RestrictionOptions{}); r != nil || err != nil {
+		t.Errorf("empty options = %v, %v", r, err)
+	}
+	_, err := NewRestrictions(RestrictionOptions{DenyPaths: []string{"api/v1"}, StripFields: []string{"metadata.[x", "Secret:", "a..b"}})
+	if err == nil {
+		t.Fatal("want error")
+	}
+	for _, want := range []string{`"api/v1" must start with /`, `"metadata.[x": missing ]`, `"Secret:": empty path`, `"a..b": empty key`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestStripObject(t *testing.T) {
+	r, err := NewRestrictions(RestrictionOptions{StripFields: []string{
+		"Secret:data", "metadata.managedFields", "metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{`{"kind":"Secret","data":{"a":"b"},"type":"Opaque"}`, `{"kind":"Secret","type":"Opaque"}`},
+		{`{"kind":"ConfigMap","data":{"a":"b"},"metadata":{"managedFields":[],"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}","team":"web"}}}`,
+			`{"kind":"ConfigMap","data":{"a":"b"},"metadata":{"annotations":{"team":"web"}}}`},
+		{`{"kind":"SecretList","items":[{"data":{"a":"b"}},{"metadata":{"name":"x"}}]}`, `{"kind":"SecretList","items":[{},{"metadata":{"name":"x"}}]}`},
+		{`{"type":"ADDED","object":{"kind":"Secret","data":{"a":"b"}}}`, `{"type":"ADDED","object":{"kind":"Secret"}}`},
+		{`{"kind":"Table","rows":[{"cells":["db"],"object":{"kind":"Secret","data":{"a":"b"}}}]}`, `{"kind":"Table","rows":[{"cells":["db"],"object":{"kind":"Secret"}}]}`},
+		{`{"kind":"Pod","spec":{"data":1}}`, `{"kind":"Pod","spec":{"data":1}}`},
+	}
+	for _, tt := range tests {
+		var obj, want map[string]any
+		json.Unmarshal([]byte(tt.in), &obj)
+		json.Unmarshal([]byte(tt.want), &want)
+		changed := r.StripObject(obj)
+		if !reflect.DeepEqual(obj, want) || changed != (tt.in != tt.want) {
+			out, _ := json.Marshal(obj)
+			t.Errorf("StripObject(%s) = %s, %v", tt.in, out, changed)
+		}
+	}
+}
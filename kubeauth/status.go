@@ -0,0 +1,66 @@
+package kubeauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Status 是 Kubernetes API 的 Status 对象，kubectl 和 client-go 能直接显示其中的 message
+type Status struct {
+	Kind       string         `json:"kind"`
+	APIVersion string         `json:"apiVersion"`
+	Metadata   struct{}       `json:"metadata"`
+	Status     string         `json:"status"`
+	Message    string         `json:"message"`
+	Reason     string         `json:"reason"`
+	Details    *StatusDetails `json:"details,omitempty"`
+	Code       int            `json:"code"`
+}
+
+type StatusDetails struct {
+	Name  string `json:"name,omitempty"`
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+}
+
+// NewStatus 返回失败的 Status，reason 使用 Kubernetes 的取值，例如 Forbidden、BadRequest
+func NewStatus(code int, reason, message string) Status {
+	return Status{
+		Kind:       "Status",
+		APIVersion: "v1",
+		Status:     "Failure",
+		Message:    message,
+		Reason:     reason,
+		Code:       code,
+	}
+}
+
+// Forbidden 返回与 kube-apiserver 格式相同的拒绝信息
+func Forbidden(username string, info RequestInfo) Status {
+	if !info.IsResourceRequest {
+		return NewStatus(http.StatusForbidden, "Forbidden",
+			fmt.Sprintf("forbidden: User %q cannot %s path %q", username, info.Verb, info.Path))
+	}
+
+	resource := info.Resource
+	if info.Subresource != "" {
+		resource += "/" + info.Subresource
+	}
+	var msg strings.Builder
+	if info.Name != "" {
+		fmt.Fprintf(&msg, "%s %q is forbidden: ", info.Resource, info.Name)
+	} else {
+		fmt.Fprintf(&msg, "%s is forbidden: ", info.Resource)
+	}
+	fmt.Fprintf(&msg, "User %q cannot %s resource %q in API group %q", username, info.Verb, resource, info.APIGroup)
+	if info.Namespace != "" {
+		fmt.Fprintf(&msg, " in the namespace %q", info.Namespace)
+	} else {
+		msg.WriteString(" at the cluster scope")
+	}
+
+	status := NewStatus(http.StatusForbidden, "Forbidden", msg.String())
+	status.Details = &StatusDetails{Name: info.Name, Group: info.APIGroup, Kind: info.Resource}
+	return status
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"go-mysti/apperror"
+	"go-mysti/model"
+	"go-mysti/repository"
+	"go-mysti/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	userKey     = "user"
+	sessionKey  = "session"
+	sessionsKey = "session_manager"
+
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "csrf_token"
+)
+
+// Authenticate 读取会话 cookie 并加载当前用户，未登录时继续处理请求
+//
+// 需要登录的路由再使用 RequireAuth。
+func Authenticate(sessions *session.Manager, users repository.Users) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(sessionsKey, sessions)
+		s, err := sessions.Read(ctx.Request)
+		if errors.Is(err, session.ErrInvalid) {
+			ctx.Next()
+			return
+		}
+		if err != nil {
+			ctx.Error(apperror.Internal(err))
+			ctx.Abort()
+			return
+		}
+		ctx.Set(sessionKey, s)
+
+		if s.Authenticated() {
+			user, err := users.UserByID(ctx.Request.Context(), s.UserID)
+			switch {
+			case err == nil:
+				ctx.Set(userKey, user)
+			case errors.Is(err, repository.ErrNotFound):
+				// 用户已被删除，按未登录处理
+			default:
+				ctx.Error(apperror.Internal(err))
+				ctx.Abort()
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// RequireAuth 拒绝未登录的请求
+//
+// loginPath 不为空时把 GET 请求重定向到登录页，登录后返回原地址；否则返回 401。
+func RequireAuth(loginPath string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if CurrentUser(ctx) != nil {
+			ctx.Next()
+			return
+		}
+		if loginPath != "" && (ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead) {
+			ctx.Redirect(http.StatusSeeOther, loginPath+"?next="+url.QueryEscape(ctx.Request.URL.RequestURI()))
+			ctx.Abort()
+			return
+		}
+		ctx.Error(apperror.Unauthorized("login required"))
+		ctx.Abort()
+	}
+}
+
+// VerifyCSRF 要求会话发起的非只读请求带上 CSRF token
+//
+// token 从 X-CSRF-Token 请求头或 csrf_token 表单字段读取，使用 bearer token 认证的请求不检查。
+func VerifyCSRF() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			ctx.Next()
+			return
+		}
+		if bearerAuthenticated(ctx) {
+			ctx.Next()
+			return
+		}
+		token := ctx.GetHeader(CSRFHeader)
+		if token == "" {
+			token = ctx.PostForm(CSRFFormField)
+		}
+		sessions := sessionManager(ctx)
+		s := CurrentSession(ctx)
+		if sessions == nil || s == nil || !sessions.VerifyCSRF(s, token) {
+			ctx.Error(apperror.Forbidden("invalid or missing CSRF token"))
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// CurrentUser 返回已登录的用户，未登录时返回 nil
+func CurrentUser(ctx *gin.Context) *model.User {
+	if v, ok := ctx.Get(userKey); ok {
+		return v.(*model.User)
+	}
+	return nil
+}
+
+// CurrentSession 返回请求的会话，没有有效 cookie 时返回 nil
+func CurrentSession(ctx *gin.Context) *session.Session {
+	if v, ok := ctx.Get(sessionKey); ok {
+		return v.(*session.Session)
+	}
+	return nil
+}
+
+// CSRFToken 返回当前会话的 CSRF token，没有会话时创建匿名会话，登录表单也能使用
+//
+// 没有使用 Authenticate 中间件时返回空字符串。
+func CSRFToken(ctx *gin.Context) string {
+	sessions := sessionManager(ctx)
+	if sessions == nil {
+		return ""
+	}
+	s := CurrentSession(ctx)
+	if s == nil {
+		s = sessions.New(ctx.Writer, 0)
+		ctx.Set(sessionKey, s)
+	}
+	return sessions.CSRFToken(s)
+}
+
+// Login 为用户创建新会话，旧会话的 CSRF token 随之失效
+func Login(ctx *gin.Context, user *model.User) {
+	s := sessionManager(ctx).New(ctx.Writer, user.ID)
+	ctx.Set(sessionKey, s)
+	ctx.Set(userKey, user)
+}
+
+// Logout 注销当前会话并清除 cookie，注销后复制出去的 cookie 也不能再使用
+func Logout(ctx *gin.Context) error {
+	sessions := sessionManager(ctx)
+	if s := CurrentSession(ctx); s != nil {
+		if err := sessions.Revoke(ctx.Request.Context(), s); err != nil {
+			return err
+		}
+	}
+	sessions.Clear(ctx.Writer)
+	delete(ctx.Keys, sessionKey)
+	delete(ctx.Keys, userKey)
+	return nil
+}
+
+func sessionManager(ctx *gin.Context) *session.Manager {
+	if v, ok := ctx.Get(sessionsKey); ok {
+		return v.(*session.Manager)
+	}
+	return nil
+}
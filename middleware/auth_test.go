@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mysti/model"
+	"go-mysti/repository"
+	"go-mysti/repository/memory"
+	"go-mysti/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 查询用户时总是返回错误
+type brokenUsers struct {
+	repository.Users
+}
+
+func (brokenUsers) UserByID(ctx context.Context, id int64) (*model.User, error) {
+	return nil, errors.New("database is down")
+}
+
+func newTestSessions() *session.Manager {
+	return session.NewManager(session.Options{Secret: []byte(strings.Repeat("x", 32)), CookieName: "session", TTL: time.Hour})
+}
+
+func newAuthRouter(sessions *session.Manager, users repository.Users) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authenticate := Authenticate(sessions, users)
+	whoami := func(ctx *gin.Context) {
+		if user := CurrentUser(ctx); user != nil {
+			ctx.String(http.StatusOK, user.Username)
+			return
+		}
+		ctx.String(http.StatusOK, "anonymous")
+	}
+
+	pages := router.Group("/", authenticate)
+	pages.GET("/whoami", whoami)
+	pages.GET("/login", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, CSRFToken(ctx))
+	})
+	pages.POST("/logout", func(ctx *gin.Context) {
+		if err := Logout(ctx); err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+	loggedIn := pages.Group("/", RequireAuth("/login"))
+	loggedIn.GET("/page", whoami)
+	loggedIn.HEAD("/page", whoami)
+
+	api := router.Group("/api", ProblemErrors(), authenticate, RequireAuth(""), VerifyCSRF())
+	api.GET("/whoami", whoami)
+	api.POST("/whoami", whoami)
+	api.POST("/login-again", func(ctx *gin.Context) {
+		Login(ctx, CurrentUser(ctx))
+		ctx.String(http.StatusOK, CSRFToken(ctx))
+	})
+	return router
+}
+
+type authFixture struct {
+	router   *gin.Engine
+	sessions *session.Manager
+	// alice 的会话 cookie 和 CSRF token
+	cookie *http.Cookie
+	token  string
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	store := memory.New()
+	alice := &model.User{Username: "alice", PasswordHash: "x"}
+	if err := store.CreateUser(context.Background(), alice); err != nil {
+		t.Fatal(err)
+	}
+	f := &authFixture{sessions: newTestSessions()}
+	f.router = newAuthRouter(f.sessions, store)
+	w := httptest.NewRecorder()
+	s := f.sessions.New(w, alice.ID)
+	f.cookie = w.Result().Cookies()[0]
+	f.token = f.sessions.CSRFToken(s)
+	return f
+}
+
+func (f *authFixture) do(method, target string, cookie *http.Cookie, header http.Header, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v[0])
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticate(t *testing.T) {
+	f := newAuthFixture(t)
+
+	// 已删除的用户按未登录处理
+	w := httptest.NewRecorder()
+	f.sessions.New(w, 999)
+	deleted := w.Result().Cookies()[0]
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   string
+	}{
+		{"logged in", f.cookie, "alice"},
+		{"no cookie", nil, "anonymous"},
+		{"forged cookie", &http.Cookie{Name: "session", Value: f.cookie.Value + "x"}, "anonymous"},
+		{"deleted user", deleted, "anonymous"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := f.do(http.MethodGet, "/whoami", tc.cookie, nil, "")
+			if w.Code != http.StatusOK || w.Body.String() != tc.want {
+				t.Errorf("GET /whoami = %d %q, want %q", w.Code, w.Body, tc.want)
+			}
+		})
+	}
+
+	t.Run("store error", func(t *testing.T) {
+		router := newAuthRouter(f.sessions, brokenUsers{})
+		req := httptest.NewRequest(http.MethodGet, "/api/whoami", nil)
+		req.AddCookie(f.cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500: %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestRequireAuth(t *testing.T) {
+	f := newAuthFixture(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		cookie   *http.Cookie
+		status   int
+		location string
+	}{
+		{"page logged in", http.MethodGet, "/page", f.cookie, http.StatusOK, ""},
+		{"page redirects to login", http.MethodGet, "/page?tab=a&b=1", nil, http.StatusSeeOther, "/login?next=" + url.QueryEscape("/page?tab=a&b=1")},
+		{"page HEAD redirects", http.MethodHead, "/page", nil, http.StatusSeeOther, "/login?next=%2Fpage"},
+		{"api returns 401", http.MethodGet, "/api/whoami", nil, http.StatusUnauthorized, ""},
+		{"api POST returns 401", http.MethodPost, "/api/whoami", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := f.do(tc.method, tc.target, tc.cookie, nil, "")
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if got := w.Header().Get("Location"); got != tc.location {
+				t.Errorf("Location = %q, want %q", got, tc.location)
+			}
+			if tc.status == http.StatusUnauthorized && !strings.Contains(w.Header().Get("Content-Type"), "application/problem+json") {
+				t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	f := newAuthFixture(t)
+
+	// 同一用户的另一个会话
+	w := httptest.NewRecorder()
+	other := f.sessions.CSRFToken(f.sessions.New(w, 1))
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		body   string
+		status int
+	}{
+		{"GET needs no token", http.MethodGet, nil, "", http.StatusOK},
+		{"missing token", http.MethodPost, nil, "", http.StatusForbidden},
+		{"header token", http.MethodPost, http.Header{CSRFHeader: {f.token}}, "", http.StatusOK},
+		{"form token", http.MethodPost, nil, CSRFFormField + "=" + url.QueryEscape(f.token), http.StatusOK},
+		{"wrong token", http.MethodPost, http.Header{CSRFHeader: {f.token + "x"}}, "", http.StatusForbidden},
+		{"token of another session", http.MethodPost, http.Header{CSRFHeader: {other}}, "", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := f.do(tc.method, "/api/whoami", f.cookie, tc.header, tc.body)
+			if w.Code != tc.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestLoginRotatesCSRFToken(t *testing.T) {
+	f := newAuthFixture(t)
+
+	w := f.do(http.MethodPost, "/api/login-again", f.cookie, http.Header{CSRFHeader: {f.token}}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == f.cookie.Value {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	newToken := w.Body.String()
+	if newToken == f.token {
+		t.Error("CSRF token was not rotated")
+	}
+
+	if w := f.do(http.MethodPost, "/api/whoami", cookies[0], http.Header{CSRFHeader: {f.token}}, ""); w.Code != http.StatusForbidden {
+		t.Errorf("old token: status = %d, want 403", w.Code)
+	}
+	if w := f.do(http.MethodPost, "/api/whoami", cookies[0], http.Header{CSRFHeader: {newToken}}, ""); w.Code != http.StatusOK {
+		t.Errorf("new token: status = %d, want 200", w.Code)
+	}
+}
+
+func TestAnonymousCSRFToken(t *testing.T) {
+	f := newAuthFixture(t)
+
+	// 登录页为匿名用户创建会话
+	w := f.do(http.MethodGet, "/login", nil, nil, "")
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || w.Body.Len() == 0 || len(cookies) != 1 {
+		t.Fatalf("GET /login = %d %q, cookies %+v", w.Code, w.Body, cookies)
+	}
+	// 已有会话时不重新创建
+	if w := f.do(http.MethodGet, "/login", f.cookie, nil, ""); w.Body.String() != f.token || len(w.Result().Cookies()) != 0 {
+		t.Errorf("GET /login with a session = %q, cookies %+v", w.Body, w.Result().Cookies())
+	}
+	// 匿名会话的 token 不能通过登录检查
+	if w := f.do(http.MethodPost, "/api/whoami", cookies[0], http.Header{CSRFHeader: {w.Body.String()}}, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous POST: status = %d, want 401", w.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	f := newAuthFixture(t)
+	w := f.do(http.MethodPost, "/logout", f.cookie, nil, "")
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusNoContent || len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("POST /logout = %d, cookies %+v", w.Code, cookies)
+	}
+
+	// 注销前复制的 cookie 不能再使用
+	if w := f.do(http.MethodGet, "/whoami", f.cookie, nil, ""); w.Body.String() != "anonymous" {
+		t.Errorf("GET /whoami after logout = %q", w.Body)
+	}
+	if w := f.do(http.MethodGet, "/page", f.cookie, nil, ""); w.Code != http.StatusSeeOther {
+		t.Errorf("GET /page after logout = %d, want 303", w.Code)
+	}
+	if w := f.do(http.MethodGet, "/api/whoami", f.cookie, nil, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/whoami after logout = %d, want 401", w.Code)
+	}
+}
+
+// 读写注销记录时总是返回错误
+type brokenRevocations struct{}
+
+func (brokenRevocations) Revoke(ctx context.Context, nonce string, expires time.Time) error {
+	return errors.New("redis is down")
+}
+
+func (brokenRevocations) Revoked(ctx context.Context, nonce string) (bool, error) {
+	return false, errors.New("redis is down")
+}
+
+func TestRevocationsError(t *testing.T) {
+	f := newAuthFixture(t)
+	sessions := session.NewManager(session.Options{Secret: []byte(strings.Repeat("x", 32)), CookieName: "session",
+		TTL: time.Hour, Revocations: brokenRevocations{}})
+	f.router = newAuthRouter(sessions, memory.New())
+	// 无法确认会话是否已注销时不能按已登录处理
+	if w := f.do(http.MethodGet, "/api/whoami", f.cookie, nil, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("GET /api/whoami = %d, want 500", w.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-mysti/apperror"
+	"go-mysti/jwtauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	authMethodKey = "auth_method"
+	claimsKey     = "token_claims"
+)
+
+// BearerAuth 校验 Authorization: Bearer 请求头中的 JWT，通过后把声明映射为当前用户
+//
+// 没有 bearer token 时继续处理请求，由之前的 Authenticate 或之后的 RequireAuth 决定是否需要登录；
+// token 不合法时直接返回 401，不会回退到会话认证。
+func BearerAuth(verifier *jwtauth.Verifier, mapping jwtauth.ClaimMapping) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scheme, token, ok := strings.Cut(ctx.GetHeader("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			ctx.Next()
+			return
+		}
+
+		claims, err := verifier.Verify(ctx.Request.Context(), strings.TrimSpace(token))
+		if err != nil {
+			if !errors.Is(err, jwtauth.ErrInvalidToken) {
+				ctx.Error(apperror.Unavailable(err, "token verification keys are unavailable"))
+				ctx.Abort()
+				return
+			}
+			ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			ctx.Error(apperror.Wrap(err, http.StatusUnauthorized, "invalid_token", err.Error()))
+			ctx.Abort()
+			return
+		}
+		user, err := mapping.User(claims)
+		if err != nil {
+			ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			ctx.Error(apperror.Wrap(err, http.StatusUnauthorized, "invalid_token", err.Error()))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set(userKey, user)
+		ctx.Set(authMethodKey, "bearer")
+		ctx.Set(claimsKey, claims)
+		ctx.Next()
+	}
+}
+
+// TokenClaims 返回 bearer token 的声明，不是 token 认证时返回 nil
+func TokenClaims(ctx *gin.Context) jwtauth.Claims {
+	if v, ok := ctx.Get(claimsKey); ok {
+		return v.(jwtauth.Claims)
+	}
+	return nil
+}
+
+// 浏览器不会自动附带 Authorization 请求头，token 认证的请求不需要 CSRF 校验
+func bearerAuthenticated(ctx *gin.Context) bool {
+	return ctx.GetString(authMethodKey) == "bearer"
+}
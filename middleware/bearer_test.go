@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mysti/jwtauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSecret = []byte(strings.Repeat("k", 32))
+
+func hs256(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc(c)
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc(mac.Sum(nil))
+}
+
+func newBearerRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	verifier := jwtauth.NewVerifier(jwtauth.Options{
+		Keys:      jwtauth.StaticKeys(jwtauth.Key{Key: testSecret}),
+		Issuer:    "test",
+		Audiences: []string{"mysti"},
+	})
+	router := gin.New()
+	api := router.Group("/api", RequestID(), ProblemErrors(), BearerAuth(verifier, jwtauth.ClaimMapping{RolesClaim: "roles"}), RequireAuth(""), VerifyCSRF())
+	api.POST("/whoami", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, CurrentUser(ctx))
+	})
+	return router
+}
+
+func TestBearerAuth(t *testing.T) {
+	router := newBearerRouter()
+	valid := hs256(t, map[string]any{"iss": "test", "aud": "mysti", "sub": "ci", "roles": []string{"ingest"}, "exp": time.Now().Add(time.Hour).Unix()})
+	expired := hs256(t, map[string]any{"iss": "test", "aud": "mysti", "sub": "ci", "exp": time.Now().Add(-time.Hour).Unix()})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"valid token skips CSRF", "Bearer " + valid, http.StatusOK},
+		{"expired token", "Bearer " + expired, http.StatusUnauthorized},
+		{"garbage token", "Bearer abc", http.StatusUnauthorized},
+		{"no credentials", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/whoami", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			invalidToken := strings.Contains(w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+			if want := tt.status == http.StatusUnauthorized && tt.authorization != ""; invalidToken != want {
+				t.Errorf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+			}
+			if tt.status == http.StatusOK && !strings.Contains(w.Body.String(), `"ingest"`) {
+				t.Errorf("body = %s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"go-mysti/apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const rendererKey = "error_renderer"
+
+type errorRenderer func(ctx *gin.Context, err *apperror.Error)
+
+// Problem 是 RFC 9457 application/problem+json 响应体
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ProblemErrors 把 handler 通过 ctx.Error 返回的错误渲染为 application/problem+json，用于 API 路由
+func ProblemErrors() gin.HandlerFunc {
+	return handleErrors(renderProblem)
+}
+
+// HTMLErrors 把 handler 通过 ctx.Error 返回的错误渲染为页面，用于 HTML 路由
+//
+// 模板可以使用 .title、.status、.code、.message、.requestID 和 .user。
+func HTMLErrors(name string) gin.HandlerFunc {
+	return handleErrors(func(ctx *gin.Context, err *apperror.Error) {
+		ctx.HTML(err.Status, name, gin.H{
+			"title":     http.StatusText(err.Status),
+			"status":    err.Status,
+			"code":      err.Code,
+			"message":   err.Message,
+			"requestID": GetRequestID(ctx),
+			"user":      CurrentUser(ctx),
+		})
+	})
+}
+
+// Recovery 把 panic 转换为 500，按所在路由的错误格式渲染，没有错误处理中间件时使用 problem+json
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(ctx *gin.Context, recovered any) {
+		err := apperror.Internal(fmt.Errorf("panic: %v", recovered))
+		logError(ctx, "%v", err)
+		if !ctx.Writer.Written() {
+			renderer(ctx)(ctx, err)
+		}
+		ctx.Abort()
+	})
+}
+
+func handleErrors(render errorRenderer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(rendererKey, render)
+		ctx.Next()
+
+		last := ctx.Errors.Last()
+		if last == nil {
+			return
+		}
+		err := apperror.From(last.Err)
+		// 客户端错误是预期内的，只记录服务端错误
+		if err.Status >= http.StatusInternalServerError {
+			logError(ctx, "%v", err)
+		}
+		if ctx.Writer.Written() {
+			return
+		}
+		render(ctx, err)
+	}
+}
+
+func renderer(ctx *gin.Context) errorRenderer {
+	if v, ok := ctx.Get(rendererKey); ok {
+		return v.(errorRenderer)
+	}
+	return renderProblem
+}
+
+func renderProblem(ctx *gin.Context, err *apperror.Error) {
+	ctx.Header("Content-Type", "application/problem+json")
+	ctx.JSON(err.Status, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(err.Status),
+		Status:    err.Status,
+		Detail:    err.Message,
+		Instance:  ctx.Request.URL.Path,
+		Code:      err.Code,
+		RequestID: GetRequestID(ctx),
+	})
+}
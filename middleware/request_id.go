@@ -0,0 +1,74 @@
+// Package middleware 包含 cmd/server 使用的 gin 中间件
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	// 客户端传入的请求 ID 最大长度
+	maxRequestIDLength = 128
+)
+
+// RequestID 为每个请求分配 ID，优先使用客户端或网关传入的 X-Request-ID，并写入响应头
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength || !printable(id) {
+			id = newRequestID()
+		}
+		ctx.Set(requestIDKey, id)
+		ctx.Header(RequestIDHeader, id)
+		ctx.Next()
+	}
+}
+
+// GetRequestID 返回当前请求的 ID，没有使用 RequestID 中间件时返回空字符串
+func GetRequestID(ctx *gin.Context) string {
+	return ctx.GetString(requestIDKey)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Logger 是带请求 ID 的访问日志，替代 gin.Logger
+//
+// 错误详情由错误处理中间件单独记录。
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %-7s %#v\n",
+			p.TimeStamp.Format(time.RFC3339),
+			p.Keys[requestIDKey],
+			p.StatusCode,
+			p.Latency,
+			p.ClientIP,
+			p.Method,
+			p.Path,
+		)
+	})
+}
+
+// 错误日志统一带上请求 ID
+func logError(ctx *gin.Context, format string, args ...any) {
+	log.Printf("[%s] %s %s: %s", GetRequestID(ctx), ctx.Request.Method, ctx.Request.URL.Path, fmt.Sprintf(format, args...))
+}
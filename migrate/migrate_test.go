@@ -0,0 +1,129 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "  \n", nil},
+		{"comments only", "-- nothing to do\n# really\n", nil},
+		{"two statements", "CREATE TABLE a (id INT);\nDROP TABLE b;", []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}},
+		{"no trailing semicolon", "SELECT 1", []string{"SELECT 1"}},
+		{"semicolon in quotes", `INSERT INTO t VALUES ('a;b', "c;d", 1); SELECT 2`,
+			[]string{`INSERT INTO t VALUES ('a;b', "c;d", 1)`, "SELECT 2"}},
+		{"escaped quote", `SELECT 'it\'s; fine'; SELECT 3`, []string{`SELECT 'it\'s; fine'`, "SELECT 3"}},
+		{"backtick", "SELECT `a;b` FROM t;", []string{"SELECT `a;b` FROM t"}},
+		{"semicolon in comment", "-- drop; later\nSELECT 1; # trailing; comment\nSELECT 2;",
+			[]string{"SELECT 1", "SELECT 2"}},
+		// -- 后面没有空格不是注释
+		{"double dash", "SELECT 1--1;", []string{"SELECT 1--1"}},
+	}
+	for _, tt := range tests {
+		if got := SplitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SplitStatements = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX i ON a (id);")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX i ON a;")},
+		"0001_create_a.up.sql":    {Data: []byte("CREATE TABLE a (id INT);")},
+		"0010_no_down.up.sql":     {Data: []byte("SELECT 1;")},
+		"README.md":               {Data: []byte("ignored")},
+		"0003_dir.up.sql/x":       {Data: []byte("directories are ignored")},
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Name)
+	}
+	if want := []string{"create_a", "add_index", "no_down"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("names = %q, want %q", got, want)
+	}
+	if migrations[1].Version != 2 || migrations[1].Down != "DROP INDEX i ON a;" || migrations[2].Down != "" {
+		t.Errorf("migrations = %+v", migrations)
+	}
+
+	errTests := []struct {
+		name string
+		fsys fstest.MapFS
+		err  string
+	}{
+		{"conflicting names", fstest.MapFS{
+			"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		}, "conflicting names"},
+		{"down only", fstest.MapFS{"0001_a.down.sql": {Data: []byte("SELECT 1;")}}, "has no up script"},
+		{"empty up", fstest.MapFS{"0001_a.up.sql": {Data: []byte(" \n")}}, "has no up script"},
+	}
+	for _, tt := range errTests {
+		if _, err := Load(tt.fsys); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestCreatedTables(t *testing.T) {
+	m := Migration{Up: "-- baseline\nCREATE TABLE a (id INT);\ncreate table `b` (id INT);\n" +
+		"CREATE TABLE IF NOT EXISTS c (id INT);\nCREATE INDEX i ON a (id);"}
+	if got := m.CreatedTables(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("CreatedTables = %q", got)
+	}
+}
+
+// 内置的迁移文件
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load(os.DirFS(filepath.Join("..", "assets", "migrations")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: versions are not contiguous", m.Version, m.Name)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+	// 0001 是基线迁移，建表时检查表是否已经存在，回滚时不删除已有的数据
+	baseline := migrations[0]
+	if got := baseline.CreatedTables(); !reflect.DeepEqual(got, []string{"container_stats"}) {
+		t.Errorf("0001 creates %q", got)
+	}
+	if stmts := SplitStatements(baseline.Down); len(stmts) != 0 {
+		t.Errorf("0001 down runs %q", stmts)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	files, err := Create(dir, "Add Users!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(files[0]) != "0001_add_users.up.sql" || filepath.Base(files[1]) != "0001_add_users.down.sql" {
+		t.Errorf("files = %q", files)
+	}
+	files, err = Create(dir, "next")
+	if err != nil || filepath.Base(files[0]) != "0002_next.up.sql" {
+		t.Errorf("second Create = %q, %v", files, err)
+	}
+	if _, err := Create(dir, "!!!"); err == nil {
+		t.Error("empty name accepted")
+	}
+}
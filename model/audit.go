@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// AuditEntry 对应 kube_audit_log 表中的一行，记录一次 Kubernetes 请求
+type AuditEntry struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Cluster  string    `json:"cluster"`
+	Username string    `json:"username"`
+	ClientIP string    `json:"client_ip"`
+	// get、list、delete 等，非资源请求为小写的 HTTP 方法
+	Verb        string `json:"verb"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	APIGroup    string `json:"api_group"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	StatusCode  int    `json:"status_code"`
+	// watch、exec 等长连接为连接持续的时间
+	LatencyMS int64 `json:"latency_ms"`
+	// 转发给 API server 的请求体的 SHA-256，没有请求体时为空
+	BodySHA256 string `json:"body_sha256"`
+	RequestID  string `json:"request_id"`
+}
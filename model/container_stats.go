@@ -0,0 +1,70 @@
+package model
+
+import "time"
+
+// Container 是 container_stats 中出现过的容器
+type Container struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ContainerStat 对应 container_stats 表中的一行
+type ContainerStat struct {
+	ID              int64     `json:"-"`
+	Time            time.Time `json:"time"`
+	ContainerID     string    `json:"container_id"`
+	ContainerName   string    `json:"container_name"`
+	CPUPercent      float64   `json:"cpu_percent"`
+	MemUsage        uint64    `json:"mem_usage"`
+	MemLimit        uint64    `json:"mem_limit"`
+	MemPercent      float64   `json:"mem_percent"`
+	NetRxBytes      uint64    `json:"net_rx_bytes"`
+	NetTxBytes      uint64    `json:"net_tx_bytes"`
+	BlockReadBytes  uint64    `json:"block_read_bytes"`
+	BlockWriteBytes uint64    `json:"block_write_bytes"`
+	PIDs            uint64    `json:"pids"`
+}
+
+// ContainerStatFields 是可以按名称选择的字段，顺序即输出顺序
+var ContainerStatFields = []string{
+	"time", "container_id", "container_name",
+	"cpu_percent", "mem_usage", "mem_limit", "mem_percent",
+	"net_rx_bytes", "net_tx_bytes", "block_read_bytes", "block_write_bytes", "pids",
+}
+
+// Field 按字段名取值
+func (s *ContainerStat) Field(name string) any {
+	switch name {
+	case "time":
+		return s.Time
+	case "container_id":
+		return s.ContainerID
+	case "container_name":
+		return s.ContainerName
+	case "cpu_percent":
+		return s.CPUPercent
+	case "mem_usage":
+		return s.MemUsage
+	case "mem_limit":
+		return s.MemLimit
+	case "mem_percent":
+		return s.MemPercent
+	case "net_rx_bytes":
+		return s.NetRxBytes
+	case "net_tx_bytes":
+		return s.NetTxBytes
+	case "block_read_bytes":
+		return s.BlockReadBytes
+	case "block_write_bytes":
+		return s.BlockWriteBytes
+	case "pids":
+		return s.PIDs
+	}
+	return nil
+}
+
+// ContainerStatMetrics 是可以聚合的数值字段，汇总表中每个字段保存 _sum/_min/_max 三列
+var ContainerStatMetrics = []string{
+	"cpu_percent", "mem_usage", "mem_limit", "mem_percent",
+	"net_rx_bytes", "net_tx_bytes", "block_read_bytes", "block_write_bytes", "pids",
+}
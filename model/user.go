@@ -0,0 +1,20 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// User 对应 users 表中的一行
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Roles        []string  `json:"roles"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// HasRole 判断用户是否拥有指定角色
+func (u *User) HasRole(role string) bool {
+	return slices.Contains(u.Roles, role)
+}
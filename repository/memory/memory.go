@@ -0,0 +1,237 @@
+// Package memory 是 repository 的内存实现，用于测试
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go-mysti/model"
+	"go-mysti/repository"
+	"go-mysti/retention"
+)
+
+// Store 把所有数据保存在内存中
+//
+// 汇总表不单独保存，分桶查询总是基于原始数据计算，BucketQuery.Table 和 RawFrom 被忽略。
+type Store struct {
+	mu     sync.RWMutex
+	stats  []model.ContainerStat
+	users  []model.User
+	audit  []model.AuditEntry
+	nextID int64
+}
+
+var _ repository.Repository = (*Store)(nil)
+
+func New() *Store {
+	return &Store{}
+}
+
+func (s *Store) ListContainers(ctx context.Context) ([]model.Container, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// 与 MySQL 实现一致，名称取字典序最大的一个
+	names := make(map[string]string)
+	for _, stat := range s.stats {
+		if name, ok := names[stat.ContainerID]; !ok || stat.ContainerName > name {
+			names[stat.ContainerID] = stat.ContainerName
+		}
+	}
+	containers := make([]model.Container, 0, len(names))
+	for id, name := range names {
+		containers = append(containers, model.Container{ID: id, Name: name})
+	}
+	slices.SortFunc(containers, func(a, b model.Container) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	return containers, ctx.Err()
+}
+
+func (s *Store) ListStats(ctx context.Context, q repository.StatsQuery) ([]model.ContainerStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := []model.ContainerStat{}
+	for _, stat := range s.stats {
+		if stat.ContainerID != q.ContainerID || stat.Time.Before(q.From) || !stat.Time.Before(q.To) {
+			continue
+		}
+		if q.After != nil && (stat.Time.Before(q.After.Time) || stat.Time.Equal(q.After.Time) && stat.ID <= q.After.ID) {
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	sortStats(stats)
+	if len(stats) > q.Limit {
+		stats = stats[:q.Limit]
+	}
+	return stats, ctx.Err()
+}
+
+func (s *Store) StatBuckets(ctx context.Context, q repository.BucketQuery) (map[repository.BucketKey]repository.Aggregate, error) {
+	// 与 MySQL 一致，聚合查询不限制行数
+	q.MaxRows = 0
+	values, err := s.StatBucketValues(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[repository.BucketKey]repository.Aggregate, len(values))
+	for key, v := range values {
+		agg := repository.Aggregate{Count: float64(len(v)), Min: v[0], Max: v[0]}
+		for _, x := range v {
+			agg.Sum += x
+			agg.Min = min(agg.Min, x)
+			agg.Max = max(agg.Max, x)
+		}
+		agg.Avg = agg.Sum / agg.Count
+		result[key] = agg
+	}
+	return result, nil
+}
+
+func (s *Store) StatBucketValues(ctx context.Context, q repository.BucketQuery) (map[repository.BucketKey][]float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stepSeconds := int64(q.Step / time.Second)
+	result := make(map[repository.BucketKey][]float64)
+	rows := 0
+	for i := range s.stats {
+		stat := &s.stats[i]
+		if !slices.Contains(q.ContainerIDs, stat.ContainerID) || stat.Time.Before(q.From) || !stat.Time.Before(q.To) {
+			continue
+		}
+		if rows++; q.MaxRows > 0 && rows > q.MaxRows {
+			return nil, repository.ErrTooManyRows
+		}
+		// 与 FLOOR(UNIX_TIMESTAMP(__time) / step) 一致
+		bucket := stat.Time.Unix() / stepSeconds
+		if stat.Time.Unix()%stepSeconds < 0 {
+			bucket--
+		}
+		for _, metric := range q.Metrics {
+			key := repository.BucketKey{ContainerID: stat.ContainerID, Metric: metric, Bucket: bucket}
+			result[key] = append(result[key], toFloat(stat.Field(metric)))
+		}
+	}
+	return result, ctx.Err()
+}
+
+// RollupWatermark 总是返回零值，查询总是使用原始数据
+func (s *Store) RollupWatermark(ctx context.Context, table retention.Table) (time.Time, error) {
+	return time.Time{}, ctx.Err()
+}
+
+func (s *Store) InsertStats(ctx context.Context, rows []model.ContainerStat) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range rows {
+		s.nextID++
+		row.ID = s.nextID
+		s.stats = append(s.stats, row)
+	}
+	return nil
+}
+
+func (s *Store) UserByID(ctx context.Context, id int64) (*model.User, error) {
+	return s.findUser(ctx, func(u *model.User) bool { return u.ID == id })
+}
+
+func (s *Store) UserByUsername(ctx context.Context, username string) (*model.User, error) {
+	return s.findUser(ctx, func(u *model.User) bool { return u.Username == username })
+}
+
+func (s *Store) findUser(ctx context.Context, match func(*model.User) bool) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.users {
+		if match(&s.users[i]) {
+			u := s.users[i]
+			u.Roles = slices.Clone(u.Roles)
+			return &u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			return repository.ErrDuplicate
+		}
+	}
+	s.nextID++
+	user.ID = s.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	u := *user
+	u.Roles = slices.Clone(user.Roles)
+	s.users = append(s.users, u)
+	return nil
+}
+
+func (s *Store) InsertAuditEntries(ctx context.Context, entries []model.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		s.nextID++
+		e.ID = s.nextID
+		s.audit = append(s.audit, e)
+	}
+	return nil
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, q repository.AuditQuery) ([]model.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	match := func(filter, value string) bool { return filter == "" || filter == value }
+	entries := []model.AuditEntry{}
+	// 按写入顺序倒序，即 ID 倒序
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < q.Limit; i-- {
+		e := s.audit[i]
+		if e.Time.Before(q.From) || !e.Time.Before(q.To) || (q.BeforeID > 0 && e.ID >= q.BeforeID) || e.StatusCode < q.MinStatus {
+			continue
+		}
+		if match(q.Cluster, e.Cluster) && match(q.Username, e.Username) && match(q.Namespace, e.Namespace) &&
+			match(q.Verb, e.Verb) && match(q.Resource, e.Resource) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, ctx.Err()
+}
+
+func sortStats(stats []model.ContainerStat) {
+	slices.SortFunc(stats, func(a, b model.ContainerStat) int {
+		return cmp.Or(a.Time.Compare(b.Time), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case uint64:
+		return float64(v)
+	}
+	return 0
+}
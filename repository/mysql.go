@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go-mysti/model"
+	"go-mysti/retention"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const statColumns = "id, __time, container_id, container_name, cpu_percent, mem_usage, mem_limit, mem_percent, " +
+	"net_rx_bytes, net_tx_bytes, block_read_bytes, block_write_bytes, pids"
+
+const insertColumns = "__time, container_id, container_name, cpu_percent, mem_usage, mem_limit, mem_percent, " +
+	"net_rx_bytes, net_tx_bytes, block_read_bytes, block_write_bytes, pids"
+
+const insertColumnCount = 12
+
+const userColumns = "id, username, password_hash, roles, created_at"
+
+const auditColumns = "id, __time, cluster, username, client_ip, verb, method, path, api_group, resource, subresource, " +
+	"namespace, name, status_code, latency_ms, body_sha256, request_id"
+
+const auditInsertColumnCount = 16
+
+// 缓存的预编译语句上限，超过后直接执行，避免容器数、字段组合过多时占满服务端的语句缓存
+const maxPreparedStatements = 128
+
+// MySQL 是基于 MySQL 的 Repository 实现
+//
+// 语句在第一次使用时预编译并缓存，之后复用；所有查询都使用调用方的 context，
+// 请求取消时查询随之中断。
+type MySQL struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+var _ Repository = (*MySQL)(nil)
+
+func NewMySQL(db *sql.DB) *MySQL {
+	return &MySQL{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// Close 释放预编译语句，不关闭 db
+func (r *MySQL) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for query, stmt := range r.stmts {
+		errs = append(errs, stmt.Close())
+		delete(r.stmts, query)
+	}
+	return errors.Join(errs...)
+}
+
+// 返回 query 对应的预编译语句，缓存已满时返回 nil
+func (r *MySQL) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stmt, ok := r.stmts[query]; ok {
+		return stmt, nil
+	}
+	if len(r.stmts) >= maxPreparedStatements {
+		return nil, nil
+	}
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	r.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (r *MySQL) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return r.db.QueryContext(ctx, query, args...)
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (r *MySQL) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return r.db.ExecContext(ctx, query, args...)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (r *MySQL) ListContainers(ctx context.Context) ([]model.Container, error) {
+	rows, err := r.query(ctx,
+		"SELECT container_id, MAX(container_name) FROM container_stats GROUP BY container_id ORDER BY MAX(container_name), container_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	containers := []model.Container{}
+	for rows.Next() {
+		var c model.Container
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			return nil, err
+		}
+		containers = append(containers, c)
+	}
+	return containers, rows.Err()
+}
+
+func (r *MySQL) ListStats(ctx context.Context, q StatsQuery) ([]model.ContainerStat, error) {
+	var query strings.Builder
+	query.WriteString("SELECT " + statColumns + " FROM container_stats WHERE container_id = ? AND __time >= ? AND __time < ?")
+	args := []any{q.ContainerID, q.From, q.To}
+	if q.After != nil {
+		query.WriteString(" AND (__time > ? OR (__time = ? AND id > ?))")
+		args = append(args, q.After.Time, q.After.Time, q.After.ID)
+	}
+	query.WriteString(" ORDER BY __time, id LIMIT ?")
+	args = append(args, q.Limit)
+
+	rows, err := r.query(ctx, query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []model.ContainerStat{}
+	for rows.Next() {
+		var s model.ContainerStat
+		err := rows.Scan(&s.ID, &s.Time, &s.ContainerID, &s.ContainerName, &s.CPUPercent, &s.MemUsage, &s.MemLimit,
+			&s.MemPercent, &s.NetRxBytes, &s.NetTxBytes, &s.BlockReadBytes, &s.BlockWriteBytes, &s.PIDs)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// 分桶查询的数据来源和参数
+//
+// 汇总表在 RawFrom 之后的数据还没有汇总，从原始表读取后与汇总表合并，
+// 原始表的每行作为 samples 为 1、sum/min/max 都等于原值的汇总行。
+func bucketSource(q BucketQuery) (string, []any) {
+	where := " WHERE container_id IN (" + placeholders(len(q.ContainerIDs)) + ") AND __time >= ? AND __time < ?"
+	args := func(from, to time.Time) []any {
+		args := make([]any, 0, len(q.ContainerIDs)+2)
+		for _, id := range q.ContainerIDs {
+			args = append(args, id)
+		}
+		return append(args, from, to)
+	}
+	if q.Table.Raw() || q.RawFrom.IsZero() {
+		return q.Table.Name + where, args(q.From, q.To)
+	}
+
+	rollup := []string{"container_id", "__time", "samples"}
+	raw := []string{"container_id", "__time", "1"}
+	for _, metric := range q.Metrics {
+		rollup = append(rollup, metric+"_sum", metric+"_min", metric+"_max")
+		raw = append(raw, metric, metric, metric)
+	}
+	source := "(SELECT " + strings.Join(rollup, ", ") + " FROM " + q.Table.Name + where +
+		" UNION ALL SELECT " + strings.Join(raw, ", ") + " FROM " + retention.RawTable.Name + where + ") AS t"
+	return source, append(args(q.From, q.RawFrom), args(q.RawFrom, q.To)...)
+}
+
+// RollupWatermark 读取汇总任务记录的进度
+func (r *MySQL) RollupWatermark(ctx context.Context, table retention.Table) (time.Time, error) {
+	return retention.Watermark(ctx, r.db, table)
+}
+
+func (r *MySQL) StatBuckets(ctx context.Context, q BucketQuery) (map[BucketKey]Aggregate, error) {
+	columns := []string{"container_id", "FLOOR(UNIX_TIMESTAMP(__time) / ?) AS bucket"}
+	if q.Table.Raw() {
+		columns = append(columns, "COUNT(*)")
+		for _, metric := range q.Metrics {
+			columns = append(columns, "AVG("+metric+")", "MIN("+metric+")", "MAX("+metric+")", "SUM("+metric+")")
+		}
+	} else {
+		// 汇总表中保存的是每个桶的 sum/min/max 和样本数
+		columns = append(columns, "SUM(samples)")
+		for _, metric := range q.Metrics {
+			columns = append(columns, "SUM("+metric+"_sum) / SUM(samples)", "MIN("+metric+"_min)", "MAX("+metric+"_max)", "SUM("+metric+"_sum)")
+		}
+	}
+	source, sourceArgs := bucketSource(q)
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + source + " GROUP BY container_id, bucket"
+
+	rows, err := r.query(ctx, query, append([]any{int64(q.Step / time.Second)}, sourceArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[BucketKey]Aggregate)
+	values := make([]sql.NullFloat64, len(q.Metrics)*4)
+	dest := make([]any, 0, 3+len(values))
+	for rows.Next() {
+		var containerID string
+		var bucket, count int64
+		dest = append(dest[:0], &containerID, &bucket, &count)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, metric := range q.Metrics {
+			result[BucketKey{containerID, metric, bucket}] = Aggregate{
+				Count: float64(count),
+				Avg:   values[i*4].Float64,
+				Min:   values[i*4+1].Float64,
+				Max:   values[i*4+2].Float64,
+				Sum:   values[i*4+3].Float64,
+			}
+		}
+	}
+	return result, rows.Err()
+}
+
+// 使用汇总表时以每行的平均值作为样本，结果是近似值
+func (r *MySQL) StatBucketValues(ctx context.Context, q BucketQuery) (map[BucketKey][]float64, error) {
+	columns := q.Metrics
+	if !q.Table.Raw() {
+		columns = make([]string, len(q.Metrics))
+		for i, metric := range q.Metrics {
+			columns[i] = metric + "_sum / samples"
+		}
+	}
+	source, sourceArgs := bucketSource(q)
+	query := "SELECT container_id, FLOOR(UNIX_TIMESTAMP(__time) / ?) AS bucket, " + strings.Join(columns, ", ") + " FROM " + source
+	args := append([]any{int64(q.Step / time.Second)}, sourceArgs...)
+	if q.MaxRows > 0 {
+		// 多读一行用于判断是否超过上限
+		query += " LIMIT ?"
+		args = append(args, q.MaxRows+1)
+	}
+
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[BucketKey][]float64)
+	values := make([]float64, len(q.Metrics))
+	dest := make([]any, 0, 2+len(values))
+	for n := 1; rows.Next(); n++ {
+		if q.MaxRows > 0 && n > q.MaxRows {
+			return nil, ErrTooManyRows
+		}
+		var containerID string
+		var bucket int64
+		dest = append(dest[:0], &containerID, &bucket)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, metric := range q.Metrics {
+			key := BucketKey{containerID, metric, bucket}
+			result[key] = append(result[key], values[i])
+		}
+	}
+	return result, rows.Err()
+}
+
+// InsertStats 用一条多行 INSERT 写入数据
+//
+// 行数不固定，不使用预编译语句缓存。
+func (r *MySQL) InsertStats(ctx context.Context, rows []model.ContainerStat) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	placeholder := "(" + placeholders(insertColumnCount) + ")"
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO container_stats (" + insertColumns + ") VALUES ")
+	args := make([]any, 0, len(rows)*insertColumnCount)
+	for i, s := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(placeholder)
+		args = append(args, s.Time, s.ContainerID, s.ContainerName, s.CPUPercent, s.MemUsage, s.MemLimit, s.MemPercent,
+			s.NetRxBytes, s.NetTxBytes, s.BlockReadBytes, s.BlockWriteBytes, s.PIDs)
+	}
+
+	_, err := r.db.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+func (r *MySQL) UserByID(ctx context.Context, id int64) (*model.User, error) {
+	return r.queryUser(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id)
+}
+
+func (r *MySQL) UserByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.queryUser(ctx, "SELECT "+userColumns+" FROM users WHERE username = ?", username)
+}
+
+func (r *MySQL) queryUser(ctx context.Context, query string, args ...any) (*model.User, error) {
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	var u model.User
+	var roles string
+	if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &roles, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	u.Roles = splitRoles(roles)
+	return &u, nil
+}
+
+func (r *MySQL) CreateUser(ctx context.Context, user *model.User) error {
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	result, err := r.exec(ctx, "INSERT INTO users (username, password_hash, roles, created_at) VALUES (?, ?, ?, ?)",
+		user.Username, user.PasswordHash, strings.Join(user.Roles, ","), user.CreatedAt)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		// 1062: ER_DUP_ENTRY
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrDuplicate
+		}
+		return err
+	}
+	user.ID, err = result.LastInsertId()
+	return err
+}
+
+// InsertAuditEntries 用一条多行 INSERT 写入记录
+func (r *MySQL) InsertAuditEntries(ctx context.Context, entries []model.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	placeholder := "(" + placeholders(auditInsertColumnCount) + ")"
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO kube_audit_log (" + strings.TrimPrefix(auditColumns, "id, ") + ") VALUES ")
+	args := make([]any, 0, len(entries)*auditInsertColumnCount)
+	for i, e := range entries {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(placeholder)
+		args = append(args, e.Time, e.Cluster, e.Username, e.ClientIP, e.Verb, e.Method, e.Path, e.APIGroup, e.Resource,
+			e.Subresource, e.Namespace, e.Name, e.StatusCode, e.LatencyMS, e.BodySHA256, e.RequestID)
+	}
+
+	_, err := r.db.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+func (r *MySQL) ListAuditEntries(ctx context.Context, q AuditQuery) ([]model.AuditEntry, error) {
+	var query strings.Builder
+	query.WriteString("SELECT " + auditColumns + " FROM kube_audit_log WHERE __time >= ? AND __time < ?")
+	args := []any{q.From, q.To}
+	for _, filter := range []struct {
+		column string
+		value  string
+	}{
+		{"cluster", q.Cluster},
+		{"username", q.Username},
+		{"namespace", q.Namespace},
+		{"verb", q.Verb},
+		{"resource", q.Resource},
+	} {
+		if filter.value != "" {
+			query.WriteString(" AND " + filter.column + " = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if q.MinStatus > 0 {
+		query.WriteString(" AND status_code >= ?")
+		args = append(args, q.MinStatus)
+	}
+	if q.BeforeID > 0 {
+		query.WriteString(" AND id < ?")
+		args = append(args, q.BeforeID)
+	}
+	query.WriteString(" ORDER BY id DESC LIMIT ?")
+	args = append(args, q.Limit)
+
+	rows, err := r.query(ctx, query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var e model.AuditEntry
+		err := rows.Scan(&e.ID, &e.Time, &e.Cluster, &e.Username, &e.ClientIP, &e.Verb, &e.Method, &e.Path, &e.APIGroup,
+			&e.Resource, &e.Subresource, &e.Namespace, &e.Name, &e.StatusCode, &e.LatencyMS, &e.BodySHA256, &e.RequestID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func splitRoles(raw string) []string {
+	roles := []string{}
+	for _, role := range strings.Split(raw, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-mysti/retention"
+)
+
+func TestBucketSource(t *testing.T) {
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	rawFrom := from.Add(20 * time.Hour)
+	q := BucketQuery{ContainerIDs: []string{"a", "b"}, Metrics: []string{"cpu_percent"}, From: from, To: to, Table: retention.MinuteTable}
+
+	source, args := bucketSource(q)
+	if want := "container_stats_1m WHERE container_id IN (?, ?) AND __time >= ? AND __time < ?"; source != want {
+		t.Errorf("source = %q, want %q", source, want)
+	}
+	if len(args) != 4 || args[2] != from || args[3] != to {
+		t.Errorf("args = %v", args)
+	}
+
+	// 汇总表之后的部分从原始表读取
+	q.RawFrom = rawFrom
+	source, args = bucketSource(q)
+	for _, want := range []string{
+		"(SELECT container_id, __time, samples, cpu_percent_sum, cpu_percent_min, cpu_percent_max FROM container_stats_1m WHERE",
+		" UNION ALL SELECT container_id, __time, 1, cpu_percent, cpu_percent, cpu_percent FROM container_stats WHERE",
+		") AS t",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("source does not contain %q:\n%s", want, source)
+		}
+	}
+	want := []any{"a", "b", from, rawFrom, "a", "b", rawFrom, to}
+	if len(args) != len(want) {
+		t.Fatalf("args = %v, want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("args[%d] = %v, want %v", i, args[i], want[i])
+		}
+	}
+
+	// 原始表忽略 RawFrom
+	q.Table = retention.RawTable
+	if source, _ = bucketSource(q); strings.Contains(source, "UNION") {
+		t.Errorf("raw table source = %q", source)
+	}
+}
@@ -0,0 +1,129 @@
+// Package repository 封装数据访问，控制器只依赖这里的接口
+//
+// MySQL 实现见 NewMySQL，测试使用 repository/memory 中的内存实现。
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-mysti/model"
+	"go-mysti/retention"
+)
+
+// ErrNotFound 表示查询的记录不存在
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate 表示违反唯一约束
+var ErrDuplicate = errors.New("duplicate record")
+
+// ErrTooManyRows 表示查询的行数超过了 MaxRows
+var ErrTooManyRows = errors.New("too many rows")
+
+// Containers 查询出现过的容器
+type Containers interface {
+	// ListContainers 按名称排序返回所有容器
+	ListContainers(ctx context.Context) ([]model.Container, error)
+}
+
+// Stats 读写容器监控数据
+type Stats interface {
+	// ListStats 按 (__time, id) 顺序返回单个容器的原始数据
+	ListStats(ctx context.Context, q StatsQuery) ([]model.ContainerStat, error)
+	// StatBuckets 按 step 分桶计算 avg/min/max/sum/count
+	StatBuckets(ctx context.Context, q BucketQuery) (map[BucketKey]Aggregate, error)
+	// StatBucketValues 返回每个桶内的全部样本，用于计算百分位数；行数超过 q.MaxRows 时返回 ErrTooManyRows
+	StatBucketValues(ctx context.Context, q BucketQuery) (map[BucketKey][]float64, error)
+	// RollupWatermark 返回汇总表已经汇总到的时间，尚未汇总过时返回零值
+	RollupWatermark(ctx context.Context, table retention.Table) (time.Time, error)
+	// InsertStats 写入一批数据
+	InsertStats(ctx context.Context, rows []model.ContainerStat) error
+}
+
+// Users 读写登录用户
+type Users interface {
+	UserByID(ctx context.Context, id int64) (*model.User, error)
+	UserByUsername(ctx context.Context, username string) (*model.User, error)
+	// CreateUser 写入用户并回填 ID，用户名已存在时返回 ErrDuplicate
+	CreateUser(ctx context.Context, user *model.User) error
+}
+
+// Audit 读写 Kubernetes 请求的审计记录
+type Audit interface {
+	InsertAuditEntries(ctx context.Context, entries []model.AuditEntry) error
+	// ListAuditEntries 按 ID 倒序（最新的在前）返回匹配的记录
+	ListAuditEntries(ctx context.Context, q AuditQuery) ([]model.AuditEntry, error)
+}
+
+// Repository 包含全部数据访问接口
+type Repository interface {
+	Containers
+	Stats
+	Users
+	Audit
+}
+
+// Cursor 指向上一页的最后一行
+type Cursor struct {
+	Time time.Time
+	ID   int64
+}
+
+// StatsQuery 查询容器在 [From, To) 内的数据，After 不为空时从游标之后开始
+type StatsQuery struct {
+	ContainerID string
+	From        time.Time
+	To          time.Time
+	After       *Cursor
+	Limit       int
+}
+
+// AuditQuery 查询 [From, To) 内的审计记录，字符串条件为空时不过滤
+type AuditQuery struct {
+	From      time.Time
+	To        time.Time
+	Cluster   string
+	Username  string
+	Namespace string
+	Verb      string
+	Resource  string
+	// 只返回状态码不小于该值的记录，例如 400 表示只看失败的请求
+	MinStatus int
+	// 大于 0 时只返回 ID 小于该值的记录，用于翻页
+	BeforeID int64
+	Limit    int
+}
+
+// BucketQuery 描述分桶聚合查询，桶按 Step 对齐到 Unix 时间
+type BucketQuery struct {
+	ContainerIDs []string
+	// 字段名，必须是 model.ContainerStatMetrics 中的值
+	Metrics []string
+	From    time.Time
+	To      time.Time
+	Step    time.Duration
+	// 查询的表，原始表或汇总表
+	Table retention.Table
+	// 使用汇总表时，不为零值表示 [RawFrom, To) 还没有汇总，这部分从原始表读取后合并
+	RawFrom time.Time
+	// StatBucketValues 最多读取的行数，0 表示不限制
+	MaxRows int
+}
+
+// BucketKey 标识某个容器某个字段的一个桶
+type BucketKey struct {
+	ContainerID string
+	Metric      string
+	// 桶起始时间的 Unix 秒数除以步长
+	Bucket int64
+}
+
+// Aggregate 是一个桶的聚合结果
+type Aggregate struct {
+	Count float64
+	Sum   float64
+	Avg   float64
+	Min   float64
+	Max   float64
+}
@@ -0,0 +1,240 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-mysti/config"
+	"go-mysti/model"
+)
+
+const (
+	// 每条汇总语句处理的时间窗口，避免长时间锁表
+	minuteRollupChunk = time.Hour
+	hourRollupChunk   = 24 * time.Hour
+	// 等待迟到的数据
+	rollupLag = 2 * time.Minute
+	// 多个副本共用数据库时，同一时间只有一个副本执行任务
+	lockName = "mysti_retention"
+)
+
+// Job 把原始数据汇总到 container_stats_1m/container_stats_1h，并清理过期数据
+type Job struct {
+	db  *sql.DB
+	cfg config.RetentionConfig
+}
+
+func NewJob(db *sql.DB, cfg config.RetentionConfig) *Job {
+	return &Job{db: db, cfg: cfg}
+}
+
+// Run 按间隔执行，直到 ctx 结束
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.RunOnce(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			log.Printf("retention: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 先汇总再清理，清理时不会删除尚未汇总的数据
+//
+// 其他副本正在执行时直接返回。
+func (j *Job) RunOnce(ctx context.Context, now time.Time) error {
+	// GET_LOCK 属于连接，使用单独的连接持有锁，连接断开时锁自动释放
+	conn, err := j.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&locked); err != nil {
+		return fmt.Errorf("acquire lock: %w", err)
+	}
+	if locked.Int64 != 1 {
+		log.Printf("retention: another instance is running, skipped")
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	return j.runOnce(ctx, now)
+}
+
+func (j *Job) runOnce(ctx context.Context, now time.Time) error {
+	if err := j.rollup(ctx, RawTable, MinuteTable, minuteRollupChunk, now); err != nil {
+		return fmt.Errorf("rollup %s: %w", MinuteTable.Name, err)
+	}
+	if err := j.rollup(ctx, MinuteTable, HourTable, hourRollupChunk, now); err != nil {
+		return fmt.Errorf("rollup %s: %w", HourTable.Name, err)
+	}
+
+	for _, p := range []struct {
+		table Table
+		days  int
+		// 数据汇总到的表，为空表示没有下一级
+		next *Table
+	}{
+		{RawTable, j.cfg.RawDays, &MinuteTable},
+		{MinuteTable, j.cfg.MinuteDays, &HourTable},
+		{HourTable, j.cfg.HourDays, nil},
+	} {
+		if p.days == 0 {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -p.days)
+		if p.next != nil {
+			watermark, err := Watermark(ctx, j.db, *p.next)
+			if err != nil {
+				return err
+			}
+			if watermark.Before(cutoff) {
+				cutoff = watermark
+			}
+		}
+		deleted, err := j.prune(ctx, p.table, cutoff)
+		if err != nil {
+			return fmt.Errorf("prune %s: %w", p.table.Name, err)
+		}
+		if deleted > 0 {
+			log.Printf("retention: deleted %d rows older than %s from %s", deleted, cutoff.Format(time.RFC3339), p.table.Name)
+		}
+	}
+	return nil
+}
+
+// 按时间窗口逐段汇总，并记录已经处理到的时间
+func (j *Job) rollup(ctx context.Context, source, target Table, chunk time.Duration, now time.Time) error {
+	end := now.Add(-rollupLag - target.Resolution).Truncate(target.Resolution)
+	if !source.Raw() {
+		// 只汇总源表已经完整的部分
+		sourceWatermark, err := Watermark(ctx, j.db, source)
+		if err != nil {
+			return err
+		}
+		if sourceWatermark = sourceWatermark.Truncate(target.Resolution); sourceWatermark.Before(end) {
+			end = sourceWatermark
+		}
+	}
+
+	start, err := Watermark(ctx, j.db, target)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		// 第一次运行，从源表最早的数据开始
+		var first sql.NullTime
+		if err := j.db.QueryRowContext(ctx, "SELECT MIN(__time) FROM "+source.Name).Scan(&first); err != nil {
+			return err
+		}
+		if !first.Valid {
+			return nil
+		}
+		start = first.Time.UTC().Truncate(chunk)
+	}
+
+	query := rollupQuery(source, target)
+	for start.Before(end) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stop := start.Add(chunk)
+		if stop.After(end) {
+			stop = end
+		}
+		if _, err := j.db.ExecContext(ctx, query, start, stop); err != nil {
+			return err
+		}
+		_, err := j.db.ExecContext(ctx,
+			"INSERT INTO rollup_watermarks (name, watermark) VALUES (?, ?) ON DUPLICATE KEY UPDATE watermark = VALUES(watermark)",
+			target.Name, stop)
+		if err != nil {
+			return err
+		}
+		start = stop
+	}
+	return nil
+}
+
+// Watermark 返回汇总表已经处理到的时间，之前的数据都已汇总；尚未汇总过时返回零值
+func Watermark(ctx context.Context, db *sql.DB, target Table) (time.Time, error) {
+	var watermark time.Time
+	err := db.QueryRowContext(ctx, "SELECT watermark FROM rollup_watermarks WHERE name = ?", target.Name).Scan(&watermark)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return watermark.UTC(), err
+}
+
+// 生成 INSERT ... SELECT 语句，窗口内的桶会被完整地重新计算
+func rollupQuery(source, target Table) string {
+	seconds := int64(target.Resolution / time.Second)
+	columns := []string{"__time", "container_id", "container_name", "samples"}
+	selects := []string{
+		fmt.Sprintf("FROM_UNIXTIME(FLOOR(UNIX_TIMESTAMP(__time) / %d) * %d) AS bucket", seconds, seconds),
+		"container_id",
+		"MAX(container_name)",
+	}
+	if source.Raw() {
+		selects = append(selects, "COUNT(*)")
+	} else {
+		selects = append(selects, "SUM(samples)")
+	}
+
+	for _, metric := range model.ContainerStatMetrics {
+		columns = append(columns, metric+"_sum", metric+"_min", metric+"_max")
+		if source.Raw() {
+			selects = append(selects, "SUM("+metric+")", "MIN("+metric+")", "MAX("+metric+")")
+		} else {
+			selects = append(selects, "SUM("+metric+"_sum)", "MIN("+metric+"_min)", "MAX("+metric+"_max)")
+		}
+	}
+
+	updates := make([]string, 0, len(columns)-2)
+	for _, column := range columns[2:] {
+		updates = append(updates, column+" = VALUES("+column+")")
+	}
+
+	return "INSERT INTO " + target.Name + " (" + strings.Join(columns, ", ") + ") " +
+		"SELECT " + strings.Join(selects, ", ") + " FROM " + source.Name +
+		" WHERE __time >= ? AND __time < ? GROUP BY bucket, container_id" +
+		" ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// 分批删除 cutoff 之前的数据，每批之间暂停，避免长时间持有锁
+func (j *Job) prune(ctx context.Context, table Table, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		result, err := j.db.ExecContext(ctx,
+			"DELETE FROM "+table.Name+" WHERE __time < ? ORDER BY __time LIMIT ?", cutoff, j.cfg.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(j.cfg.BatchSize) {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(j.cfg.BatchPause):
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package retention
+
+import (
+	"strings"
+	"testing"
+
+	"go-mysti/model"
+)
+
+func TestRollupQuery(t *testing.T) {
+	for _, tc := range []struct {
+		source, target Table
+		want           []string
+	}{
+		{RawTable, MinuteTable, []string{
+			"INSERT INTO container_stats_1m (__time, container_id, container_name, samples, cpu_percent_sum, cpu_percent_min, cpu_percent_max,",
+			"SELECT FROM_UNIXTIME(FLOOR(UNIX_TIMESTAMP(__time) / 60) * 60) AS bucket, container_id, MAX(container_name), COUNT(*), " +
+				"SUM(cpu_percent), MIN(cpu_percent), MAX(cpu_percent),",
+			" FROM container_stats WHERE __time >= ? AND __time < ? GROUP BY bucket, container_id",
+			"ON DUPLICATE KEY UPDATE container_name = VALUES(container_name), samples = VALUES(samples), cpu_percent_sum = VALUES(cpu_percent_sum),",
+		}},
+		{MinuteTable, HourTable, []string{
+			"INSERT INTO container_stats_1h (",
+			"FLOOR(UNIX_TIMESTAMP(__time) / 3600) * 3600",
+			"SUM(samples), SUM(cpu_percent_sum), MIN(cpu_percent_min), MAX(cpu_percent_max),",
+			" FROM container_stats_1m WHERE",
+		}},
+	} {
+		t.Run(tc.target.Name, func(t *testing.T) {
+			query := rollupQuery(tc.source, tc.target)
+			for _, want := range tc.want {
+				if !strings.Contains(query, want) {
+					t.Errorf("query does not contain %q:\n%s", want, query)
+				}
+			}
+			if strings.Count(query, "?") != 2 {
+				t.Errorf("query has %d placeholders, want 2", strings.Count(query, "?"))
+			}
+
+			// 插入的列和查询的列一一对应
+			insert := query[strings.Index(query, "(")+1 : strings.Index(query, ")")]
+			selects := query[strings.Index(query, "SELECT ")+len("SELECT ") : strings.Index(query, " FROM "+tc.source.Name)]
+			columns := 4 + 3*len(model.ContainerStatMetrics)
+			if n := len(strings.Split(insert, ", ")); n != columns {
+				t.Errorf("inserts %d columns, want %d", n, columns)
+			}
+			if n := len(strings.Split(selects, ", ")); n != columns {
+				t.Errorf("selects %d columns, want %d", n, columns)
+			}
+		})
+	}
+}
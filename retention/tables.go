@@ -0,0 +1,75 @@
+package retention
+
+import (
+	"time"
+
+	"go-mysti/config"
+)
+
+// Table 是可以查询容器数据的表
+type Table struct {
+	Name string
+	// 每行代表的时间长度，原始表为 0
+	Resolution time.Duration
+}
+
+var (
+	RawTable    = Table{Name: "container_stats"}
+	MinuteTable = Table{Name: "container_stats_1m", Resolution: time.Minute}
+	HourTable   = Table{Name: "container_stats_1h", Resolution: time.Hour}
+)
+
+// Raw 表示原始数据表
+func (t Table) Raw() bool {
+	return t.Resolution == 0
+}
+
+// 表中数据的最早时间，days 为 0 表示永久保留
+func covers(days int, from, now time.Time) bool {
+	return days == 0 || !from.Before(now.AddDate(0, 0, -days))
+}
+
+// ChooseTable 为聚合查询选择数据表
+//
+// 优先使用精度不超过 step 且步长能被整除的最粗的汇总表，这样扫描的行数最少；
+// 需要精确百分位数时，只要原始数据还在就使用原始表。
+// 不看 cfg.Enabled，汇总任务也可以通过 server retention run 运行；
+// 汇总表实际汇总到哪里由 SplitAtWatermark 根据进度判断。
+func ChooseTable(cfg config.RetentionConfig, from time.Time, step time.Duration, exactPercentiles bool, now time.Time) Table {
+	rawCovers := covers(cfg.RawDays, from, now)
+	if exactPercentiles && rawCovers {
+		return RawTable
+	}
+	if step >= HourTable.Resolution && step%HourTable.Resolution == 0 && (!covers(cfg.MinuteDays, from, now) || step >= 6*time.Hour) {
+		return HourTable
+	}
+	if step >= MinuteTable.Resolution && step%MinuteTable.Resolution == 0 {
+		if covers(cfg.MinuteDays, from, now) {
+			return MinuteTable
+		}
+		return HourTable
+	}
+	if rawCovers {
+		return RawTable
+	}
+	// 原始数据已经清理，只能使用汇总表
+	if covers(cfg.MinuteDays, from, now) {
+		return MinuteTable
+	}
+	return HourTable
+}
+
+// SplitAtWatermark 调整 ChooseTable 选择的汇总表：汇总表只包含 watermark 之前的数据，
+// 之后的数据还在原始表中，查询 [from, to) 时这部分需要从原始表读取。
+//
+// 返回查询使用的表和从原始表读取的起点，起点为零值表示不需要读取原始表；
+// 汇总表完全没有覆盖查询范围时直接使用原始表。
+func SplitAtWatermark(table Table, from, to, watermark time.Time) (Table, time.Time) {
+	if table.Raw() || !watermark.Before(to) {
+		return table, time.Time{}
+	}
+	if !watermark.After(from) {
+		return RawTable, time.Time{}
+	}
+	return table, watermark
+}
@@ -0,0 +1,74 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"go-mysti/config"
+)
+
+func TestChooseTable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cfg := config.RetentionConfig{Enabled: true, RawDays: 7, MinuteDays: 30}
+	recent := now.Add(-6 * time.Hour)
+	// 原始数据已经清理
+	lastMonth := now.AddDate(0, 0, -10)
+	// 分钟数据也已经清理
+	lastYear := now.AddDate(0, 0, -60)
+
+	for _, tc := range []struct {
+		name  string
+		cfg   config.RetentionConfig
+		from  time.Time
+		step  time.Duration
+		exact bool
+		want  Table
+	}{
+		// 汇总任务可能由 cron 运行，是否有数据由 SplitAtWatermark 判断
+		{"disabled", config.RetentionConfig{RawDays: 7, MinuteDays: 30}, lastYear, time.Hour, false, HourTable},
+		{"exact percentiles", cfg, recent, time.Hour, true, RawTable},
+		{"exact percentiles without raw data", cfg, lastMonth, time.Minute, true, MinuteTable},
+		{"sub-minute step", cfg, recent, 30 * time.Second, false, RawTable},
+		{"step not divisible by a minute", cfg, recent, 90 * time.Second, false, RawTable},
+		{"sub-minute step without raw data", cfg, lastMonth, 30 * time.Second, false, MinuteTable},
+		{"sub-minute step without minute data", cfg, lastYear, 30 * time.Second, false, HourTable},
+		{"minute step", cfg, recent, 5 * time.Minute, false, MinuteTable},
+		{"minute step without minute data", cfg, lastYear, 5 * time.Minute, false, HourTable},
+		{"hour step", cfg, recent, time.Hour, false, MinuteTable},
+		{"large hour step", cfg, recent, 6 * time.Hour, false, HourTable},
+		{"hour step without minute data", cfg, lastYear, time.Hour, false, HourTable},
+		{"keep forever", config.RetentionConfig{Enabled: true}, lastYear, 30 * time.Second, false, RawTable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ChooseTable(tc.cfg, tc.from, tc.step, tc.exact, now); got != tc.want {
+				t.Errorf("ChooseTable() = %s, want %s", got.Name, tc.want.Name)
+			}
+		})
+	}
+}
+
+func TestSplitAtWatermark(t *testing.T) {
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	for _, tc := range []struct {
+		name      string
+		table     Table
+		watermark time.Time
+		wantTable Table
+		wantFrom  time.Time
+	}{
+		{"raw table", RawTable, from.Add(time.Hour), RawTable, time.Time{}},
+		{"fully rolled up", MinuteTable, to, MinuteTable, time.Time{}},
+		{"tail not rolled up", MinuteTable, from.Add(20 * time.Hour), MinuteTable, from.Add(20 * time.Hour)},
+		{"nothing rolled up", HourTable, time.Time{}, RawTable, time.Time{}},
+		{"rolled up before range", HourTable, from, RawTable, time.Time{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			table, rawFrom := SplitAtWatermark(tc.table, from, to, tc.watermark)
+			if table != tc.wantTable || !rawFrom.Equal(tc.wantFrom) {
+				t.Errorf("SplitAtWatermark() = %s, %s, want %s, %s", table.Name, rawFrom, tc.wantTable.Name, tc.wantFrom)
+			}
+		})
+	}
+}
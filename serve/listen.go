@@ -0,0 +1,123 @@
+package serve
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	unixPrefix    = "unix:"
+	systemdPrefix = "systemd:"
+)
+
+// systemd 传递的第一个文件描述符，测试中修改
+var listenFdsStart = 3
+
+// Listen 根据地址创建监听器
+//
+//	:8080、127.0.0.1:8080  TCP 地址
+//	unix:/run/mysti.sock   Unix 套接字，启动前会删除残留的套接字文件
+//	systemd:               systemd socket activation 传入的第一个套接字
+//	systemd:web            LISTEN_FDNAMES 中名为 web 的套接字
+//
+// 进程由 systemd 按套接字激活时（LISTEN_PID 为当前进程），TCP 地址会被忽略，直接使用继承的第一个套接字。
+func Listen(addr string) (net.Listener, error) {
+	listeners, names, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	if name, ok := strings.CutPrefix(addr, systemdPrefix); ok {
+		if len(listeners) == 0 {
+			return nil, errors.New("no sockets passed by systemd (LISTEN_FDS is not set)")
+		}
+		if name == "" {
+			return useListener(listeners, 0), nil
+		}
+		for i, n := range names {
+			if n == name && i < len(listeners) {
+				return useListener(listeners, i), nil
+			}
+		}
+		useListener(listeners, -1)
+		return nil, fmt.Errorf("systemd socket %q not found in LISTEN_FDNAMES", name)
+	}
+
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		useListener(listeners, -1)
+		return listenUnix(path)
+	}
+
+	if len(listeners) > 0 {
+		return useListener(listeners, 0), nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// 返回第 i 个监听器并关闭其余的，未使用的套接字不关闭时连接会一直停留在队列中得不到处理
+func useListener(listeners []net.Listener, i int) net.Listener {
+	for j, ln := range listeners {
+		if j != i {
+			ln.Close()
+		}
+	}
+	if i < 0 {
+		return nil
+	}
+	return listeners[i]
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("empty unix socket path")
+	}
+	// 删除上次异常退出残留的套接字文件
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// 读取 systemd 传入的套接字，参见 sd_listen_fds(3)
+func systemdListeners() ([]net.Listener, []string, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// 避免子进程重复使用
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFdsStart; fd < listenFdsStart+count; fd++ {
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, nil, fmt.Errorf("systemd socket fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, names, nil
+}
@@ -0,0 +1,101 @@
+package serve
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// 把两个 TCP 监听器复制到从 start 开始的文件描述符，并设置 systemd 的环境变量
+func fakeSystemdSockets(t *testing.T, start int, names string) []string {
+	t.Helper()
+	old := listenFdsStart
+	listenFdsStart = start
+	t.Cleanup(func() { listenFdsStart = old })
+
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := ln.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := syscall.Dup3(int(file.Fd()), start+i, 0); err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, ln.Addr().String())
+		file.Close()
+		ln.Close()
+	}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", names)
+	return addrs
+}
+
+// 被关闭的监听器不再接受连接
+func accepting(addr string) bool {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func TestListenSystemd(t *testing.T) {
+	tests := []struct {
+		addr string
+		use  int
+	}{
+		{"systemd:", 0},
+		{"systemd:web", 1},
+		// 按套接字激活时忽略 TCP 地址
+		{":8080", 0},
+	}
+	for _, tt := range tests {
+		addrs := fakeSystemdSockets(t, 200, "admin:web")
+		ln, err := Listen(tt.addr)
+		if err != nil {
+			t.Fatalf("Listen(%q): %v", tt.addr, err)
+		}
+		if ln.Addr().String() != addrs[tt.use] {
+			t.Errorf("Listen(%q) = %s, want %s", tt.addr, ln.Addr(), addrs[tt.use])
+		}
+		if other := addrs[1-tt.use]; accepting(other) {
+			t.Errorf("Listen(%q): unused socket %s is still open", tt.addr, other)
+		}
+		ln.Close()
+		if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+			t.Errorf("Listen(%q): LISTEN_* environment not cleared", tt.addr)
+		}
+	}
+}
+
+func TestListenSystemdUnused(t *testing.T) {
+	addrs := fakeSystemdSockets(t, 200, "admin:web")
+	_, err := Listen("systemd:missing")
+	if err == nil || !strings.Contains(err.Error(), `"missing" not found`) {
+		t.Errorf("err = %v", err)
+	}
+	for _, addr := range addrs {
+		if accepting(addr) {
+			t.Errorf("socket %s is still open", addr)
+		}
+	}
+
+	// 其他进程的 LISTEN_PID 被忽略
+	fakeSystemdSockets(t, 200, "")
+	t.Setenv("LISTEN_PID", "1")
+	if _, err := Listen("systemd:"); err == nil {
+		t.Error("sockets for another process were used")
+	}
+	syscall.Close(200)
+	syscall.Close(201)
+}
@@ -0,0 +1,65 @@
+package serve
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ln.Addr().Network() != "tcp" {
+		t.Errorf("network = %s", ln.Addr().Network())
+	}
+	ln.Close()
+
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "mysti.sock")
+	ln, err = Listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ln.Addr().Network() != "unix" || ln.Addr().String() != sock {
+		t.Errorf("addr = %s %s", ln.Addr().Network(), ln.Addr())
+	}
+	// 模拟异常退出后残留的套接字文件
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err := os.Stat(sock); err != nil {
+		t.Fatal(err)
+	}
+	ln, err = Listen("unix:" + sock)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListenErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "regular")
+	os.WriteFile(file, nil, 0o644)
+
+	tests := []struct {
+		addr, err string
+	}{
+		{"unix:", "empty unix socket path"},
+		{"unix:" + file, "is not a socket"},
+		{"systemd:", "LISTEN_FDS is not set"},
+		{"systemd:web", "LISTEN_FDS is not set"},
+		{"127.0.0.1:bad", "unknown port"},
+	}
+	for _, tt := range tests {
+		ln, err := Listen(tt.addr)
+		if err == nil {
+			ln.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Listen(%q) err = %v, want %q", tt.addr, err, tt.err)
+		}
+	}
+}
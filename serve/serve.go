@@ -0,0 +1,67 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 默认的优雅关闭等待时间
+const DefaultDrainTimeout = 15 * time.Second
+
+type Options struct {
+	// 监听地址，格式见 Listen
+	Addr string
+	// 收到 SIGINT/SIGTERM 后等待进行中请求完成的最长时间
+	DrainTimeout time.Duration
+}
+
+// Run 启动服务器，直到收到 SIGINT/SIGTERM 后优雅关闭
+func Run(server *http.Server, opts Options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return RunContext(ctx, server, opts)
+}
+
+// RunContext 启动服务器，ctx 结束后停止接收新连接并等待进行中的请求完成
+func RunContext(ctx context.Context, server *http.Server, opts Options) error {
+	ln, err := Listen(opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	drainTimeout := opts.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(ln)
+	}()
+	log.Printf("Listening on %s", ln.Addr())
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", drainTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// 超时后强制关闭剩余连接
+		server.Close()
+		return err
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Revocations 记录已注销会话的随机数，记录保留到会话过期为止
+type Revocations interface {
+	Revoke(ctx context.Context, nonce string, expires time.Time) error
+	Revoked(ctx context.Context, nonce string) (bool, error)
+}
+
+// MemoryRevocations 在内存中保存注销记录，进程重启后丢失，只适合单实例部署
+type MemoryRevocations struct {
+	mu      sync.Mutex
+	nonces  map[string]time.Time
+	expired time.Time
+}
+
+func NewMemoryRevocations() *MemoryRevocations {
+	return &MemoryRevocations{nonces: make(map[string]time.Time)}
+}
+
+func (m *MemoryRevocations) Revoke(ctx context.Context, nonce string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 顺便清理已过期的记录，过期的 cookie 本身就会被拒绝
+	now := time.Now()
+	if now.Sub(m.expired) >= time.Minute {
+		for n, exp := range m.nonces {
+			if !now.Before(exp) {
+				delete(m.nonces, n)
+			}
+		}
+		m.expired = now
+	}
+	if now.Before(expires) {
+		m.nonces[nonce] = expires
+	}
+	return nil
+}
+
+func (m *MemoryRevocations) Revoked(ctx context.Context, nonce string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	exp, ok := m.nonces[nonce]
+	return ok && time.Now().Before(exp), nil
+}
+
+// RedisRevocations 把注销记录保存在 Redis 中，多个实例共享，键在会话过期时自动删除
+type RedisRevocations struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisRevocations(client *redis.Client) *RedisRevocations {
+	return &RedisRevocations{client: client, prefix: "mysti:session:revoked:"}
+}
+
+func (r *RedisRevocations) Revoke(ctx context.Context, nonce string, expires time.Time) error {
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.client.Set(ctx, r.prefix+nonce, 1, ttl).Err()
+}
+
+func (r *RedisRevocations) Revoked(ctx context.Context, nonce string) (bool, error) {
+	n, err := r.client.Exists(ctx, r.prefix+nonce).Result()
+	return n > 0, err
+}
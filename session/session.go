@@ -0,0 +1,155 @@
+// Package session 使用 HMAC 签名的 cookie 保存登录状态
+//
+// cookie 只包含用户 ID、随机数和过期时间，服务端只记录已注销会话的随机数，
+// 复制出去的 cookie 在注销后也不能再使用；
+// CSRF token 由随机数派生，与会话绑定，登录后随会话一起更换。
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalid 表示 cookie 不存在、签名错误、已过期或已注销
+var ErrInvalid = errors.New("invalid session")
+
+// Session 是 cookie 中保存的内容，UserID 为 0 表示未登录的匿名会话
+type Session struct {
+	UserID  int64  `json:"uid,omitempty"`
+	Nonce   string `json:"n"`
+	Expires int64  `json:"exp"`
+}
+
+// Authenticated 表示会话属于已登录用户
+func (s *Session) Authenticated() bool {
+	return s.UserID != 0
+}
+
+type Options struct {
+	// 签名密钥，至少 32 字节
+	Secret []byte
+	// cookie 名称
+	CookieName string
+	// 会话有效期
+	TTL time.Duration
+	// 只通过 HTTPS 发送 cookie
+	Secure bool
+	// 已注销会话的记录，为空时保存在内存中，多个实例需要共享时使用 Redis
+	Revocations Revocations
+}
+
+// Manager 负责会话 cookie 的签发、校验和清除
+type Manager struct {
+	opts Options
+}
+
+func NewManager(opts Options) *Manager {
+	if opts.CookieName == "" {
+		opts.CookieName = "mysti_session"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 12 * time.Hour
+	}
+	if opts.Revocations == nil {
+		opts.Revocations = NewMemoryRevocations()
+	}
+	return &Manager{opts: opts}
+}
+
+// New 为用户创建新会话并写入 cookie，userID 为 0 时创建匿名会话
+func (m *Manager) New(w http.ResponseWriter, userID int64) *Session {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	s := &Session{
+		UserID:  userID,
+		Nonce:   base64.RawURLEncoding.EncodeToString(nonce),
+		Expires: time.Now().Add(m.opts.TTL).Unix(),
+	}
+	payload, _ := json.Marshal(s)
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    value + "." + m.sign(value),
+		Path:     "/",
+		MaxAge:   int(m.opts.TTL / time.Second),
+		HttpOnly: true,
+		Secure:   m.opts.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return s
+}
+
+// Read 校验请求中的会话 cookie
+func (m *Manager) Read(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.opts.CookieName)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	value, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(m.sign(value))) {
+		return nil, ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var s Session
+	if err := json.Unmarshal(payload, &s); err != nil || s.Nonce == "" {
+		return nil, ErrInvalid
+	}
+	if time.Now().Unix() >= s.Expires {
+		return nil, ErrInvalid
+	}
+	revoked, err := m.opts.Revocations.Revoked(r.Context(), s.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("check session revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrInvalid
+	}
+	return &s, nil
+}
+
+// Revoke 注销会话，cookie 过期之前都会被拒绝
+func (m *Manager) Revoke(ctx context.Context, s *Session) error {
+	return m.opts.Revocations.Revoke(ctx, s.Nonce, time.Unix(s.Expires, 0))
+}
+
+// Clear 删除会话 cookie
+func (m *Manager) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.opts.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CSRFToken 返回会话对应的 CSRF token
+func (m *Manager) CSRFToken(s *Session) string {
+	return m.sign("csrf:" + s.Nonce)
+}
+
+// VerifyCSRF 校验 CSRF token，使用常量时间比较
+func (m *Manager) VerifyCSRF(s *Session, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(m.CSRFToken(s))) == 1
+}
+
+func (m *Manager) sign(value string) string {
+	mac := hmac.New(sha256.New, m.opts.Secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,199 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestManager() *Manager {
+	return NewManager(Options{Secret: []byte(strings.Repeat("s", 32)), CookieName: "session", TTL: time.Hour, Secure: true})
+}
+
+// 返回带 cookie 的请求
+func requestWithCookie(cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func issue(t *testing.T, m *Manager, userID int64) (*Session, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s := m.New(w, userID)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	return s, cookies[0]
+}
+
+// 用 m 的密钥签名任意内容
+func forge(m *Manager, s Session) *http.Cookie {
+	payload, _ := json.Marshal(s)
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	return &http.Cookie{Name: m.opts.CookieName, Value: value + "." + m.sign(value)}
+}
+
+func TestNewAndRead(t *testing.T) {
+	m := newTestManager()
+	s, cookie := issue(t, m, 42)
+
+	if cookie.Name != "session" || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode ||
+		cookie.Path != "/" || cookie.MaxAge != 3600 {
+		t.Errorf("cookie = %+v", cookie)
+	}
+	if !s.Authenticated() || s.Nonce == "" {
+		t.Errorf("session = %+v", s)
+	}
+
+	got, err := m.Read(requestWithCookie(cookie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *s {
+		t.Errorf("Read() = %+v, want %+v", got, s)
+	}
+
+	// 每次创建的会话使用不同的随机数
+	other, _ := issue(t, m, 42)
+	if other.Nonce == s.Nonce {
+		t.Error("sessions share a nonce")
+	}
+
+	anonymous, cookie := issue(t, m, 0)
+	if anonymous.Authenticated() {
+		t.Error("anonymous session is authenticated")
+	}
+	if _, err := m.Read(requestWithCookie(cookie)); err != nil {
+		t.Errorf("Read() anonymous: %v", err)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	m := newTestManager()
+	_, cookie := issue(t, m, 42)
+	value, sig, _ := strings.Cut(cookie.Value, ".")
+
+	// 篡改用户 ID 后签名不匹配
+	payload, _ := base64.RawURLEncoding.DecodeString(value)
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), `"uid":42`, `"uid":1`, 1)))
+
+	otherKey := NewManager(Options{Secret: []byte(strings.Repeat("o", 32)), CookieName: "session"})
+	_, otherCookie := issue(t, otherKey, 42)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"missing", nil},
+		{"wrong name", &http.Cookie{Name: "other", Value: cookie.Value}},
+		{"no signature", &http.Cookie{Name: "session", Value: value}},
+		{"bad signature", &http.Cookie{Name: "session", Value: value + "." + sig[:len(sig)-2] + "AA"}},
+		{"tampered payload", &http.Cookie{Name: "session", Value: tampered + "." + sig}},
+		{"other secret", otherCookie},
+		{"expired", forge(m, Session{UserID: 42, Nonce: "n", Expires: time.Now().Add(-time.Second).Unix()})},
+		{"expires now", forge(m, Session{UserID: 42, Nonce: "n", Expires: time.Now().Unix()})},
+		{"no nonce", forge(m, Session{UserID: 42, Expires: time.Now().Add(time.Hour).Unix()})},
+		{"not json", &http.Cookie{Name: "session", Value: "bm90IGpzb24." + m.sign("bm90IGpzb24")}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if s, err := m.Read(requestWithCookie(tc.cookie)); err != ErrInvalid {
+				t.Errorf("Read() = %+v, %v, want ErrInvalid", s, err)
+			}
+		})
+	}
+}
+
+func TestClear(t *testing.T) {
+	m := newTestManager()
+	w := httptest.NewRecorder()
+	m.Clear(w)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].Value != "" || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %+v", cookies)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	m := newTestManager()
+	s, cookie := issue(t, m, 42)
+	_, other := issue(t, m, 42)
+
+	if err := m.Revoke(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.Read(requestWithCookie(cookie)); err != ErrInvalid {
+		t.Errorf("Read() revoked = %+v, %v, want ErrInvalid", got, err)
+	}
+	// 同一用户的其他会话不受影响
+	if _, err := m.Read(requestWithCookie(other)); err != nil {
+		t.Errorf("Read() other session: %v", err)
+	}
+}
+
+func TestMemoryRevocations(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryRevocations()
+	r.Revoke(ctx, "live", time.Now().Add(time.Hour))
+	r.Revoke(ctx, "expired", time.Now().Add(-time.Second))
+	if ok, _ := r.Revoked(ctx, "live"); !ok {
+		t.Error("live nonce is not revoked")
+	}
+	if ok, _ := r.Revoked(ctx, "unknown"); ok {
+		t.Error("unknown nonce is revoked")
+	}
+	// 已过期的会话不需要记录
+	if _, ok := r.nonces["expired"]; ok {
+		t.Error("expired nonce was stored")
+	}
+
+	// 过期的记录在下次注销时清理
+	r.nonces["stale"] = time.Now().Add(-time.Second)
+	r.expired = time.Time{}
+	r.Revoke(ctx, "other", time.Now().Add(time.Hour))
+	if _, ok := r.nonces["stale"]; ok || len(r.nonces) != 2 {
+		t.Errorf("nonces = %v", r.nonces)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	m := newTestManager()
+	s, _ := issue(t, m, 42)
+	other, _ := issue(t, m, 42)
+
+	token := m.CSRFToken(s)
+	if token == "" || token != m.CSRFToken(s) {
+		t.Fatalf("CSRFToken() = %q, not stable", token)
+	}
+	if !m.VerifyCSRF(s, token) {
+		t.Error("VerifyCSRF() rejected the session token")
+	}
+	// token 与会话绑定，重新登录后旧 token 失效
+	if m.VerifyCSRF(other, token) {
+		t.Error("VerifyCSRF() accepted a token of another session")
+	}
+	if m.VerifyCSRF(s, "") || m.VerifyCSRF(s, token[:len(token)-1]) {
+		t.Error("VerifyCSRF() accepted an empty or truncated token")
+	}
+	// token 不能用作会话签名
+	if token == m.sign(s.Nonce) {
+		t.Error("CSRF token equals the signature of the nonce")
+	}
+}
+
+func TestNewManagerDefaults(t *testing.T) {
+	m := NewManager(Options{Secret: []byte(strings.Repeat("s", 32))})
+	_, cookie := issue(t, m, 1)
+	if cookie.Name != "mysti_session" || cookie.MaxAge != int((12*time.Hour)/time.Second) {
+		t.Errorf("cookie = %+v", cookie)
+	}
+}
@@ -0,0 +1,207 @@
+package svgchart
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+)
+
+// 默认配色
+var palette = []string{"#2563eb", "#dc2626", "#16a34a", "#d97706", "#7c3aed", "#0891b2", "#db2777", "#4b5563"}
+
+// Point 是曲线上的一个点，Value 为 nil 表示没有数据，曲线在此断开
+type Point struct {
+	Time  time.Time
+	Value *float64
+}
+
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+type Chart struct {
+	Title  string
+	Width  int
+	Height int
+	// 纵轴刻度格式化，默认保留两位小数
+	FormatValue func(float64) string
+	// 纵轴最小范围，例如百分比固定为 0-100
+	MinY, MaxY *float64
+	Series     []Series
+}
+
+const (
+	marginLeft   = 64
+	marginRight  = 16
+	marginTop    = 28
+	marginBottom = 40
+	yTicks       = 5
+	xTicks       = 6
+)
+
+// Render 生成内联 SVG
+func (c *Chart) Render() template.HTML {
+	width, height := c.Width, c.Height
+	if width <= 0 {
+		width = 720
+	}
+	if height <= 0 {
+		height = 240
+	}
+	format := c.FormatValue
+	if format == nil {
+		format = func(v float64) string { return fmt.Sprintf("%.2f", v) }
+	}
+	plotW := float64(width - marginLeft - marginRight)
+	plotH := float64(height - marginTop - marginBottom)
+
+	minT, maxT, minY, maxY, ok := c.bounds()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="chart" viewBox="0 0 %d %d" width="%d" height="%d" role="img" aria-label="%s">`,
+		width, height, width, height, html.EscapeString(c.Title))
+	fmt.Fprintf(&b, `<text x="%d" y="18" class="chart-title" font-size="13" font-weight="bold">%s</text>`, marginLeft, html.EscapeString(c.Title))
+
+	if !ok {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#6b7280" font-size="12">no data</text></svg>`, width/2, height/2)
+		return template.HTML(b.String())
+	}
+
+	x := func(t time.Time) float64 {
+		if maxT.Equal(minT) {
+			return marginLeft + plotW/2
+		}
+		return marginLeft + plotW*float64(t.Sub(minT))/float64(maxT.Sub(minT))
+	}
+	y := func(v float64) float64 {
+		return marginTop + plotH - plotH*(v-minY)/(maxY-minY)
+	}
+
+	// 网格和纵轴刻度
+	for i := 0; i <= yTicks; i++ {
+		v := minY + (maxY-minY)*float64(i)/yTicks
+		py := y(v)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e5e7eb"/>`, marginLeft, py, marginLeft+plotW, py)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" font-size="10" fill="#6b7280">%s</text>`,
+			marginLeft-6, py+3, html.EscapeString(format(v)))
+	}
+
+	// 横轴刻度
+	layout := timeLayout(maxT.Sub(minT))
+	for i := 0; i <= xTicks; i++ {
+		t := minT.Add(time.Duration(float64(maxT.Sub(minT)) * float64(i) / xTicks))
+		px := x(t)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#f3f4f6"/>`, px, marginTop, px, marginTop+plotH)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="10" fill="#6b7280">%s</text>`,
+			px, marginTop+plotH+14, t.Format(layout))
+	}
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="#d1d5db"/>`, marginLeft, marginTop, plotW, plotH)
+
+	// 曲线，遇到空值断开
+	for i, s := range c.Series {
+		color := palette[i%len(palette)]
+		var path strings.Builder
+		pen := false
+		for _, p := range s.Points {
+			if p.Value == nil {
+				pen = false
+				continue
+			}
+			cmd := "L"
+			if !pen {
+				cmd = "M"
+				pen = true
+			}
+			fmt.Fprintf(&path, "%s%.1f %.1f ", cmd, x(p.Time), y(*p.Value))
+		}
+		if path.Len() > 0 {
+			fmt.Fprintf(&b, `<path d="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-linejoin="round"><title>%s</title></path>`,
+				strings.TrimSpace(path.String()), color, html.EscapeString(s.Name))
+		}
+
+		// 图例
+		lx := marginLeft + i*140
+		ly := height - 8
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, lx, ly-9, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="11">%s</text>`, lx+14, ly, html.EscapeString(truncate(s.Name, 20)))
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func (c *Chart) bounds() (minT, maxT time.Time, minY, maxY float64, ok bool) {
+	minY, maxY = math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			if minT.IsZero() || p.Time.Before(minT) {
+				minT = p.Time
+			}
+			if p.Time.After(maxT) {
+				maxT = p.Time
+			}
+			if p.Value == nil {
+				continue
+			}
+			ok = true
+			minY = math.Min(minY, *p.Value)
+			maxY = math.Max(maxY, *p.Value)
+		}
+	}
+	if !ok {
+		return
+	}
+	if c.MinY != nil {
+		minY = math.Min(minY, *c.MinY)
+	} else if minY > 0 {
+		// 数值类指标从 0 开始更直观
+		minY = 0
+	}
+	if c.MaxY != nil {
+		maxY = math.Max(maxY, *c.MaxY)
+	}
+	if maxY == minY {
+		maxY = minY + 1
+	}
+	return
+}
+
+func timeLayout(span time.Duration) string {
+	switch {
+	case span <= 24*time.Hour:
+		return "15:04"
+	default:
+		return "01-02 15:04"
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// FormatPercent 格式化百分比
+func FormatPercent(v float64) string {
+	return fmt.Sprintf("%.0f%%", v)
+}
+
+// FormatBytes 以 1024 为单位格式化字节数
+func FormatBytes(v float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for math.Abs(v) >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", v, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
@@ -0,0 +1,138 @@
+package svgchart
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func float(v float64) *float64 { return &v }
+
+func points(values ...*float64) []Point {
+	var ps []Point
+	for i, v := range values {
+		ps = append(ps, Point{Time: start.Add(time.Duration(i) * time.Minute), Value: v})
+	}
+	return ps
+}
+
+func TestBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		chart      Chart
+		minY, maxY float64
+	}{
+		{"positive values start at zero", Chart{Series: []Series{{Points: points(float(20), float(40))}}}, 0, 40},
+		{"negative values", Chart{Series: []Series{{Points: points(float(-5), float(10))}}}, -5, 10},
+		{"fixed range", Chart{MinY: float(0), MaxY: float(100), Series: []Series{{Points: points(float(20), float(40))}}}, 0, 100},
+		{"values outside fixed range", Chart{MinY: float(0), MaxY: float(100), Series: []Series{{Points: points(float(-10), float(120))}}}, -10, 120},
+		{"MinY above values", Chart{MinY: float(50), Series: []Series{{Points: points(float(20), float(40))}}}, 20, 40},
+		// 最小值和最大值相同时留出范围，避免除零
+		{"all zero", Chart{Series: []Series{{Points: points(float(0), float(0))}}}, 0, 1},
+		{"equal to MinY", Chart{MinY: float(50), Series: []Series{{Points: points(float(50))}}}, 50, 51},
+		{"nil values ignored", Chart{Series: []Series{{Points: points(nil, float(-3), nil)}}}, -3, -2},
+	}
+	for _, tt := range tests {
+		_, _, minY, maxY, ok := tt.chart.bounds()
+		if !ok || minY != tt.minY || maxY != tt.maxY {
+			t.Errorf("%s: bounds = %v, %v, %v; want %v, %v", tt.name, minY, maxY, ok, tt.minY, tt.maxY)
+		}
+	}
+
+	// 空值也参与时间范围
+	c := Chart{Series: []Series{{Points: points(nil, float(1), nil)}}}
+	minT, maxT, _, _, _ := c.bounds()
+	if !minT.Equal(start) || !maxT.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("time range = %v - %v", minT, maxT)
+	}
+
+	c = Chart{Series: []Series{{Points: points(nil, nil)}}}
+	if _, _, _, _, ok := c.bounds(); ok {
+		t.Error("bounds of nil values reported data")
+	}
+}
+
+func TestRenderGaps(t *testing.T) {
+	c := Chart{Series: []Series{{Name: "cpu", Points: points(float(1), float(2), nil, float(3), float(4), nil, nil, float(5))}}}
+	out := string(c.Render())
+	i := strings.Index(out, `<path d="`) + len(`<path d="`)
+	d := out[i : i+strings.Index(out[i:], `"`)]
+	// 每段数据以 M 开始，空值处断开
+	if strings.Count(d, "M") != 3 || strings.Count(d, "L") != 2 {
+		t.Errorf("path = %q", d)
+	}
+}
+
+func TestRenderNoData(t *testing.T) {
+	for _, c := range []Chart{{}, {Series: []Series{{Name: "cpu", Points: points(nil)}}}} {
+		out := string(c.Render())
+		if !strings.Contains(out, "no data") || strings.Contains(out, "<path") {
+			t.Errorf("render = %s", out)
+		}
+	}
+}
+
+func TestRenderSinglePoint(t *testing.T) {
+	c := Chart{Series: []Series{{Name: "cpu", Points: points(float(7))}}}
+	if out := string(c.Render()); strings.Contains(out, "NaN") || strings.Contains(out, "Inf") {
+		t.Errorf("render = %s", out)
+	}
+}
+
+func TestRenderEscapes(t *testing.T) {
+	c := Chart{
+		Title:  `<script>alert("title")</script>`,
+		Series: []Series{{Name: `web"><script>&`, Points: points(float(1), float(2))}},
+	}
+	out := string(c.Render())
+	if strings.Contains(out, "<script>") || strings.Contains(out, `web">`) {
+		t.Errorf("render is not escaped: %s", out)
+	}
+	if !strings.Contains(out, `aria-label="&lt;script&gt;alert(&#34;title&#34;)&lt;/script&gt;"`) ||
+		!strings.Contains(out, "<title>web&#34;&gt;&lt;script&gt;&amp;</title>") {
+		t.Errorf("render = %s", out)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"web", 3, "web"},
+		{"web-1", 3, "we…"},
+		{"", 3, ""},
+		// 按字符而不是字节截断
+		{"容器名称很长", 4, "容器名…"},
+		{"容器", 2, "容器"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536 * 1024, "1.5 MiB"},
+		{-2048, "-2.0 KiB"},
+		{3 << 30, "3.0 GiB"},
+		// 超过 TiB 时不再进位
+		{1 << 50, "1024.0 TiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.v); got != tt.want {
+			t.Errorf("FormatBytes(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}